@@ -9,22 +9,36 @@ import (
 	_ "net/http/pprof"
 	"os/signal"
 	"path/filepath"
+	"sync"
 	"syscall"
 	"time"
 
 	"go.uber.org/zap"
 	"golang.org/x/crypto/acme/autocert"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
 
 	"github.com/darkseear/shortener/internal/config"
 	"github.com/darkseear/shortener/internal/gzip"
 	"github.com/darkseear/shortener/internal/handlers"
 	"github.com/darkseear/shortener/internal/logger"
+	"github.com/darkseear/shortener/internal/metrics"
 	"github.com/darkseear/shortener/internal/proto"
 	"github.com/darkseear/shortener/internal/services"
 	"github.com/darkseear/shortener/internal/storage"
 )
 
+// healthCheckInterval - период проверки готовности для gRPC Health.
+const healthCheckInterval = 5 * time.Second
+
+// pprofMetrics - регистрирует метрики на общем обработчике сервера pprof один раз за процесс.
+var pprofMetrics sync.Once
+
+// shutdownTimeout - сколько ждать остановки серверов и очередей после задержки ShutdownDrain.
+const shutdownTimeout = 20 * time.Second
+
 var (
 	buildVersion string = "N/A"
 	buildDate    string = "N/A"
@@ -39,16 +53,24 @@ type HTTPServer struct {
 }
 
 // GRPCServer - структура для gRPC сервера.
+// Health - сервис grpc.health.v1, его состояние обновляется в Run.
 type GRPCServer struct {
 	Server *grpc.Server
+	Health *health.Server
 }
 
 // App - основная структура приложения, содержащая серверы, хранилище и конфигурацию.
+// MetricsServer - отдельный сервер метрик, nil, если метрики выключены или отдаются сервером pprof.
 type App struct {
-	HTTPServer *HTTPServer
-	GRPCServer *GRPCServer
-	Storage    storage.Storage
-	Cfg        *config.Config
+	HTTPServer    *HTTPServer
+	GRPCServer    *GRPCServer
+	MetricsServer *http.Server
+	Storage       storage.Storage
+	Reaper        *storage.Reaper
+	Deletes       *storage.DeleteQueue
+	Clicks        *storage.ClickRecorder
+	Health        *storage.Health
+	Cfg           *config.Config
 }
 
 // newApp - инициализирует приложение, настраивает логирование, хранилище и роутер.
@@ -76,20 +98,88 @@ func newApp(ctx context.Context) (*App, error) {
 	}
 
 	if cfg.DatabaseDSN != "" {
-		stor.CreateTableDB(ctx)
+		if err := stor.CreateTableDB(ctx); err != nil {
+			logger.Log.Error("Error prepare database schema", zap.Error(err))
+			return nil, err
+		}
+	}
+
+	// Очередь удаления ссылок общая для HTTP и gRPC серверов
+	deletes := storage.NewDeleteQueue(stor, cfg.DeleteQueueSize, cfg.DeleteBatchSize, cfg.DeleteFlushInterval)
+
+	// Запись переходов для аналитики, отключается нулевым размером буфера
+	var clicks *storage.ClickRecorder
+	if cfg.ClickQueueSize > 0 {
+		clicks = storage.NewClickRecorder(stor, cfg.ClickQueueSize, cfg.ClickBatchSize, cfg.ClickFlushInterval)
+	}
+
+	// Глубина фоновых очередей в метриках, очереди предыдущего приложения заменяются
+	var clicksDepth func() int
+	if clicks != nil {
+		clicksDepth = clicks.Len
 	}
+	metrics.SetQueue("delete", deletes.Len)
+	metrics.SetQueue("clicks", clicksDepth)
+
+	// Готовность общая для HTTP и gRPC серверов
+	readiness := storage.NewHealth(stor)
 
-	router := logger.WhithLogging(gzip.GzipMiddleware(handlers.Routers(cfg, stor).Handle))
+	// IP клиента из заголовков принимается только от доверенных прокси
+	proxies, err := services.ParseTrustedProxies(cfg.TrustedProxies)
+	if err != nil {
+		return nil, err
+	}
+
+	// Лимиты частоты запросов общие для HTTP и gRPC серверов
+	limiter := services.NewRateLimiter(map[string]services.RateLimit{
+		services.RateCreate:   {Rate: cfg.CreateRateLimit, Burst: cfg.CreateRateBurst},
+		services.RateRedirect: {Rate: cfg.RedirectRateLimit, Burst: cfg.RedirectRateBurst},
+		services.RateDelete:   {Rate: cfg.DeleteRateLimit, Burst: cfg.DeleteRateBurst},
+	})
+
+	routers := handlers.Routers(cfg, stor)
+	routers.Health = readiness
+	routers.RateLimiter = limiter
+	routers.Proxies = proxies
+	routers.Deletes = deletes
+	routers.Clicks = clicks
+	// Recoverer внутри gzip, чтобы ответ 500 после паники тоже сжимался с правильными заголовками.
+	router := logger.WithRequestID(logger.WhithLogging(gzip.GzipMiddleware(handlers.Recoverer(routers.Handle))))
 	httpSrv := &http.Server{
 		Addr:    cfg.Address,
 		Handler: router,
 	}
 
 	// Настройка gRPC сервера
-	auth := services.NewAuthService(cfg.SecretKey).UnaryAuthInterceptor()
-	grpcSrv := grpc.NewServer(grpc.UnaryInterceptor(auth))
+	grpcSrv := grpc.NewServer(proto.ServerOptions(services.NewAuthService(cfg.SecretKey), limiter, proxies)...)
 	nss := proto.NewGRPCShortenerServer(stor, cfg)
+	// Неверные пароли по HTTP и gRPC учитываются вместе.
+	nss.Limiter = routers.Limiter
+	nss.Deletes = deletes
+	nss.Clicks = clicks
+	nss.Proxies = proxies
 	proto.RegisterSortenerServer(grpcSrv, nss)
+	grpcHealth := health.NewServer()
+	healthpb.RegisterHealthServer(grpcSrv, grpcHealth)
+	// Reflection отдает описания всех зарегистрированных на сервере сервисов, включая health
+	if cfg.GRPCReflection {
+		reflection.Register(grpcSrv)
+		logger.Log.Info("gRPC reflection enabled")
+	}
+
+	// Метрики Prometheus отдаются сервером pprof, если адреса совпадают, иначе отдельным сервером
+	var metricsSrv *http.Server
+	if cfg.MetricsAddr != "" && cfg.MetricsAddr != cfg.PprofAddr {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", metrics.Handler())
+		metricsSrv = &http.Server{Addr: cfg.MetricsAddr, Handler: mux}
+	}
+
+	// Удаление ссылок с истекшим сроком жизни и окончательное удаление старых удаленных, запускается в Run
+	var reaper *storage.Reaper
+	if cfg.ReapInterval > 0 {
+		reaper = storage.NewReaper(stor, cfg.ReapInterval, cfg.ReapBatchSize, cfg.DeleteGracePeriod)
+	}
 
 	return &App{
 		HTTPServer: &HTTPServer{
@@ -99,15 +189,33 @@ func newApp(ctx context.Context) (*App, error) {
 		},
 		GRPCServer: &GRPCServer{
 			Server: grpcSrv,
+			Health: grpcHealth,
 		},
-		Storage: stor,
-		Cfg:     cfg,
+		MetricsServer: metricsSrv,
+		Storage:       stor,
+		Reaper:        reaper,
+		Deletes:       deletes,
+		Clicks:        clicks,
+		Health:        readiness,
+		Cfg:           cfg,
 	}, nil
 }
 
 // Run - запускает приложение, инициализирует сервер и обрабатывает сигналы завершения.
 func (a *App) Run(ctx context.Context) {
 
+	// Метрики Prometheus отдаются сервером pprof, если адреса совпадают, иначе отдельным сервером
+	if a.MetricsServer != nil {
+		go func() {
+			logger.Log.Info("Starting metrics server", zap.String("address", a.MetricsServer.Addr))
+			if err := a.MetricsServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				logger.Log.Error("Error starting metrics server", zap.Error(err))
+			}
+		}()
+	} else if a.Cfg.MetricsAddr != "" && a.Cfg.MetricsAddr == a.Cfg.PprofAddr {
+		pprofMetrics.Do(func() { http.Handle("/metrics", metrics.Handler()) })
+	}
+
 	// Инициализация pprof для профилирования
 	go func() {
 		pprofAddr := a.Cfg.PprofAddr
@@ -117,6 +225,16 @@ func (a *App) Run(ctx context.Context) {
 		}
 	}()
 
+	// Обновление состояния gRPC Health по готовности хранилища
+	if a.Health != nil && a.GRPCServer != nil && a.GRPCServer.Health != nil {
+		go a.Health.Watch(ctx, healthCheckInterval, a.setServingStatus)
+	}
+
+	// Запуск удаления ссылок с истекшим сроком жизни
+	if a.Reaper != nil {
+		a.Reaper.Start(ctx)
+	}
+
 	var err error
 	// Запуск HTTP сервера с поддержкой HTTPS, если включено
 	go func() {
@@ -152,7 +270,7 @@ func (a *App) Run(ctx context.Context) {
 
 	<-ctx.Done()
 	logger.Log.Info("Received shutdown signal, shutting down server")
-	shutdownCtx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout+a.Cfg.ShutdownDrain)
 	defer cancel()
 	if err := a.Close(shutdownCtx); err != nil {
 		logger.Log.Error("Error during shutdown", zap.Error(err))
@@ -162,10 +280,38 @@ func (a *App) Run(ctx context.Context) {
 
 }
 
+// setServingStatus - обновляет состояние gRPC Health для сервера в целом и для сервиса сокращения.
+func (a *App) setServingStatus(err error) {
+	status := healthpb.HealthCheckResponse_SERVING
+	if err != nil {
+		logger.Log.Warn("Service is not ready", zap.Error(err))
+		status = healthpb.HealthCheckResponse_NOT_SERVING
+	}
+	a.GRPCServer.Health.SetServingStatus("", status)
+	a.GRPCServer.Health.SetServingStatus(proto.Sortener_ServiceDesc.ServiceName, status)
+}
+
 // Close - закрывает приложение, останавливает сервер и освобождает ресурсы.
 func (a *App) Close(ctx context.Context) error {
 	var errs []error
 
+	// Сообщаем о неготовности до остановки серверов, чтобы балансировщик перестал слать запросы
+	if a.Health != nil {
+		a.Health.Shutdown()
+	}
+	if a.GRPCServer != nil && a.GRPCServer.Health != nil {
+		a.GRPCServer.Health.Shutdown()
+	}
+
+	// Серверы продолжают обслуживать запросы, пока балансировщик не заметит неготовность
+	if a.Cfg != nil && a.Cfg.ShutdownDrain > 0 {
+		logger.Log.Info("Draining before shutdown", zap.Duration("delay", a.Cfg.ShutdownDrain))
+		select {
+		case <-time.After(a.Cfg.ShutdownDrain):
+		case <-ctx.Done():
+		}
+	}
+
 	// Останавливаем gRPC сервер
 	if a.GRPCServer != nil && a.GRPCServer.Server != nil {
 		a.GRPCServer.Server.GracefulStop()
@@ -182,6 +328,42 @@ func (a *App) Close(ctx context.Context) error {
 		}
 	}
 
+	// Останавливаем сервер метрик после основных серверов, чтобы метрики были доступны во время остановки
+	if a.MetricsServer != nil {
+		if err := a.MetricsServer.Shutdown(ctx); err != nil && err != http.ErrServerClosed {
+			logger.Log.Error("Error shutting down metrics server", zap.Error(err))
+			errs = append(errs, err)
+		} else {
+			logger.Log.Info("Metrics server stopped")
+		}
+	}
+
+	// Останавливаем удаление истекших ссылок до закрытия storage
+	if a.Reaper != nil {
+		a.Reaper.Stop()
+		logger.Log.Info("Reaper stopped")
+	}
+
+	// Дожидаемся записи принятых удалений, серверы уже не принимают новые запросы
+	if a.Deletes != nil {
+		if err := a.Deletes.Close(ctx); err != nil {
+			logger.Log.Error("Error draining delete queue", zap.Error(err))
+			errs = append(errs, err)
+		} else {
+			logger.Log.Info("Delete queue drained")
+		}
+	}
+
+	// Записываем оставшиеся события переходов
+	if a.Clicks != nil {
+		if err := a.Clicks.Close(ctx); err != nil {
+			logger.Log.Error("Error flushing click events", zap.Error(err))
+			errs = append(errs, err)
+		} else {
+			logger.Log.Info("Click events flushed", zap.Int64("dropped", a.Clicks.Dropped()))
+		}
+	}
+
 	// Закрываем storage
 	if a.Storage != nil {
 		if err := a.Storage.Close(); err != nil {
@@ -214,9 +396,8 @@ func main() {
 		logger.Log.Error("Error create app", zap.Error(err))
 		log.Fatalf("Error app: %v", err)
 	}
+	// Run закрывает приложение после сигнала завершения
 	app.Run(ctx)
-	defer app.Close(ctx)
-
 }
 
 // buildInfo возвращает информацию о сборке приложения
@@ -2,14 +2,19 @@ package main
 
 import (
 	"context"
+	"net"
+	"net/http"
 	"testing"
 	"time"
 
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
 
+	"github.com/darkseear/shortener/internal/config"
 	"github.com/darkseear/shortener/internal/proto"
+	"github.com/darkseear/shortener/internal/storage"
 )
 
 func TestApp_Run_GRPCServer(t *testing.T) {
@@ -45,3 +50,46 @@ func TestApp_Run_GRPCServer(t *testing.T) {
 	require.NoError(t, err)
 	require.NotEmpty(t, respShort.ShortUrl)
 }
+
+func TestAppCloseDrain(t *testing.T) {
+	store, err := storage.New(&config.Config{URL: "http://localhost:8080"})
+	require.NoError(t, err)
+	app := &App{Cfg: &config.Config{ShutdownDrain: 100 * time.Millisecond}, Health: storage.NewHealth(store)}
+
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() { done <- app.Close(context.Background()) }()
+
+	// Во время задержки экземпляр уже не готов, но остановка еще не завершена.
+	require.Eventually(t, func() bool { return app.Health.Ready(context.Background()) != nil }, time.Second, time.Millisecond)
+	select {
+	case <-done:
+		t.Fatal("Close returned before drain delay")
+	default:
+	}
+	require.NoError(t, <-done)
+	assert.GreaterOrEqual(t, time.Since(start), 100*time.Millisecond)
+
+	// Истекший контекст прерывает задержку.
+	app = &App{Cfg: &config.Config{ShutdownDrain: time.Hour}}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	require.NoError(t, app.Close(ctx))
+}
+
+func TestAppCloseMetricsServer(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	app := &App{Cfg: &config.Config{}, MetricsServer: &http.Server{Handler: http.NotFoundHandler()}}
+	served := make(chan error, 1)
+	go func() { served <- app.MetricsServer.Serve(ln) }()
+
+	// Close останавливает сервер метрик вместе с остальными.
+	require.NoError(t, app.Close(context.Background()))
+	select {
+	case err := <-served:
+		assert.ErrorIs(t, err, http.ErrServerClosed)
+	case <-time.After(time.Second):
+		t.Fatal("metrics server is still running")
+	}
+}
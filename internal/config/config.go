@@ -4,7 +4,9 @@ import (
 	"encoding/json"
 	"flag"
 	"os"
+	"strconv"
 	"sync"
+	"time"
 
 	"github.com/darkseear/shortener/internal/logger"
 	"go.uber.org/zap"
@@ -20,9 +22,63 @@ type Config struct {
 	SecretKey     string `env:"SECRET_KEY"`
 	EnableHTTPS   bool   `env:"ENABLE_HTTPS"`
 	PprofAddr     string `env:"PPROF_ADDR"`
+	MetricsAddr   string `env:"METRICS_ADDR"` // Адрес сервера метрик, пустой - метрики выключены, совпадающий с PprofAddr - метрики на сервере pprof
 	ConfigFile    string `env:"CONFIG"`
 	TrustedSubnet string `env:"TRUSTED_SUBNET"`
 	GRPCAddr      string `env:"GRPC_ADDR"` // Адрес gRPC сервера
+	// TrustedProxies - подсети доверенных прокси через запятую, только от них принимается IP клиента в X-Real-IP и client_ip.
+	TrustedProxies string `env:"TRUSTED_PROXIES"`
+	// FileCompactInterval - период проверки журнала файлового хранилища на сжатие, 0 - сжатие отключено.
+	FileCompactInterval time.Duration `env:"FILE_COMPACT_INTERVAL"`
+	// FileRecover - обрезать поврежденный хвост журнала при загрузке вместо ошибки.
+	FileRecover bool `env:"FILE_RECOVER"`
+	// ShortCodeGenerator - генератор коротких адресов: random, counter или hash.
+	ShortCodeGenerator string `env:"SHORT_CODE_GENERATOR"`
+	// ShortCodeLength - длина короткого адреса.
+	ShortCodeLength int `env:"SHORT_CODE_LENGTH"`
+	// ShortCodeAlphabet - алфавит коротких адресов, по умолчанию base62.
+	ShortCodeAlphabet string `env:"SHORT_CODE_ALPHABET"`
+	// ReapInterval - интервал удаления ссылок с истекшим сроком жизни, 0 отключает удаление.
+	ReapInterval time.Duration `env:"REAP_INTERVAL"`
+	// ReapBatchSize - сколько ссылок с истекшим сроком удаляется за один запрос к хранилищу.
+	ReapBatchSize int `env:"REAP_BATCH_SIZE"`
+	// DeleteQueueSize - сколько запросов на удаление может ждать в очереди.
+	DeleteQueueSize int `env:"DELETE_QUEUE_SIZE"`
+	// DeleteBatchSize - сколько ссылок накапливается в очереди удаления до записи в хранилище.
+	DeleteBatchSize int `env:"DELETE_BATCH_SIZE"`
+	// DeleteFlushInterval - максимальное время ожидания запроса на удаление в очереди.
+	DeleteFlushInterval time.Duration `env:"DELETE_FLUSH_INTERVAL"`
+	// DeleteGracePeriod - сколько удаленную ссылку можно восстановить, после этого она удаляется окончательно.
+	// По умолчанию 0 - удаленные ссылки не удаляются окончательно и восстанавливаются без ограничения по времени,
+	// окончательное удаление включается явно, например -dg 720h или DELETE_GRACE_PERIOD=720h.
+	DeleteGracePeriod time.Duration `env:"DELETE_GRACE_PERIOD"`
+	// ClickQueueSize - сколько событий переходов может ждать записи, 0 отключает аналитику.
+	ClickQueueSize int `env:"CLICK_QUEUE_SIZE"`
+	// ClickBatchSize - сколько событий переходов записывается в хранилище за один раз.
+	ClickBatchSize int `env:"CLICK_BATCH_SIZE"`
+	// ClickFlushInterval - максимальное время ожидания события перехода в очереди.
+	ClickFlushInterval time.Duration `env:"CLICK_FLUSH_INTERVAL"`
+	// GRPCReflection - регистрировать на gRPC сервере reflection для grpcurl и подобных инструментов.
+	GRPCReflection bool `env:"GRPC_REFLECTION"`
+	// ShutdownDrain - сколько ждать при остановке между отметкой о неготовности и остановкой серверов,
+	// чтобы балансировщик успел убрать экземпляр. Задается больше периода проверки готовности, 0 - не ждать.
+	ShutdownDrain time.Duration `env:"SHUTDOWN_DRAIN"`
+	// Лимиты частоты запросов по умолчанию выключены (0). Чтобы включить лимит операции,
+	// задайте его флагом или переменной окружения, например -rc 10 -rcb 20 или CREATE_RATE_LIMIT=10.
+	// Клиенты за прокси различаются по IP-адресу, только если прокси указаны в TrustedProxies.
+
+	// CreateRateLimit - сколько ссылок в секунду может создавать один пользователь или IP-адрес, 0 отключает лимит.
+	CreateRateLimit float64 `env:"CREATE_RATE_LIMIT"`
+	// CreateRateBurst - сколько запросов на создание ссылок можно сделать подряд сверх CreateRateLimit.
+	CreateRateBurst int `env:"CREATE_RATE_BURST"`
+	// RedirectRateLimit - сколько переходов в секунду может делать один пользователь или IP-адрес, 0 отключает лимит.
+	RedirectRateLimit float64 `env:"REDIRECT_RATE_LIMIT"`
+	// RedirectRateBurst - сколько переходов можно сделать подряд сверх RedirectRateLimit.
+	RedirectRateBurst int `env:"REDIRECT_RATE_BURST"`
+	// DeleteRateLimit - сколько запросов на удаление в секунду может делать один пользователь или IP-адрес, 0 отключает лимит.
+	DeleteRateLimit float64 `env:"DELETE_RATE_LIMIT"`
+	// DeleteRateBurst - сколько запросов на удаление можно сделать подряд сверх DeleteRateLimit.
+	DeleteRateBurst int `env:"DELETE_RATE_BURST"`
 }
 
 // ConfigFile структура для хранения конфигурации из файла.
@@ -47,9 +103,37 @@ var (
 	flagSecretKey     string
 	flagEnableHTTPS   bool
 	flagPprofAddr     string
+	flagMetricsAddr   string
 	flagConfigFile    string
 	flagTrustedSubnet string
 	flagGRPCAddr      string
+	flagProxies       string
+	flagCompact       time.Duration
+	flagFileRecover   bool
+	flagCodeGenerator string
+	flagCodeLength    int
+	flagCodeAlphabet  string
+	flagReapInterval  time.Duration
+	flagReapBatchSize int
+
+	flagDeleteQueueSize     int
+	flagDeleteBatchSize     int
+	flagDeleteFlushInterval time.Duration
+	flagDeleteGracePeriod   time.Duration
+
+	flagClickQueueSize     int
+	flagClickBatchSize     int
+	flagClickFlushInterval time.Duration
+
+	flagGRPCReflection bool
+	flagShutdownDrain  time.Duration
+
+	flagCreateRateLimit   float64
+	flagCreateRateBurst   int
+	flagRedirectRateLimit float64
+	flagRedirectRateBurst int
+	flagDeleteRateLimit   float64
+	flagDeleteRateBurst   int
 )
 
 // registerFlags инициализирует флаги один раз.
@@ -63,10 +147,34 @@ func registerFlags() {
 		flag.StringVar(&flagSecretKey, "sk", "secretkey", "Secret key for JWT")
 		flag.BoolVar(&flagEnableHTTPS, "s", false, "Enable HTTPS (default: false)")
 		flag.StringVar(&flagPprofAddr, "p", ":8081", "Address for pprof server")
+		flag.StringVar(&flagMetricsAddr, "m", "", "Address for Prometheus metrics server, empty disables metrics")
 		flag.StringVar(&flagConfigFile, "c", "", "Path to config file")
 		flag.StringVar(&flagConfigFile, "config", "", "Path to config file")
 		flag.StringVar(&flagTrustedSubnet, "t", "", "Trusted subnet for internal requests")
 		flag.StringVar(&flagGRPCAddr, "g", "localhost:9090", "gRPC server address")
+		flag.StringVar(&flagProxies, "tp", "", "Comma-separated trusted proxy subnets allowed to pass client IP in X-Real-IP")
+		flag.DurationVar(&flagCompact, "fc", 10*time.Minute, "File storage compaction check interval, 0 disables compaction")
+		flag.BoolVar(&flagFileRecover, "fr", false, "Truncate corrupt tail of file storage on startup")
+		flag.StringVar(&flagCodeGenerator, "cg", "random", "Short code generator: random, counter or hash")
+		flag.IntVar(&flagCodeLength, "cl", 8, "Short code length")
+		flag.StringVar(&flagCodeAlphabet, "ca", "", "Short code alphabet (default base62)")
+		flag.DurationVar(&flagReapInterval, "ri", time.Minute, "Expired links cleanup interval, 0 disables cleanup")
+		flag.IntVar(&flagReapBatchSize, "rb", 500, "Expired links cleanup batch size")
+		flag.IntVar(&flagDeleteQueueSize, "dq", 1024, "Delete queue buffer size in requests")
+		flag.IntVar(&flagDeleteBatchSize, "delete-batch", 500, "Delete queue batch size in links")
+		flag.DurationVar(&flagDeleteFlushInterval, "di", time.Second, "Delete queue flush interval")
+		flag.DurationVar(&flagDeleteGracePeriod, "dg", 0, "How long deleted links can be restored before purge, 0 disables purge")
+		flag.IntVar(&flagClickQueueSize, "eq", 4096, "Click events buffer size, 0 disables click analytics")
+		flag.IntVar(&flagClickBatchSize, "eb", 500, "Click events batch size")
+		flag.DurationVar(&flagClickFlushInterval, "ei", time.Second, "Click events flush interval")
+		flag.BoolVar(&flagGRPCReflection, "gr", false, "Enable gRPC server reflection for development tools")
+		flag.DurationVar(&flagShutdownDrain, "sd", 0, "Delay between reporting not ready and stopping servers on shutdown")
+		flag.Float64Var(&flagCreateRateLimit, "rc", 0, "Link creation rate limit per user and IP in requests per second, 0 disables the limit")
+		flag.IntVar(&flagCreateRateBurst, "rcb", 20, "Link creation rate limit burst")
+		flag.Float64Var(&flagRedirectRateLimit, "rr", 0, "Redirect rate limit per user and IP in requests per second, 0 disables the limit")
+		flag.IntVar(&flagRedirectRateBurst, "rrb", 100, "Redirect rate limit burst")
+		flag.Float64Var(&flagDeleteRateLimit, "rd", 0, "Link deletion rate limit per user and IP in requests per second, 0 disables the limit")
+		flag.IntVar(&flagDeleteRateBurst, "rdb", 10, "Link deletion rate limit burst")
 	})
 }
 
@@ -87,9 +195,41 @@ func New() *Config {
 		SecretKey:     flagSecretKey,
 		EnableHTTPS:   flagEnableHTTPS,
 		PprofAddr:     flagPprofAddr,
+		MetricsAddr:   flagMetricsAddr,
 		TrustedSubnet: flagTrustedSubnet,
 		ConfigFile:    flagConfigFile,
 		GRPCAddr:      flagGRPCAddr,
+
+		TrustedProxies: flagProxies,
+
+		FileCompactInterval: flagCompact,
+		FileRecover:         flagFileRecover,
+
+		ShortCodeGenerator: flagCodeGenerator,
+		ShortCodeLength:    flagCodeLength,
+		ShortCodeAlphabet:  flagCodeAlphabet,
+
+		ReapInterval:  flagReapInterval,
+		ReapBatchSize: flagReapBatchSize,
+
+		DeleteQueueSize:     flagDeleteQueueSize,
+		DeleteBatchSize:     flagDeleteBatchSize,
+		DeleteFlushInterval: flagDeleteFlushInterval,
+		DeleteGracePeriod:   flagDeleteGracePeriod,
+
+		ClickQueueSize:     flagClickQueueSize,
+		ClickBatchSize:     flagClickBatchSize,
+		ClickFlushInterval: flagClickFlushInterval,
+
+		GRPCReflection: flagGRPCReflection,
+		ShutdownDrain:  flagShutdownDrain,
+
+		CreateRateLimit:   flagCreateRateLimit,
+		CreateRateBurst:   flagCreateRateBurst,
+		RedirectRateLimit: flagRedirectRateLimit,
+		RedirectRateBurst: flagRedirectRateBurst,
+		DeleteRateLimit:   flagDeleteRateLimit,
+		DeleteRateBurst:   flagDeleteRateBurst,
 	}
 
 	// Переопределение значений переменными окружения
@@ -104,6 +244,14 @@ func setFromEnv(cfg *Config) {
 
 	setStringFields(cfg, configFile)
 	setEnableHTTPS(cfg, configFile)
+	setFileStorage(cfg)
+	setShortCodeLength(cfg)
+	setReaper(cfg)
+	setDeleteQueue(cfg)
+	setClickRecorder(cfg)
+	setGRPCReflection(cfg)
+	setShutdownDrain(cfg)
+	setRateLimits(cfg)
 }
 
 // getConfigFile - конфиг из файла.
@@ -125,9 +273,14 @@ func setStringFields(cfg *Config, configFile ConfigFile) {
 		"DATABASE_DSN":      &cfg.DatabaseDSN,
 		"SECRET_KEY":        &cfg.SecretKey,
 		"PPROF_ADDR":        &cfg.PprofAddr,
+		"METRICS_ADDR":      &cfg.MetricsAddr,
 		"CONFIG":            &cfg.ConfigFile,
 		"TRUSTED_SUBNET":    &cfg.TrustedSubnet,
 		"GRPC_ADDR":         &cfg.GRPCAddr,
+
+		"SHORT_CODE_GENERATOR": &cfg.ShortCodeGenerator,
+		"SHORT_CODE_ALPHABET":  &cfg.ShortCodeAlphabet,
+		"TRUSTED_PROXIES":      &cfg.TrustedProxies,
 	}
 
 	for env, ptr := range envVars {
@@ -174,6 +327,164 @@ func setEnableHTTPS(cfg *Config, configFile ConfigFile) {
 	}
 }
 
+// setFileStorage - устанавливает параметры файлового хранилища из переменных окружения.
+func setFileStorage(cfg *Config) {
+	if val, ok := os.LookupEnv("FILE_COMPACT_INTERVAL"); ok {
+		d, err := time.ParseDuration(val)
+		if err != nil {
+			logger.Log.Error("Error parsing FILE_COMPACT_INTERVAL", zap.Error(err))
+		} else {
+			cfg.FileCompactInterval = d
+		}
+	}
+	if val, ok := os.LookupEnv("FILE_RECOVER"); ok {
+		cfg.FileRecover = val == "true" || val == "1"
+	}
+}
+
+// setShortCodeLength - устанавливает длину короткого адреса из переменной окружения.
+func setShortCodeLength(cfg *Config) {
+	if val, ok := os.LookupEnv("SHORT_CODE_LENGTH"); ok {
+		n, err := strconv.Atoi(val)
+		if err != nil {
+			logger.Log.Error("Error parsing SHORT_CODE_LENGTH", zap.Error(err))
+			return
+		}
+		cfg.ShortCodeLength = n
+	}
+}
+
+// setReaper - устанавливает параметры удаления ссылок с истекшим сроком из переменных окружения.
+func setReaper(cfg *Config) {
+	if val, ok := os.LookupEnv("REAP_INTERVAL"); ok {
+		d, err := time.ParseDuration(val)
+		if err != nil {
+			logger.Log.Error("Error parsing REAP_INTERVAL", zap.Error(err))
+		} else {
+			cfg.ReapInterval = d
+		}
+	}
+	if val, ok := os.LookupEnv("REAP_BATCH_SIZE"); ok {
+		n, err := strconv.Atoi(val)
+		if err != nil {
+			logger.Log.Error("Error parsing REAP_BATCH_SIZE", zap.Error(err))
+		} else {
+			cfg.ReapBatchSize = n
+		}
+	}
+}
+
+// setDeleteQueue - устанавливает параметры очереди удаления и восстановления ссылок из переменных окружения.
+func setDeleteQueue(cfg *Config) {
+	ints := map[string]*int{
+		"DELETE_QUEUE_SIZE": &cfg.DeleteQueueSize,
+		"DELETE_BATCH_SIZE": &cfg.DeleteBatchSize,
+	}
+	for env, ptr := range ints {
+		if val, ok := os.LookupEnv(env); ok {
+			n, err := strconv.Atoi(val)
+			if err != nil {
+				logger.Log.Error("Error parsing "+env, zap.Error(err))
+				continue
+			}
+			*ptr = n
+		}
+	}
+	durations := map[string]*time.Duration{
+		"DELETE_FLUSH_INTERVAL": &cfg.DeleteFlushInterval,
+		"DELETE_GRACE_PERIOD":   &cfg.DeleteGracePeriod,
+	}
+	for env, ptr := range durations {
+		if val, ok := os.LookupEnv(env); ok {
+			d, err := time.ParseDuration(val)
+			if err != nil {
+				logger.Log.Error("Error parsing "+env, zap.Error(err))
+				continue
+			}
+			*ptr = d
+		}
+	}
+}
+
+// setClickRecorder - устанавливает параметры записи событий переходов из переменных окружения.
+func setClickRecorder(cfg *Config) {
+	ints := map[string]*int{
+		"CLICK_QUEUE_SIZE": &cfg.ClickQueueSize,
+		"CLICK_BATCH_SIZE": &cfg.ClickBatchSize,
+	}
+	for env, ptr := range ints {
+		if val, ok := os.LookupEnv(env); ok {
+			n, err := strconv.Atoi(val)
+			if err != nil {
+				logger.Log.Error("Error parsing "+env, zap.Error(err))
+				continue
+			}
+			*ptr = n
+		}
+	}
+	if val, ok := os.LookupEnv("CLICK_FLUSH_INTERVAL"); ok {
+		d, err := time.ParseDuration(val)
+		if err != nil {
+			logger.Log.Error("Error parsing CLICK_FLUSH_INTERVAL", zap.Error(err))
+		} else {
+			cfg.ClickFlushInterval = d
+		}
+	}
+}
+
+// setGRPCReflection - включает gRPC reflection из переменной окружения.
+func setGRPCReflection(cfg *Config) {
+	if val, ok := os.LookupEnv("GRPC_REFLECTION"); ok {
+		cfg.GRPCReflection = val == "true" || val == "1"
+	}
+}
+
+// setShutdownDrain - устанавливает задержку остановки серверов из переменной окружения.
+func setShutdownDrain(cfg *Config) {
+	if val, ok := os.LookupEnv("SHUTDOWN_DRAIN"); ok {
+		d, err := time.ParseDuration(val)
+		if err != nil {
+			logger.Log.Error("Error parsing SHUTDOWN_DRAIN", zap.Error(err))
+			return
+		}
+		cfg.ShutdownDrain = d
+	}
+}
+
+// setRateLimits - устанавливает лимиты частоты запросов из переменных окружения.
+func setRateLimits(cfg *Config) {
+	rates := map[string]*float64{
+		"CREATE_RATE_LIMIT":   &cfg.CreateRateLimit,
+		"REDIRECT_RATE_LIMIT": &cfg.RedirectRateLimit,
+		"DELETE_RATE_LIMIT":   &cfg.DeleteRateLimit,
+	}
+	for env, ptr := range rates {
+		if val, ok := os.LookupEnv(env); ok {
+			f, err := strconv.ParseFloat(val, 64)
+			if err != nil {
+				logger.Log.Error("Error parsing "+env, zap.Error(err))
+				continue
+			}
+			*ptr = f
+		}
+	}
+	bursts := map[string]*int{
+		"CREATE_RATE_BURST":   &cfg.CreateRateBurst,
+		"REDIRECT_RATE_BURST": &cfg.RedirectRateBurst,
+		"DELETE_RATE_BURST":   &cfg.DeleteRateBurst,
+	}
+	for env, ptr := range bursts {
+		if val, ok := os.LookupEnv(env); ok {
+			n, err := strconv.Atoi(val)
+			if err != nil {
+				logger.Log.Error("Error parsing "+env, zap.Error(err))
+				continue
+			}
+			*ptr = n
+		}
+	}
+}
+
 // configFormFile читает конфигурацию из файла, если указан путь к файлу.
 // Если файл не указан, возвращает пустую структуру ConfigFile.
 // Если файл указан, но не может быть прочитан или распарсен, возвращает ошибку.
@@ -9,9 +9,12 @@ import (
 
 // СompressWriter реализует интерфейс http.ResponseWriter и позволяет прозрачно для сервера.
 // Cжимать передаваемые данные и выставлять правильные HTTP-заголовки.
+// Тело сжимается при любом коде состояния, кроме кодов, при которых тела у ответа нет.
 type СompressWriter struct {
-	w  http.ResponseWriter
-	zw *gzip.Writer
+	w           http.ResponseWriter
+	zw          *gzip.Writer
+	wroteHeader bool
+	noBody      bool
 }
 
 // NewСompressWriter создает новый экземпляр СompressWriter.
@@ -29,21 +32,38 @@ func (c *СompressWriter) Header() http.Header {
 }
 
 // Write записывает данные в gzip.Writer и отправляет их в http.ResponseWriter.
+// Если код состояния еще не отправлен, отправляет 200 так же, как http.ResponseWriter.
 // Возвращает количество записанных байт и ошибку, если она произошла.
 func (c *СompressWriter) Write(p []byte) (int, error) {
+	if !c.wroteHeader {
+		c.WriteHeader(http.StatusOK)
+	}
 	return c.zw.Write(p)
 }
 
-// / WriteHeader устанавливает код состояния ответа и добавляет заголовок Content-Encoding.
+// WriteHeader устанавливает код состояния ответа и добавляет заголовок Content-Encoding.
+// Для кодов без тела ответа (1xx, 204, 304) заголовок не добавляется и сжатие отключается.
 func (c *СompressWriter) WriteHeader(statusCode int) {
-	if statusCode < 308 {
+	if c.wroteHeader {
+		c.w.WriteHeader(statusCode)
+		return
+	}
+	c.wroteHeader = true
+	if statusCode < 200 || statusCode == http.StatusNoContent || statusCode == http.StatusNotModified {
+		c.noBody = true
+	} else {
 		c.w.Header().Set("Content-Encoding", "gzip")
+		c.w.Header().Del("Content-Length")
 	}
 	c.w.WriteHeader(statusCode)
 }
 
 // Close закрывает gzip.Writer и досылает все данные из буфера.
+// Для ответа без тела ничего не досылает.
 func (c *СompressWriter) Close() error {
+	if c.noBody {
+		return nil
+	}
 	return c.zw.Close()
 }
 
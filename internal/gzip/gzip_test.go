@@ -6,6 +6,7 @@ import (
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -19,6 +20,7 @@ import (
 func TestGzipCompression(t *testing.T) {
 
 	config := config.New()
+	config.MemoryFile = filepath.Join(t.TempDir(), "memory.log")
 	store, err := storage.New(config)
 	if err != nil {
 		logger.Log.Error("Error created")
@@ -77,7 +79,7 @@ func TestGzipCompression(t *testing.T) {
 		{
 			name:        "accepts_gzip",
 			statusWant:  201,
-			requestBody: `{"url":"https://yandex.ru/"}`,
+			requestBody: `{"url":"https://ya.ru/"}`,
 		},
 	}
 
@@ -103,3 +105,29 @@ func TestGzipCompression(t *testing.T) {
 		})
 	}
 }
+
+func TestGzipRecoverer(t *testing.T) {
+	panics := handlers.Recoverer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	}))
+	srv := httptest.NewServer(GzipMiddleware(panics))
+	defer srv.Close()
+
+	req, err := http.NewRequest(http.MethodPost, srv.URL, bytes.NewBufferString(`{"url":"https://ya.ru/"}`))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept-Encoding", "gzip")
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	// Ответ 500 после паники сжат и помечен заголовком Content-Encoding.
+	require.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+	require.Equal(t, "gzip", resp.Header.Get("Content-Encoding"))
+	require.Equal(t, handlers.ProblemContentType, resp.Header.Get("Content-Type"))
+	zr, err := gzip.NewReader(resp.Body)
+	require.NoError(t, err)
+	body, err := io.ReadAll(zr)
+	require.NoError(t, err)
+	require.Contains(t, string(body), `"status":500`)
+}
@@ -1,8 +1,9 @@
 package handlers
 
 import (
-	"database/sql"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"math"
@@ -10,43 +11,75 @@ import (
 	"net"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/go-chi/chi/v5"
-	_ "github.com/jackc/pgx/v5/stdlib"
 	"go.uber.org/zap"
 
 	"github.com/darkseear/shortener/internal/config"
 	"github.com/darkseear/shortener/internal/logger"
+	"github.com/darkseear/shortener/internal/metrics"
 	"github.com/darkseear/shortener/internal/models"
 	"github.com/darkseear/shortener/internal/services"
 	"github.com/darkseear/shortener/internal/storage"
 )
 
 // Router - структура маршрутизатора.
+// Limiter ограничивает неверные пароли защищенных ссылок, его можно разделить с gRPC сервером.
+// Deletes - очередь асинхронного удаления, если она nil, ссылки удаляются в обработчике запроса.
+// Clicks - запись событий переходов для аналитики, если она nil, переходы не записываются.
+// Health - проверка готовности для /readyz, ее можно разделить с gRPC сервером.
+// RateLimiter - лимиты частоты запросов по пользователю и IP-адресу, если он nil, частота не ограничивается.
+// Proxies - доверенные прокси, только от них принимается адрес клиента в X-Real-IP.
 type Router struct {
-	Handle *chi.Mux
-	Store  storage.Storage
-	Cfg    *config.Config
+	Handle  *chi.Mux
+	Store   storage.Storage
+	Cfg     *config.Config
+	Limiter *services.AttemptLimiter
+	Deletes *storage.DeleteQueue
+	Clicks  *storage.ClickRecorder
+	Health  *storage.Health
+
+	RateLimiter *services.RateLimiter
+	Proxies     services.TrustedProxies
 }
 
+// readyTimeout - максимальное время проверки готовности в /readyz.
+const readyTimeout = 2 * time.Second
+
 // Routers - функция создания маршрутизатора.
 // Принимает конфигурацию и хранилище в качестве аргументов и возвращает указатель на Router.
 func Routers(cfg *config.Config, store storage.Storage) *Router {
 
 	r := Router{
-		Handle: chi.NewRouter(),
-		Store:  store,
-		Cfg:    cfg,
+		Handle:  chi.NewRouter(),
+		Store:   store,
+		Cfg:     cfg,
+		Limiter: services.NewAttemptLimiter(services.PasswordMaxAttempts, services.PasswordAttemptWindow),
+		Health:  storage.NewHealth(store),
 	}
 
-	r.Handle.Post("/", r.AddURL())
-	r.Handle.Get("/{id}", r.GetURL())
-	r.Handle.Post("/api/shorten", r.Shorten())
-	r.Handle.Post("/api/shorten/batch", r.ShortenBatch())
+	r.Handle.Use(metrics.HTTPMiddleware)
+	r.Handle.With(r.RateLimit(services.RateCreate)).Post("/", r.AddURL())
+	r.Handle.With(r.RateLimit(services.RateRedirect)).Get("/{id}", r.GetURL())
+	r.Handle.With(r.RateLimit(services.RateRedirect)).Post("/{id}", r.GetURL())
+	r.Handle.With(r.RateLimit(services.RateCreate)).Post("/api/shorten", r.Shorten())
+	r.Handle.With(r.RateLimit(services.RateCreate)).Post("/api/shorten/batch", r.ShortenBatch())
 	r.Handle.Get("/ping", r.PingDB())
+	r.Handle.Get("/livez", r.Livez())
+	r.Handle.Get("/readyz", r.Readyz())
 	r.Handle.Get("/api/user/urls", r.ListURL())
-	r.Handle.Delete("/api/user/urls", r.DeleteURL())
+	r.Handle.With(r.RateLimit(services.RateDelete)).Delete("/api/user/urls", r.DeleteURL())
+	r.Handle.Post("/api/user/urls/restore", r.RestoreURL())
+	r.Handle.Get("/api/user/urls/{code}/stats", r.LinkStats())
+	r.Handle.Get("/api/user/jobs/{id}", r.DeleteJob())
 	r.Handle.Get("/api/internal/stats", r.Stats())
+	r.Handle.NotFound(func(res http.ResponseWriter, req *http.Request) {
+		WriteProblem(res, req, http.StatusNotFound, "")
+	})
+	r.Handle.MethodNotAllowed(func(res http.ResponseWriter, req *http.Request) {
+		WriteProblem(res, req, http.StatusMethodNotAllowed, "")
+	})
 
 	return &r
 }
@@ -58,8 +91,13 @@ type Handlers interface {
 	Shorten() http.HandlerFunc
 	ShortenBatch() http.HandlerFunc
 	PingDB() http.HandlerFunc
+	Livez() http.HandlerFunc
+	Readyz() http.HandlerFunc
 	ListURL() http.HandlerFunc
 	DeleteURL() http.HandlerFunc
+	DeleteJob() http.HandlerFunc
+	RestoreURL() http.HandlerFunc
+	LinkStats() http.HandlerFunc
 	Stats() http.HandlerFunc
 }
 
@@ -83,38 +121,128 @@ func GenerateRandoUserID() string {
 	return fmt.Sprintf("%d", int(math.Floor(1000+math.Floor(9000*rand.Float64()))))
 }
 
+// shortenStatus - возвращает код ответа для результата сокращения URL.
+// Уже сокращенный URL возвращается с кодом 409, остальные ошибки хранилища - с кодом 500.
+func shortenStatus(err error) int {
+	switch {
+	case err == nil:
+		return http.StatusCreated
+	case errors.Is(err, storage.ErrConflict):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// batchItemJSON - формирует элемент ответа батча из результата хранилища.
+// Текст ошибок хранилища клиенту не передается.
+func batchItemJSON(baseURL string, item models.BatchResult) models.BatchShortenJSON {
+	out := models.BatchShortenJSON{CorrelationID: item.CorrelationID, Status: item.Status}
+	switch item.Status {
+	case models.BatchStatusCreated, models.BatchStatusExisting:
+		out.ShortJSON = baseURL + "/" + item.ShortURL
+	case models.BatchStatusInvalid:
+		out.Error = item.Err.Error()
+	default:
+		out.Error = "failed to shorten url"
+	}
+	return out
+}
+
+// batchStatus - возвращает код ответа для батча.
+// Если у всех элементов один статус, возвращается соответствующий ему код, иначе 207 Multi-Status.
+func batchStatus(results []models.BatchResult) int {
+	codes := map[string]int{
+		models.BatchStatusCreated:  http.StatusCreated,
+		models.BatchStatusExisting: http.StatusConflict,
+		models.BatchStatusInvalid:  http.StatusBadRequest,
+		models.BatchStatusFailed:   http.StatusInternalServerError,
+	}
+	for _, item := range results[1:] {
+		if item.Status != results[0].Status {
+			return http.StatusMultiStatus
+		}
+	}
+	return codes[results[0].Status]
+}
+
+// clientIP - возвращает IP-адрес клиента из адреса соединения или из X-Real-IP, если запрос пришел от доверенного прокси.
+func (r *Router) clientIP(req *http.Request) string {
+	return r.Proxies.ClientIP(req.RemoteAddr, req.Header.Get("X-Real-IP"))
+}
+
+// issueUser - возвращает пользователя из куки auth_token, выдавая новую куку, если ее нет или она недействительна.
+// Если выдать куку не удалось, отвечает ошибкой 500 в формате problem+json и возвращает false.
+func (r *Router) issueUser(res http.ResponseWriter, req *http.Request) (string, bool) {
+	userID, err := services.NewAuthService(r.Cfg.SecretKey).IssueCookie(res, req, GenerateRandoUserID())
+	if err != nil {
+		logger.FromContext(req.Context()).Error("Issue auth cookie error", zap.Error(err))
+		WriteProblem(res, req, http.StatusInternalServerError, "failed to generate token")
+		return "", false
+	}
+	return userID, true
+}
+
+// RateLimit - middleware, ограничивающее частоту запросов операции op по пользователю и IP-адресу клиента.
+// Пользователь берется из куки auth_token без выдачи новой, RateLimiter читается при каждом запросе,
+// поэтому его можно задать после создания маршрутизатора.
+// При превышении лимита отвечает 429 с заголовком Retry-After.
+func (r *Router) RateLimit(op string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			if r.RateLimiter == nil {
+				next.ServeHTTP(res, req)
+				return
+			}
+			keys := []string{services.IPRateKey(r.clientIP(req))}
+			if cookie, err := req.Cookie("auth_token"); err == nil {
+				if userID, err := services.NewAuthService(r.Cfg.SecretKey).ValidateToken(cookie.Value); err == nil {
+					keys = append(keys, services.UserRateKey(userID))
+				}
+			}
+			wait, ok := r.RateLimiter.Allow(op, keys...)
+			if !ok {
+				res.Header().Set("Retry-After", services.RetryAfter(wait))
+				WriteProblem(res, req, http.StatusTooManyRequests, "rate limit exceeded")
+				return
+			}
+			next.ServeHTTP(res, req)
+		})
+	}
+}
+
 // Stats - сбор статистики по количеству user и url.
 func (r *Router) Stats() http.HandlerFunc {
 	return func(res http.ResponseWriter, req *http.Request) {
 		// Проверка trusted_subnet
 		if r.Cfg.TrustedSubnet == "" {
-			res.WriteHeader(http.StatusForbidden)
+			WriteProblem(res, req, http.StatusForbidden, "")
 			return
 		}
 
 		clientIP := req.Header.Get("X-Real-IP")
 		if clientIP == "" {
-			res.WriteHeader(http.StatusForbidden)
+			WriteProblem(res, req, http.StatusForbidden, "")
 			return
 		}
 
 		_, subnet, err := net.ParseCIDR(r.Cfg.TrustedSubnet)
 		if err != nil {
-			res.WriteHeader(http.StatusForbidden)
+			WriteProblem(res, req, http.StatusForbidden, "")
 			return
 		}
 
 		ip := net.ParseIP(clientIP)
 		if ip == nil || !subnet.Contains(ip) {
-			res.WriteHeader(http.StatusForbidden)
+			WriteProblem(res, req, http.StatusForbidden, "")
 			return
 		}
 
 		// Получение статистики
 		stats, err := r.Store.Stats(req.Context())
 		if err != nil {
-			logger.Log.Error("Error getting stats", zap.Error(err))
-			res.WriteHeader(http.StatusInternalServerError)
+			logger.FromContext(req.Context()).Error("Error getting stats", zap.Error(err))
+			WriteProblem(res, req, http.StatusInternalServerError, "")
 			return
 		}
 		if stats.URLs == 0 && stats.Users == 0 {
@@ -123,38 +251,73 @@ func (r *Router) Stats() http.HandlerFunc {
 		}
 		// Запись статистики в ответ
 		if err := WriteJSON(res, http.StatusOK, stats); err != nil {
-			http.Error(res, err.Error(), http.StatusBadRequest)
-			return
+			logger.FromContext(req.Context()).Error("Write response error", zap.Error(err))
 		}
-		logger.Log.Info("Stats requested", zap.Int("URLs", stats.URLs), zap.Int("Users", stats.Users))
-		logger.Log.Info("Client IP", zap.String("IP", clientIP))
+		logger.FromContext(req.Context()).Info("Stats requested", zap.Int("URLs", stats.URLs), zap.Int("Users", stats.Users))
+		logger.FromContext(req.Context()).Info("Client IP", zap.String("IP", clientIP))
 
 	}
 }
 
 // GetURL - функция для обработки HTTP-запросов на получение оригинального URL по короткому идентификатору.
+// Пароль защищенной ссылки передается в заголовке X-Link-Password или формой методом POST.
+// Каждый успешный переход записывается в аналитику без ожидания хранилища.
 func (r *Router) GetURL() http.HandlerFunc {
 	return func(res http.ResponseWriter, req *http.Request) {
-		userID := services.NewAuthService(r.Cfg.SecretKey).IssueCookie(res, req, GenerateRandoUserID())
+		userID, ok := r.issueUser(res, req)
+		if !ok {
+			return
+		}
 		path := strings.TrimSuffix(strings.TrimPrefix(req.URL.Path, "/"), "/")
 		parts := strings.Split(path, "/")
 		paramURLID := parts[0]
 
 		if paramURLID == "" {
-			http.Error(res, "Not found", http.StatusBadRequest)
+			WriteProblem(res, req, http.StatusBadRequest, "short url is empty")
 			return
 		}
 
-		count, err := r.Store.GetOriginalURL(paramURLID, userID)
-		if err == nil && count == "GoneStatus" {
-			res.WriteHeader(http.StatusGone)
+		attemptKey := services.PasswordAttemptKey(paramURLID, r.clientIP(req))
+		if err := r.Limiter.Allow(attemptKey); err != nil {
+			WriteProblem(res, req, http.StatusTooManyRequests, err.Error())
 			return
 		}
-		if err != nil {
-			res.WriteHeader(http.StatusBadRequest)
+
+		password := linkPassword(req)
+		count, err := r.Store.GetOriginalURL(req.Context(), paramURLID, userID, password)
+		switch {
+		case errors.Is(err, storage.ErrWrongPassword):
+			r.Limiter.Fail(attemptKey)
+			writePasswordRequired(res, req, err)
+			return
+		case errors.Is(err, storage.ErrPasswordRequired):
+			writePasswordRequired(res, req, err)
+			return
+		case errors.Is(err, storage.ErrDeleted), errors.Is(err, storage.ErrExpired),
+			errors.Is(err, storage.ErrClicksExhausted):
+			WriteProblem(res, req, http.StatusGone, err.Error())
+			return
+		case errors.Is(err, storage.ErrNotFound):
+			WriteProblem(res, req, http.StatusBadRequest, "")
+			return
+		case err != nil:
+			logger.FromContext(req.Context()).Error("Get url error", zap.Error(err))
+			WriteProblem(res, req, http.StatusInternalServerError, "")
 			return
 		}
 
+		if password != "" {
+			r.Limiter.Reset(attemptKey)
+		}
+		metrics.Redirect("http")
+		if r.Clicks != nil {
+			r.Clicks.Record(services.NewClickEvent(paramURLID, req.Referer(), req.UserAgent(), r.clientIP(req), r.Cfg.SecretKey))
+		}
+		// После отправки формы браузер должен перейти по ссылке методом GET.
+		if req.Method == http.MethodPost {
+			http.Redirect(res, req, count, http.StatusSeeOther)
+			return
+		}
 		http.Redirect(res, req, count, http.StatusTemporaryRedirect)
 
 	}
@@ -163,10 +326,13 @@ func (r *Router) GetURL() http.HandlerFunc {
 // AddURL - функция для обработки HTTP-запросов на добавление нового URL в хранилище.
 func (r *Router) AddURL() http.HandlerFunc {
 	return func(res http.ResponseWriter, req *http.Request) {
-		userID := services.NewAuthService(r.Cfg.SecretKey).IssueCookie(res, req, GenerateRandoUserID())
+		userID, ok := r.issueUser(res, req)
+		if !ok {
+			return
+		}
 		body, err := io.ReadAll(req.Body)
 		if err != nil {
-			http.Error(res, err.Error(), http.StatusBadRequest)
+			WriteProblem(res, req, http.StatusBadRequest, err.Error())
 			return
 		}
 
@@ -174,12 +340,18 @@ func (r *Router) AddURL() http.HandlerFunc {
 
 		strURL := string(body)
 		if strURL == "" {
-			res.WriteHeader(http.StatusBadRequest)
+			WriteProblem(res, req, http.StatusBadRequest, "")
 			return
 		}
 
+		short, err := r.Store.ShortenURL(req.Context(), strURL, userID, models.ShortenOptions{})
+		status := shortenStatus(err)
+		if status == http.StatusInternalServerError {
+			logger.FromContext(req.Context()).Error("Shorten url error", zap.Error(err))
+			WriteProblem(res, req, status, "")
+			return
+		}
 		res.Header().Set("Content-Type", "text/plain")
-		short, status := r.Store.ShortenURL(strURL, userID)
 		res.WriteHeader(status)
 		res.Write([]byte(r.Cfg.URL + "/" + short))
 	}
@@ -189,25 +361,63 @@ func (r *Router) AddURL() http.HandlerFunc {
 func (r *Router) Shorten() http.HandlerFunc {
 	return func(res http.ResponseWriter, req *http.Request) {
 		var longJSON models.LongJSON
-		userID := services.NewAuthService(r.Cfg.SecretKey).IssueCookie(res, req, GenerateRandoUserID())
+		userID, ok := r.issueUser(res, req)
+		if !ok {
+			return
+		}
 
 		if err := ReadJSON(req, &longJSON); err != nil {
-			http.Error(res, err.Error(), http.StatusBadRequest)
+			WriteProblem(res, req, http.StatusBadRequest, err.Error())
 			return
 		}
 
 		longURL := longJSON.URL
 		if longURL == "" {
-			res.WriteHeader(http.StatusBadRequest)
+			WriteProblem(res, req, http.StatusBadRequest, "")
+			return
+		}
+		if longJSON.Alias != "" {
+			if err := services.ValidateAlias(longJSON.Alias); err != nil {
+				WriteProblem(res, req, http.StatusBadRequest, err.Error())
+				return
+			}
+		}
+		expiresAt, err := services.ResolveExpiry(longJSON.TTL, longJSON.ExpiresAt, time.Now())
+		if err != nil {
+			WriteProblem(res, req, http.StatusBadRequest, err.Error())
+			return
+		}
+		if err := services.ValidateMaxClicks(longJSON.MaxClicks); err != nil {
+			WriteProblem(res, req, http.StatusBadRequest, err.Error())
+			return
+		}
+		passwordHash, err := services.HashLinkPassword(longJSON.Password)
+		if err != nil {
+			WriteProblem(res, req, http.StatusBadRequest, err.Error())
 			return
 		}
 
-		shortenURL, status := r.Store.ShortenURL(longURL, userID)
+		opts := models.ShortenOptions{
+			Alias:        longJSON.Alias,
+			ExpiresAt:    expiresAt,
+			MaxClicks:    longJSON.MaxClicks,
+			PasswordHash: passwordHash,
+		}
+		shortenURL, err := r.Store.ShortenURL(req.Context(), longURL, userID, opts)
+		if errors.Is(err, storage.ErrAliasTaken) || errors.Is(err, storage.ErrOptionsConflict) {
+			WriteProblem(res, req, http.StatusConflict, err.Error())
+			return
+		}
+		status := shortenStatus(err)
+		if status == http.StatusInternalServerError {
+			logger.FromContext(req.Context()).Error("Shorten url error", zap.Error(err))
+			WriteProblem(res, req, status, "")
+			return
+		}
 		shortenJSON := models.ShortenJSON{Result: r.Cfg.URL + "/" + shortenURL}
 
 		if err := WriteJSON(res, status, shortenJSON); err != nil {
-			http.Error(res, err.Error(), http.StatusBadRequest)
-			return
+			logger.FromContext(req.Context()).Error("Write response error", zap.Error(err))
 		}
 	}
 }
@@ -215,99 +425,244 @@ func (r *Router) Shorten() http.HandlerFunc {
 // ShortenBatch - функция для обработки HTTP-запросов на пакетное сокращение URL.
 func (r *Router) ShortenBatch() http.HandlerFunc {
 	return func(res http.ResponseWriter, req *http.Request) {
-		userID := services.NewAuthService(r.Cfg.SecretKey).IssueCookie(res, req, GenerateRandoUserID())
+		userID, ok := r.issueUser(res, req)
+		if !ok {
+			return
+		}
 		var batchLongJSON []models.BatchLongJSON
 		if err := ReadJSON(req, &batchLongJSON); err != nil {
-			http.Error(res, err.Error(), http.StatusBadRequest)
+			WriteProblem(res, req, http.StatusBadRequest, err.Error())
 			return
 		}
 
-		var batchShortenJSON []models.BatchShortenJSON
-		for _, item := range batchLongJSON {
-			shortenURL, _ := r.Store.ShortenURL(item.LongJSON, userID)
-			batchShortenJSON = append(batchShortenJSON, models.BatchShortenJSON{
-				CorrelationID: item.CorrelationID,
-				ShortJSON:     r.Cfg.URL + "/" + shortenURL,
-			})
+		if len(batchLongJSON) == 0 {
+			WriteProblem(res, req, http.StatusBadRequest, "empty batch")
+			return
 		}
 
-		if err := WriteJSON(res, http.StatusCreated, batchShortenJSON); err != nil {
-			http.Error(res, err.Error(), http.StatusBadRequest)
-			return
+		results := storage.ShortenBatchItems(req.Context(), r.Store, batchLongJSON, userID)
+		batchShortenJSON := make([]models.BatchShortenJSON, 0, len(results))
+		for _, item := range results {
+			batchShortenJSON = append(batchShortenJSON, batchItemJSON(r.Cfg.URL, item))
+		}
+
+		if err := WriteJSON(res, batchStatus(results), batchShortenJSON); err != nil {
+			logger.FromContext(req.Context()).Error("Write response error", zap.Error(err))
 		}
 	}
 }
 
-// PingDB - функция для проверки доступности базы данных.
+// PingDB - функция для проверки доступности хранилища, используемого сервисом.
 func (r *Router) PingDB() http.HandlerFunc {
 	return func(res http.ResponseWriter, req *http.Request) {
-		db, errSQL := sql.Open("pgx", r.Cfg.DatabaseDSN)
-		if errSQL != nil {
-			logger.Log.Error(errSQL.Error())
-			res.WriteHeader(http.StatusInternalServerError)
+		if err := r.Store.Ping(req.Context()); err != nil {
+			logger.FromContext(req.Context()).Error("Ping storage error", zap.Error(err))
+			WriteProblem(res, req, http.StatusInternalServerError, "")
 			return
 		}
+		res.WriteHeader(http.StatusOK)
+	}
+}
+
+// Livez - функция для проверки, что процесс жив и обрабатывает запросы.
+func (r *Router) Livez() http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		res.Header().Set("Content-Type", "text/plain")
+		res.Write([]byte("ok"))
+	}
+}
 
-		if errPing := db.Ping(); errPing != nil {
-			logger.Log.Error(errPing.Error())
-			res.WriteHeader(http.StatusInternalServerError)
+// Readyz - функция для проверки готовности принимать запросы.
+// Отвечает 503, если хранилище недоступно или сервис останавливается.
+func (r *Router) Readyz() http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		ctx, cancel := context.WithTimeout(req.Context(), readyTimeout)
+		defer cancel()
+		if err := r.Health.Ready(ctx); err != nil {
+			logger.FromContext(req.Context()).Warn("Service is not ready", zap.Error(err))
+			WriteProblem(res, req, http.StatusServiceUnavailable, "service is not ready")
 			return
 		}
-
-		defer db.Close()
-		res.WriteHeader(http.StatusOK)
+		res.Header().Set("Content-Type", "text/plain")
+		res.Write([]byte("ok"))
 	}
 }
 
 // ListURL - функция для обработки HTTP-запросов на получение списка всех URL, добавленных пользователем.
 func (r *Router) ListURL() http.HandlerFunc {
 	return func(res http.ResponseWriter, req *http.Request) {
-		userID := services.NewAuthService(r.Cfg.SecretKey).IssueCookie(res, req, GenerateRandoUserID())
+		userID, ok := r.issueUser(res, req)
+		if !ok {
+			return
+		}
 		if userID == "" {
-			res.WriteHeader(http.StatusUnauthorized)
+			WriteProblem(res, req, http.StatusUnauthorized, "")
 			return
 		}
 
-		urls, err := r.Store.GetOriginalURLByUserID(userID)
+		urls, err := r.Store.GetOriginalURLByUserID(req.Context(), userID)
 		if err != nil {
-			res.WriteHeader(http.StatusInternalServerError)
+			WriteProblem(res, req, http.StatusInternalServerError, "")
 			return
 		}
 		if len(urls) == 0 {
 			res.WriteHeader(http.StatusNoContent)
 			return
 		}
+		for i := range urls {
+			urls[i].ShortURL = r.Cfg.URL + "/" + urls[i].ShortURL
+		}
 		if err := WriteJSON(res, http.StatusOK, urls); err != nil {
-			http.Error(res, err.Error(), http.StatusBadRequest)
-			return
+			logger.FromContext(req.Context()).Error("Write response error", zap.Error(err))
 		}
-		logger.Log.Info("User", zap.String("userID", userID))
+		logger.FromContext(req.Context()).Info("User", zap.String("userID", userID))
 	}
 }
 
 // DeleteURL - функция для обработки HTTP-запросов на удаление URL, добавленных пользователем.
+// Возвращает задачу удаления, состояние которой можно узнать по ее идентификатору.
+// Без очереди удаления ссылки удаляются сразу и задача возвращается завершенной.
 func (r *Router) DeleteURL() http.HandlerFunc {
 	return func(res http.ResponseWriter, req *http.Request) {
-		userID := services.NewAuthService(r.Cfg.SecretKey).IssueCookie(res, req, GenerateRandoUserID())
+		userID, ok := r.issueUser(res, req)
+		if !ok {
+			return
+		}
 		if userID == "" {
-			res.WriteHeader(http.StatusUnauthorized)
+			WriteProblem(res, req, http.StatusUnauthorized, "")
 			return
 		}
 
 		var urlsToDelete []string
 		if err := ReadJSON(req, &urlsToDelete); err != nil {
-			http.Error(res, err.Error(), http.StatusBadRequest)
+			WriteProblem(res, req, http.StatusBadRequest, err.Error())
 			return
 		}
 
-		err := r.Store.DeleteURLByUserID(urlsToDelete, userID)
+		var job models.DeleteJob
+		var err error
+		if r.Deletes != nil {
+			job.Status = models.DeleteJobPending
+			job.ID, err = r.Deletes.Enqueue(req.Context(), userID, urlsToDelete)
+		} else {
+			job, err = storage.DeleteNow(req.Context(), r.Store, userID, urlsToDelete)
+		}
+		if errors.Is(err, storage.ErrQueueClosed) {
+			WriteProblem(res, req, http.StatusServiceUnavailable, "")
+			return
+		}
 		if err != nil {
-			res.WriteHeader(http.StatusInternalServerError)
-			logger.Log.Error("Delete error", zap.Error(err))
+			WriteProblem(res, req, http.StatusInternalServerError, "")
+			logger.FromContext(req.Context()).Error("Delete error", zap.Error(err))
 			return
 		}
 
-		logger.Log.Info("User", zap.String("Delete url is userID:", userID))
-		res.WriteHeader(http.StatusAccepted)
+		logger.FromContext(req.Context()).Info("User", zap.String("Delete url is userID:", userID))
+		if err := WriteJSON(res, http.StatusAccepted, job); err != nil {
+			logger.FromContext(req.Context()).Error("Write delete job error", zap.Error(err))
+		}
+	}
+}
+
+// RestoreURL - функция для обработки HTTP-запросов на восстановление удаленных URL пользователя.
+// Ссылки можно восстановить в течение DeleteGracePeriod после удаления.
+func (r *Router) RestoreURL() http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		userID, ok := r.issueUser(res, req)
+		if !ok {
+			return
+		}
+		if userID == "" {
+			WriteProblem(res, req, http.StatusUnauthorized, "")
+			return
+		}
+
+		var urlsToRestore []string
+		if err := ReadJSON(req, &urlsToRestore); err != nil {
+			WriteProblem(res, req, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		result, err := storage.RestoreURLs(req.Context(), r.Store, userID, urlsToRestore, r.Cfg.DeleteGracePeriod)
+		if err != nil {
+			WriteProblem(res, req, http.StatusInternalServerError, "")
+			logger.FromContext(req.Context()).Error("Restore error", zap.Error(err))
+			return
+		}
+
+		logger.FromContext(req.Context()).Info("User", zap.String("userID", userID), zap.Int("restored", len(result.Restored)))
+		if err := WriteJSON(res, http.StatusOK, result); err != nil {
+			logger.FromContext(req.Context()).Error("Write restore result error", zap.Error(err))
+		}
+	}
+}
+
+// LinkStats - функция для обработки HTTP-запросов на получение статистики переходов по ссылке.
+// Период задается параметрами from и to в RFC3339, размер интервала - параметром bucket (hour или day).
+// Статистика доступна только владельцу ссылки, для остальных ссылка не найдена.
+func (r *Router) LinkStats() http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		userID, ok := r.issueUser(res, req)
+		if !ok {
+			return
+		}
+		if userID == "" {
+			WriteProblem(res, req, http.StatusUnauthorized, "")
+			return
+		}
+
+		params := req.URL.Query()
+		q, err := services.NewLinkStatsQuery(chi.URLParam(req, "code"), userID,
+			params.Get("from"), params.Get("to"), params.Get("bucket"), time.Now())
+		if err != nil {
+			WriteProblem(res, req, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		stats, err := r.Store.LinkStats(req.Context(), q)
+		if errors.Is(err, storage.ErrNotFound) {
+			WriteProblem(res, req, http.StatusNotFound, "")
+			return
+		}
+		if err != nil {
+			logger.FromContext(req.Context()).Error("Link stats error", zap.Error(err))
+			WriteProblem(res, req, http.StatusInternalServerError, "")
+			return
+		}
+		if err := WriteJSON(res, http.StatusOK, stats); err != nil {
+			logger.FromContext(req.Context()).Error("Write link stats error", zap.Error(err))
+		}
+	}
+}
+
+// DeleteJob - функция для обработки HTTP-запросов на получение состояния задачи удаления.
+// Задачи других пользователей не возвращаются.
+func (r *Router) DeleteJob() http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		userID, ok := r.issueUser(res, req)
+		if !ok {
+			return
+		}
+		if userID == "" {
+			WriteProblem(res, req, http.StatusUnauthorized, "")
+			return
+		}
+		if r.Deletes == nil {
+			WriteProblem(res, req, http.StatusNotFound, "")
+			return
+		}
+
+		job, err := r.Deletes.Job(chi.URLParam(req, "id"), userID)
+		if errors.Is(err, storage.ErrJobNotFound) {
+			WriteProblem(res, req, http.StatusNotFound, "")
+			return
+		}
+		if err != nil {
+			WriteProblem(res, req, http.StatusInternalServerError, "")
+			return
+		}
+		if err := WriteJSON(res, http.StatusOK, job); err != nil {
+			logger.FromContext(req.Context()).Error("Write delete job error", zap.Error(err))
+		}
 	}
 }
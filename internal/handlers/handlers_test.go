@@ -1,18 +1,25 @@
 package handlers
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/go-chi/chi/v5"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
-	"go.uber.org/zap"
 
 	"github.com/darkseear/shortener/internal/config"
 	"github.com/darkseear/shortener/internal/logger"
+	"github.com/darkseear/shortener/internal/models"
+	"github.com/darkseear/shortener/internal/services"
 	"github.com/darkseear/shortener/internal/storage"
 )
 
@@ -27,7 +34,7 @@ func TestGetURL(t *testing.T) {
 			Address:     "localhost:8080",
 			URL:         "http://localhost:8080",
 			LogLevel:    "info",
-			MemoryFile:  "memory.log",
+			MemoryFile:  filepath.Join(t.TempDir(), "memory.log"),
 			DatabaseDSN: "",
 		},
 	}
@@ -56,8 +63,8 @@ func TestGetURL(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			r := *Routers(lc.config, store)
-			minURL, status := store.ShortenURL(tt.url, tt.userID)
-			logger.Log.Info("Status", zap.Int("status", status))
+			minURL, err := store.ShortenURL(context.Background(), tt.url, tt.userID, models.ShortenOptions{})
+			require.NoError(t, err)
 			request := httptest.NewRequest(http.MethodGet, tt.request+minURL, nil)
 			w := httptest.NewRecorder()
 			h := logger.WhithLogging(r.GetURL())
@@ -87,7 +94,7 @@ func TestAddURL(t *testing.T) {
 			Address:     "localhost:8080",
 			URL:         "http://localhost:8080",
 			LogLevel:    "info",
-			MemoryFile:  "memory.log",
+			MemoryFile:  filepath.Join(t.TempDir(), "memory.log"),
 			DatabaseDSN: "",
 		},
 	}
@@ -137,3 +144,409 @@ func TestAddURL(t *testing.T) {
 		})
 	}
 }
+
+func TestShortenBatch(t *testing.T) {
+	cfg := &config.Config{
+		Address: "localhost:8080",
+		URL:     "http://localhost:8080",
+	}
+	store, err := storage.New(cfg)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name       string
+		body       string
+		statusWant int
+		itemsWant  []string
+	}{
+		{
+			name:       "batch_test#1",
+			body:       `[{"correlation_id":"1","original_url":"https://yandex.ru"},{"correlation_id":"2","original_url":"https://ya.ru"}]`,
+			statusWant: 201,
+			itemsWant:  []string{"created", "created"},
+		},
+		{
+			name:       "batch_test#2",
+			body:       `[]`,
+			statusWant: 400,
+		},
+		{
+			name:       "batch_test#3",
+			body:       `[{"correlation_id":"1","original_url":"https://practicum.yandex.ru"},{"correlation_id":"2","original_url":"yandex"}]`,
+			statusWant: 207,
+			itemsWant:  []string{"created", "invalid"},
+		},
+		{
+			name:       "batch_test#4",
+			body:       `[{"correlation_id":"1","original_url":""}]`,
+			statusWant: 400,
+			itemsWant:  []string{"invalid"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodPost, "/api/shorten/batch", strings.NewReader(tt.body))
+			w := httptest.NewRecorder()
+			Routers(cfg, store).ShortenBatch()(w, request)
+
+			result := w.Result()
+			defer result.Body.Close()
+			assert.Equal(t, tt.statusWant, result.StatusCode)
+			if len(tt.itemsWant) == 0 {
+				return
+			}
+
+			var items []models.BatchShortenJSON
+			require.NoError(t, json.NewDecoder(result.Body).Decode(&items))
+			require.Len(t, items, len(tt.itemsWant))
+			for i, item := range items {
+				assert.Equal(t, tt.itemsWant[i], item.Status)
+				if item.Status == models.BatchStatusCreated {
+					assert.True(t, strings.HasPrefix(item.ShortJSON, cfg.URL+"/"))
+					assert.Greater(t, len(item.ShortJSON), len(cfg.URL+"/"))
+				} else {
+					assert.Empty(t, item.ShortJSON)
+					assert.NotEmpty(t, item.Error)
+				}
+			}
+		})
+	}
+}
+
+func TestShortenAlias(t *testing.T) {
+	cfg := &config.Config{
+		Address: "localhost:8080",
+		URL:     "http://localhost:8080",
+	}
+	store, err := storage.New(cfg)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name       string
+		body       string
+		statusWant int
+		resultWant string
+	}{
+		{
+			name:       "alias_test#1",
+			body:       `{"url":"https://yandex.ru","alias":"my-link"}`,
+			statusWant: 201,
+			resultWant: "http://localhost:8080/my-link",
+		},
+		{
+			name:       "alias_test#2",
+			body:       `{"url":"https://ya.ru","alias":"my-link"}`,
+			statusWant: 409,
+		},
+		{
+			name:       "alias_test#3",
+			body:       `{"url":"https://ya.ru","alias":"API"}`,
+			statusWant: 400,
+		},
+		{
+			name:       "alias_test#4",
+			body:       `{"url":"https://ya.ru","alias":"my/link"}`,
+			statusWant: 400,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodPost, "/api/shorten", strings.NewReader(tt.body))
+			w := httptest.NewRecorder()
+			Routers(cfg, store).Shorten()(w, request)
+
+			result := w.Result()
+			defer result.Body.Close()
+			assert.Equal(t, tt.statusWant, result.StatusCode)
+			if tt.resultWant == "" {
+				return
+			}
+
+			var shorten models.ShortenJSON
+			require.NoError(t, json.NewDecoder(result.Body).Decode(&shorten))
+			assert.Equal(t, tt.resultWant, shorten.Result)
+		})
+	}
+}
+
+// TestReservedAliases - каждый маршрут сервиса должен быть в списке зарезервированных имен,
+// иначе выбранный пользователем короткий адрес мог бы его перекрыть.
+func TestReservedAliases(t *testing.T) {
+	r := Routers(&config.Config{URL: "http://localhost:8080"}, nil)
+	err := chi.Walk(r.Handle, func(method string, route string, _ http.Handler, _ ...func(http.Handler) http.Handler) error {
+		segment, _, _ := strings.Cut(strings.TrimPrefix(route, "/"), "/")
+		if segment == "" || strings.HasPrefix(segment, "{") {
+			return nil
+		}
+		assert.ErrorIs(t, services.ValidateAlias(segment), services.ErrReservedAlias, "route %s %s", method, route)
+		return nil
+	})
+	require.NoError(t, err)
+}
+
+func TestShortenLimits(t *testing.T) {
+	cfg := &config.Config{
+		Address: "localhost:8080",
+		URL:     "http://localhost:8080",
+	}
+	store, err := storage.New(cfg)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name       string
+		body       string
+		statusWant int
+	}{
+		{
+			name:       "limits_test#1",
+			body:       `{"url":"https://yandex.ru","ttl":60}`,
+			statusWant: 201,
+		},
+		{
+			name:       "limits_test#2",
+			body:       `{"url":"https://yandex.ru","ttl":-1}`,
+			statusWant: 400,
+		},
+		{
+			name:       "limits_test#3",
+			body:       `{"url":"https://yandex.ru","ttl":60,"expires_at":"2100-01-01T00:00:00Z"}`,
+			statusWant: 400,
+		},
+		{
+			name:       "limits_test#4",
+			body:       `{"url":"https://yandex.ru","expires_at":"2000-01-01T00:00:00Z"}`,
+			statusWant: 400,
+		},
+		{
+			name:       "limits_test#5",
+			body:       `{"url":"https://yandex.ru","max_clicks":-1}`,
+			statusWant: 400,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodPost, "/api/shorten", strings.NewReader(tt.body))
+			w := httptest.NewRecorder()
+			Routers(cfg, store).Shorten()(w, request)
+
+			result := w.Result()
+			defer result.Body.Close()
+			assert.Equal(t, tt.statusWant, result.StatusCode)
+		})
+	}
+
+	// Истекшая ссылка и ссылка с исчерпанными переходами отдают 410.
+	short, err := store.ShortenURL(context.Background(), "https://ya.ru", "1",
+		models.ShortenOptions{ExpiresAt: time.Now().Add(-time.Second)})
+	require.NoError(t, err)
+	w := httptest.NewRecorder()
+	Routers(cfg, store).GetURL()(w, httptest.NewRequest(http.MethodGet, "/"+short, nil))
+	assert.Equal(t, http.StatusGone, w.Result().StatusCode)
+
+	short, err = store.ShortenURL(context.Background(), "https://google.com", "1", models.ShortenOptions{MaxClicks: 1})
+	require.NoError(t, err)
+	for _, want := range []int{http.StatusTemporaryRedirect, http.StatusGone} {
+		w = httptest.NewRecorder()
+		Routers(cfg, store).GetURL()(w, httptest.NewRequest(http.MethodGet, "/"+short, nil))
+		assert.Equal(t, want, w.Result().StatusCode)
+	}
+}
+
+func TestGetURLPassword(t *testing.T) {
+	cfg := &config.Config{
+		Address: "localhost:8080",
+		URL:     "http://localhost:8080",
+	}
+	store, err := storage.New(cfg)
+	require.NoError(t, err)
+	r := Routers(cfg, store)
+
+	request := httptest.NewRequest(http.MethodPost, "/api/shorten",
+		strings.NewReader(`{"url":"https://yandex.ru","alias":"secret-doc","password":"secret"}`))
+	w := httptest.NewRecorder()
+	r.Shorten()(w, request)
+	require.Equal(t, http.StatusCreated, w.Result().StatusCode)
+
+	tests := []struct {
+		name       string
+		method     string
+		header     map[string]string
+		body       string
+		statusWant int
+	}{
+		{
+			name:       "password_test#1",
+			method:     http.MethodGet,
+			statusWant: http.StatusUnauthorized,
+		},
+		{
+			name:       "password_test#2",
+			method:     http.MethodGet,
+			header:     map[string]string{PasswordHeader: "secret"},
+			statusWant: http.StatusTemporaryRedirect,
+		},
+		{
+			name:       "password_test#3",
+			method:     http.MethodPost,
+			header:     map[string]string{"Content-Type": "application/x-www-form-urlencoded"},
+			body:       "password=secret",
+			statusWant: http.StatusSeeOther,
+		},
+		{
+			name:       "password_test#4",
+			method:     http.MethodGet,
+			header:     map[string]string{"Accept": "text/html"},
+			statusWant: http.StatusUnauthorized,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := httptest.NewRequest(tt.method, "/secret-doc", strings.NewReader(tt.body))
+			for k, v := range tt.header {
+				request.Header.Set(k, v)
+			}
+			w := httptest.NewRecorder()
+			r.Handle.ServeHTTP(w, request)
+			assert.Equal(t, tt.statusWant, w.Result().StatusCode)
+		})
+	}
+
+	// После исчерпания попыток с адреса даже верный пароль с него отклоняется,
+	// а с других адресов ссылка по-прежнему открывается.
+	for i := 0; i < services.PasswordMaxAttempts; i++ {
+		request := httptest.NewRequest(http.MethodGet, "/secret-doc", nil)
+		request.RemoteAddr = "10.0.0.1:1234"
+		request.Header.Set(PasswordHeader, "wrong")
+		w := httptest.NewRecorder()
+		r.Handle.ServeHTTP(w, request)
+		require.Equal(t, http.StatusUnauthorized, w.Result().StatusCode)
+	}
+	open := func(remoteAddr string) int {
+		request := httptest.NewRequest(http.MethodGet, "/secret-doc", nil)
+		request.RemoteAddr = remoteAddr
+		request.Header.Set(PasswordHeader, "secret")
+		w := httptest.NewRecorder()
+		r.Handle.ServeHTTP(w, request)
+		return w.Result().StatusCode
+	}
+	assert.Equal(t, http.StatusTooManyRequests, open("10.0.0.1:1234"))
+	assert.Equal(t, http.StatusTemporaryRedirect, open("10.0.0.2:1234"))
+}
+
+func TestDeleteJob(t *testing.T) {
+	cfg := &config.Config{
+		Address: "localhost:8080",
+		URL:     "http://localhost:8080",
+	}
+	store, err := storage.New(cfg)
+	require.NoError(t, err)
+	r := Routers(cfg, store)
+	r.Deletes = storage.NewDeleteQueue(store, 10, 1, time.Hour)
+	defer r.Deletes.Close(context.Background())
+
+	request := httptest.NewRequest(http.MethodPost, "/api/shorten",
+		strings.NewReader(`{"url":"https://yandex.ru","alias":"my-link"}`))
+	w := httptest.NewRecorder()
+	r.Handle.ServeHTTP(w, request)
+	require.Equal(t, http.StatusCreated, w.Result().StatusCode)
+	cookies := w.Result().Cookies()
+
+	request = httptest.NewRequest(http.MethodDelete, "/api/user/urls", strings.NewReader(`["my-link","foreign"]`))
+	for _, c := range cookies {
+		request.AddCookie(c)
+	}
+	w = httptest.NewRecorder()
+	r.Handle.ServeHTTP(w, request)
+	require.Equal(t, http.StatusAccepted, w.Result().StatusCode)
+	var job models.DeleteJob
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&job))
+	require.NotEmpty(t, job.ID)
+	assert.Equal(t, models.DeleteJobPending, job.Status)
+
+	get := func(cookies []*http.Cookie) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(http.MethodGet, "/api/user/jobs/"+job.ID, nil)
+		for _, c := range cookies {
+			request.AddCookie(c)
+		}
+		w := httptest.NewRecorder()
+		r.Handle.ServeHTTP(w, request)
+		return w
+	}
+	assert.Eventually(t, func() bool {
+		w := get(cookies)
+		var got models.DeleteJob
+		return w.Code == http.StatusOK && json.NewDecoder(w.Body).Decode(&got) == nil &&
+			got.Status == models.DeleteJobDone && assert.ObjectsAreEqual([]string{"foreign"}, got.NotOwned)
+	}, time.Second, 10*time.Millisecond)
+
+	// Задача другого пользователя не видна.
+	assert.Equal(t, http.StatusNotFound, get(nil).Code)
+}
+
+func TestHealth(t *testing.T) {
+	cfg := &config.Config{URL: "http://localhost:8080"}
+	store, err := storage.New(cfg)
+	require.NoError(t, err)
+	r := Routers(cfg, store)
+
+	get := func(target string) int {
+		w := httptest.NewRecorder()
+		r.Handle.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+		return w.Code
+	}
+	assert.Equal(t, http.StatusOK, get("/ping"))
+	assert.Equal(t, http.StatusOK, get("/livez"))
+	assert.Equal(t, http.StatusOK, get("/readyz"))
+
+	// Во время остановки сервис жив, но не готов.
+	r.Health.Shutdown()
+	assert.Equal(t, http.StatusOK, get("/livez"))
+	assert.Equal(t, http.StatusServiceUnavailable, get("/readyz"))
+}
+
+func TestRateLimit(t *testing.T) {
+	cfg := &config.Config{URL: "http://localhost:8080", SecretKey: "secret"}
+	store, err := storage.New(cfg)
+	require.NoError(t, err)
+	r := Routers(cfg, store)
+	r.RateLimiter = services.NewRateLimiter(map[string]services.RateLimit{
+		services.RateCreate: {Rate: 0.5, Burst: 1},
+	})
+
+	proxies, err := services.ParseTrustedProxies("192.168.0.0/24")
+	require.NoError(t, err)
+	r.Proxies = proxies
+
+	var created int
+	create := func(remoteAddr string, realIP string) *httptest.ResponseRecorder {
+		created++
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(fmt.Sprintf("https://practicum.yandex.ru/%d", created)))
+		req.RemoteAddr = remoteAddr
+		req.Header.Set("X-Real-IP", realIP)
+		w := httptest.NewRecorder()
+		r.Handle.ServeHTTP(w, req)
+		return w
+	}
+	assert.Equal(t, http.StatusCreated, create("10.0.0.1:1234", "").Code)
+
+	// Повторный запрос с того же адреса отклоняется с временем до повтора,
+	// X-Real-IP от недоверенного клиента не сбрасывает лимит.
+	w := create("10.0.0.1:1234", "")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "2", w.Header().Get("Retry-After"))
+	assert.Equal(t, ProblemContentType, w.Header().Get("Content-Type"))
+	assert.Equal(t, http.StatusTooManyRequests, create("10.0.0.1:4321", "10.0.0.2").Code)
+
+	// Другой адрес и операции без лимита не ограничиваются.
+	assert.Equal(t, http.StatusCreated, create("10.0.0.2:1234", "").Code)
+	req := httptest.NewRequest(http.MethodGet, "/missing", nil)
+	req.RemoteAddr = "10.0.0.1:1234"
+	w = httptest.NewRecorder()
+	r.Handle.ServeHTTP(w, req)
+	assert.NotEqual(t, http.StatusTooManyRequests, w.Code)
+
+	// За доверенным прокси лимит считается по X-Real-IP.
+	assert.Equal(t, http.StatusCreated, create("192.168.0.1:1234", "10.0.0.3").Code)
+	assert.Equal(t, http.StatusTooManyRequests, create("192.168.0.1:1234", "10.0.0.3").Code)
+	assert.Equal(t, http.StatusCreated, create("192.168.0.1:1234", "10.0.0.4").Code)
+}
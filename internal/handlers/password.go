@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"errors"
+	"html/template"
+	"net/http"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"github.com/darkseear/shortener/internal/logger"
+	"github.com/darkseear/shortener/internal/storage"
+)
+
+// PasswordHeader - заголовок, в котором передается пароль защищенной ссылки.
+const PasswordHeader = "X-Link-Password"
+
+// passwordForm - форма ввода пароля защищенной ссылки, отправляется на тот же адрес методом POST.
+var passwordForm = template.Must(template.New("password").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Password required</title></head>
+<body>
+<form method="post">
+<p>This link is protected by a password.</p>
+{{if .}}<p>{{.}}</p>{{end}}
+<input type="password" name="password" autofocus required>
+<button type="submit">Open</button>
+</form>
+</body>
+</html>
+`))
+
+// linkPassword - возвращает пароль ссылки из заголовка или из отправленной формы.
+func linkPassword(req *http.Request) string {
+	if password := req.Header.Get(PasswordHeader); password != "" {
+		return password
+	}
+	if req.Method == http.MethodPost {
+		return req.PostFormValue("password")
+	}
+	return ""
+}
+
+// writePasswordRequired - отвечает 401 на переход по защищенной ссылке без верного пароля.
+// Браузеру отдается форма ввода пароля, остальным клиентам - ошибка в формате problem+json.
+func writePasswordRequired(res http.ResponseWriter, req *http.Request, err error) {
+	if !strings.Contains(req.Header.Get("Accept"), "text/html") {
+		WriteProblem(res, req, http.StatusUnauthorized, err.Error())
+		return
+	}
+	var message string
+	if errors.Is(err, storage.ErrWrongPassword) {
+		message = "Wrong password, try again."
+	}
+	res.Header().Set("Content-Type", "text/html; charset=utf-8")
+	res.WriteHeader(http.StatusUnauthorized)
+	if err := passwordForm.Execute(res, message); err != nil {
+		logger.FromContext(req.Context()).Error("Render password form error", zap.Error(err))
+	}
+}
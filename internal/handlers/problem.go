@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"runtime/debug"
+
+	"go.uber.org/zap"
+
+	"github.com/darkseear/shortener/internal/logger"
+	"github.com/darkseear/shortener/internal/models"
+)
+
+// ProblemContentType - тип содержимого ответа с ошибкой по RFC 7807.
+const ProblemContentType = "application/problem+json"
+
+// WriteProblem - отвечает ошибкой status в формате problem+json.
+// detail - пояснение для клиента, пустое для ошибок, текст которых клиенту не передается.
+func WriteProblem(res http.ResponseWriter, req *http.Request, status int, detail string) {
+	problem := models.Problem{
+		Type:      "about:blank",
+		Title:     http.StatusText(status),
+		Status:    status,
+		Detail:    detail,
+		Instance:  req.URL.Path,
+		RequestID: logger.RequestIDFromContext(req.Context()),
+	}
+	res.Header().Set("Content-Type", ProblemContentType)
+	res.Header().Set("X-Content-Type-Options", "nosniff")
+	res.WriteHeader(status)
+	if err := json.NewEncoder(res).Encode(problem); err != nil {
+		logger.FromContext(req.Context()).Error("Write problem error", zap.Error(err))
+	}
+}
+
+// Recoverer - middleware, превращающее панику обработчика в ответ 500 в формате problem+json.
+// Паника записывается в лог со стеком. http.ErrAbortHandler пробрасывается дальше,
+// чтобы сервер прервал ответ без записи в лог.
+func Recoverer(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		defer func() {
+			p := recover()
+			if p == nil {
+				return
+			}
+			if p == http.ErrAbortHandler {
+				panic(p)
+			}
+			logger.FromContext(req.Context()).Error("panic in HTTP handler",
+				zap.String("method", req.Method),
+				zap.String("uri", req.RequestURI),
+				zap.Any("panic", p),
+				zap.ByteString("stack", debug.Stack()),
+			)
+			WriteProblem(res, req, http.StatusInternalServerError, "")
+		}()
+		h.ServeHTTP(res, req)
+	})
+}
@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/darkseear/shortener/internal/config"
+	"github.com/darkseear/shortener/internal/logger"
+	"github.com/darkseear/shortener/internal/models"
+	"github.com/darkseear/shortener/internal/storage"
+)
+
+func TestWriteProblem(t *testing.T) {
+	cfg := &config.Config{URL: "http://localhost:8080"}
+	store, err := storage.New(cfg)
+	require.NoError(t, err)
+	h := logger.WithRequestID(Routers(cfg, store).Handle)
+
+	tests := []struct {
+		name   string
+		method string
+		target string
+		body   string
+		want   int
+		detail string
+	}{
+		{name: "bad json", method: http.MethodPost, target: "/api/shorten", body: "{", want: http.StatusBadRequest, detail: "unexpected EOF"},
+		{name: "unknown route", method: http.MethodGet, target: "/api/unknown/route", want: http.StatusNotFound},
+		{name: "wrong method", method: http.MethodPut, target: "/api/shorten", want: http.StatusMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body))
+			request.Header.Set(logger.RequestIDHeader, "abc-123")
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, request)
+
+			require.Equal(t, tt.want, w.Code)
+			assert.Equal(t, ProblemContentType, w.Header().Get("Content-Type"))
+			var problem models.Problem
+			require.NoError(t, json.NewDecoder(w.Body).Decode(&problem))
+			assert.Equal(t, models.Problem{
+				Type:      "about:blank",
+				Title:     http.StatusText(tt.want),
+				Status:    tt.want,
+				Detail:    tt.detail,
+				Instance:  tt.target,
+				RequestID: "abc-123",
+			}, problem)
+		})
+	}
+}
+
+func TestRecoverer(t *testing.T) {
+	h := Recoverer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	}))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, ProblemContentType, w.Header().Get("Content-Type"))
+
+	// Прерывание ответа пробрасывается серверу.
+	h = Recoverer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic(http.ErrAbortHandler)
+	}))
+	assert.PanicsWithValue(t, http.ErrAbortHandler, func() {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	})
+}
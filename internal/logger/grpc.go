@@ -0,0 +1,88 @@
+package logger
+
+import (
+	"context"
+	"runtime/debug"
+	"time"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ContextStream - grpc.ServerStream с контекстом, замененным перехватчиком.
+type ContextStream struct {
+	grpc.ServerStream
+	Ctx context.Context
+}
+
+// Context - возвращает контекст потока, установленный перехватчиком.
+func (s *ContextStream) Context() context.Context {
+	return s.Ctx
+}
+
+// UnaryLoggingInterceptor - возвращает перехватчик gRPC, записывающий в лог каждый вызов
+// с методом, кодом статуса и длительностью, аналогично WhithLogging для HTTP.
+func UnaryLoggingInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		start := time.Now()
+		resp, err := handler(ctx, req)
+		logCall(ctx, info.FullMethod, start, err)
+		return resp, err
+	}
+}
+
+// StreamLoggingInterceptor - потоковый вариант UnaryLoggingInterceptor.
+func StreamLoggingInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		start := time.Now()
+		err := handler(srv, ss)
+		logCall(ss.Context(), info.FullMethod, start, err)
+		return err
+	}
+}
+
+// logCall - записывает в лог завершенный вызов gRPC.
+func logCall(ctx context.Context, method string, start time.Time, err error) {
+	FromContext(ctx).Info("request gRPC",
+		zap.String("method", method),
+		zap.Duration("duration", time.Since(start)),
+		zap.String("code", status.Code(err).String()),
+	)
+}
+
+// UnaryRecoveryInterceptor - возвращает перехватчик gRPC, превращающий панику обработчика
+// в ошибку codes.Internal. Паника записывается в лог со стеком.
+func UnaryRecoveryInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+		defer func() {
+			if p := recover(); p != nil {
+				err = recovered(ctx, info.FullMethod, p)
+			}
+		}()
+		return handler(ctx, req)
+	}
+}
+
+// StreamRecoveryInterceptor - потоковый вариант UnaryRecoveryInterceptor.
+func StreamRecoveryInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+		defer func() {
+			if p := recover(); p != nil {
+				err = recovered(ss.Context(), info.FullMethod, p)
+			}
+		}()
+		return handler(srv, ss)
+	}
+}
+
+// recovered - записывает в лог панику обработчика и возвращает ошибку для клиента.
+func recovered(ctx context.Context, method string, p interface{}) error {
+	FromContext(ctx).Error("panic in gRPC handler",
+		zap.String("method", method),
+		zap.Any("panic", p),
+		zap.ByteString("stack", debug.Stack()),
+	)
+	return status.Error(codes.Internal, "internal server error")
+}
@@ -81,7 +81,7 @@ func WhithLogging(h http.Handler) http.HandlerFunc {
 		h.ServeHTTP(&lw, r)
 		duration := time.Since(start)
 
-		Log.Info("request HTTP",
+		FromContext(r.Context()).Info("request HTTP",
 			uri,
 			method,
 			zap.Duration("duration", duration),
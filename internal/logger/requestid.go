@@ -0,0 +1,118 @@
+package logger
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// RequestIDHeader - HTTP-заголовок с идентификатором запроса.
+const RequestIDHeader = "X-Request-ID"
+
+// RequestIDMetadataKey - ключ метаданных gRPC с идентификатором запроса.
+const RequestIDMetadataKey = "x-request-id"
+
+// maxRequestIDLength - максимальная длина идентификатора запроса, принимаемого от клиента.
+const maxRequestIDLength = 128
+
+// ctxKey - тип ключей контекста пакета.
+type ctxKey int
+
+const (
+	requestIDKey ctxKey = iota
+	loggerKey
+)
+
+// ContextWithRequestID - возвращает контекст с идентификатором запроса и логгером, добавляющим его в каждую запись.
+func ContextWithRequestID(ctx context.Context, id string) context.Context {
+	ctx = context.WithValue(ctx, requestIDKey, id)
+	return context.WithValue(ctx, loggerKey, Log.With(zap.String("request_id", id)))
+}
+
+// RequestIDFromContext - возвращает идентификатор запроса из контекста или пустую строку.
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+// FromContext - возвращает логгер запроса из контекста.
+// Вне запроса возвращает глобальный Log.
+func FromContext(ctx context.Context) *zap.Logger {
+	if l, ok := ctx.Value(loggerKey).(*zap.Logger); ok {
+		return l
+	}
+	return Log
+}
+
+// WithRequestID - middleware, назначающее запросу идентификатор.
+// Идентификатор берется из заголовка X-Request-ID или создается, возвращается в ответе
+// и попадает в контекст запроса.
+func WithRequestID(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := requestID(r.Header.Get(RequestIDHeader))
+		w.Header().Set(RequestIDHeader, id)
+		h.ServeHTTP(w, r.WithContext(ContextWithRequestID(r.Context(), id)))
+	})
+}
+
+// UnaryRequestIDInterceptor - возвращает перехватчик gRPC, назначающий вызову идентификатор.
+// Идентификатор берется из метаданных x-request-id или создается и возвращается в заголовке ответа.
+func UnaryRequestIDInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		var incoming string
+		if values := metadata.ValueFromIncomingContext(ctx, RequestIDMetadataKey); len(values) > 0 {
+			incoming = values[0]
+		}
+		id := requestID(incoming)
+		if err := grpc.SetHeader(ctx, metadata.Pairs(RequestIDMetadataKey, id)); err != nil {
+			Log.Error("set request id header error", zap.Error(err))
+		}
+		return handler(ContextWithRequestID(ctx, id), req)
+	}
+}
+
+// StreamRequestIDInterceptor - потоковый вариант UnaryRequestIDInterceptor.
+func StreamRequestIDInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		var incoming string
+		if values := metadata.ValueFromIncomingContext(ss.Context(), RequestIDMetadataKey); len(values) > 0 {
+			incoming = values[0]
+		}
+		id := requestID(incoming)
+		if err := ss.SetHeader(metadata.Pairs(RequestIDMetadataKey, id)); err != nil {
+			Log.Error("set request id header error", zap.Error(err))
+		}
+		return handler(srv, &ContextStream{ServerStream: ss, Ctx: ContextWithRequestID(ss.Context(), id)})
+	}
+}
+
+// requestID - возвращает идентификатор клиента, если он допустим, иначе новый случайный.
+// Допустимы непустые строки из печатных символов ASCII длиной до maxRequestIDLength.
+func requestID(id string) string {
+	if validRequestID(id) {
+		return id
+	}
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(b)
+}
+
+// validRequestID - проверяет идентификатор запроса, полученный от клиента.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
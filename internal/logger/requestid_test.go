@@ -0,0 +1,64 @@
+package logger
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestWithRequestID(t *testing.T) {
+	core, logs := observer.New(zap.InfoLevel)
+	prev := Log
+	Log = zap.New(core)
+	defer func() { Log = prev }()
+
+	var got string
+	h := WithRequestID(WhithLogging(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = RequestIDFromContext(r.Context())
+		FromContext(r.Context()).Error("storage error")
+	})))
+
+	// Идентификатор клиента сохраняется и попадает во все записи запроса.
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(RequestIDHeader, "abc-123")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	assert.Equal(t, "abc-123", got)
+	assert.Equal(t, "abc-123", w.Header().Get(RequestIDHeader))
+	require.Equal(t, 2, logs.Len())
+	for _, entry := range logs.TakeAll() {
+		assert.Equal(t, "abc-123", entry.ContextMap()["request_id"])
+	}
+
+	// Недопустимый идентификатор заменяется новым.
+	for _, id := range []string{"", "bad id", strings.Repeat("a", maxRequestIDLength+1)} {
+		req = httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set(RequestIDHeader, id)
+		w = httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		assert.Len(t, got, 32)
+		assert.Equal(t, got, w.Header().Get(RequestIDHeader))
+	}
+
+	assert.Equal(t, Log, FromContext(context.Background()))
+}
+
+func TestUnaryRequestIDInterceptor(t *testing.T) {
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(RequestIDMetadataKey, "abc-123"))
+	var got string
+	_, err := UnaryRequestIDInterceptor()(ctx, nil, &grpc.UnaryServerInfo{}, func(ctx context.Context, req interface{}) (interface{}, error) {
+		got = RequestIDFromContext(ctx)
+		return nil, nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "abc-123", got)
+}
@@ -0,0 +1,188 @@
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+// namespace - общий префикс метрик сервиса.
+const namespace = "shortener"
+
+// Registry - реестр метрик сервиса, отдается обработчиком Handler.
+var Registry = prometheus.NewRegistry()
+
+var (
+	httpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "requests_total",
+		Help:      "HTTP requests by route, method and status.",
+	}, []string{"route", "method", "status"})
+	httpDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "request_duration_seconds",
+		Help:      "HTTP request latency by route, method and status.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "method", "status"})
+	grpcRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "grpc",
+		Name:      "requests_total",
+		Help:      "gRPC requests by method and status code.",
+	}, []string{"method", "code"})
+	grpcDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "grpc",
+		Name:      "request_duration_seconds",
+		Help:      "gRPC request latency by method and status code.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "code"})
+	storageDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "storage",
+		Name:      "operation_duration_seconds",
+		Help:      "Storage operation latency by backend and method.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"backend", "method"})
+	redirects = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "redirects_total",
+		Help:      "Successful redirects to original URLs by transport.",
+	}, []string{"transport"})
+	queueDepth = &queueCollector{
+		desc: prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "queue_depth"),
+			"Number of items waiting in a background queue.", []string{"queue"}, nil),
+		depths: make(map[string]func() int),
+	}
+)
+
+// queueCollector - метрика глубины фоновых очередей, значения читаются из источников при сборе.
+// Регистрируется один раз, источники очередей задаются SetQueue.
+type queueCollector struct {
+	desc   *prometheus.Desc
+	mu     sync.Mutex
+	depths map[string]func() int
+}
+
+// Describe - передает описание метрики глубины очередей.
+func (c *queueCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+// Collect - передает текущую глубину каждой очереди.
+func (c *queueCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for name, depth := range c.depths {
+		ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, float64(depth()), name)
+	}
+}
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		httpRequests, httpDuration,
+		grpcRequests, grpcDuration,
+		storageDuration,
+		redirects,
+		queueDepth,
+	)
+}
+
+// Handler - возвращает обработчик /metrics в текстовом формате Prometheus.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
+
+// HTTPMiddleware - middleware chi для учета количества и длительности HTTP-запросов.
+// Запросы группируются по шаблону маршрута, чтобы коды ссылок не попадали в метки.
+// Запрос учитывается и при панике обработчика: если код еще не отправлен, он считается 500,
+// который вернет Recoverer выше по цепочке.
+func HTTPMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		completed := false
+		defer func() {
+			route := "unmatched"
+			if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+				route = rctx.RoutePattern()
+			}
+			code := ww.Status()
+			switch {
+			case code == 0 && !completed:
+				code = http.StatusInternalServerError
+			case code == 0:
+				code = http.StatusOK
+			}
+			labels := []string{route, r.Method, strconv.Itoa(code)}
+			httpRequests.WithLabelValues(labels...).Inc()
+			httpDuration.WithLabelValues(labels...).Observe(time.Since(start).Seconds())
+		}()
+		next.ServeHTTP(ww, r)
+		completed = true
+	})
+}
+
+// UnaryServerInterceptor - возвращает перехватчик gRPC для учета количества и длительности вызовов.
+func UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		start := time.Now()
+		resp, err := handler(ctx, req)
+		observeCall(info.FullMethod, start, err)
+		return resp, err
+	}
+}
+
+// StreamServerInterceptor - возвращает потоковый перехватчик gRPC для учета количества и длительности вызовов.
+func StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		start := time.Now()
+		err := handler(srv, ss)
+		observeCall(info.FullMethod, start, err)
+		return err
+	}
+}
+
+// observeCall - учитывает завершенный вызов gRPC.
+func observeCall(method string, start time.Time, err error) {
+	labels := []string{method, status.Code(err).String()}
+	grpcRequests.WithLabelValues(labels...).Inc()
+	grpcDuration.WithLabelValues(labels...).Observe(time.Since(start).Seconds())
+}
+
+// ObserveStorage - учитывает длительность операции хранилища, начатой в start.
+func ObserveStorage(backend string, method string, start time.Time) {
+	storageDuration.WithLabelValues(backend, method).Observe(time.Since(start).Seconds())
+}
+
+// Redirect - учитывает успешный переход по короткой ссылке через transport (http или grpc).
+func Redirect(transport string) {
+	redirects.WithLabelValues(transport).Inc()
+}
+
+// SetQueue - задает источник глубины очереди name, значение читается из depth при сборе.
+// Повторный вызов с тем же именем заменяет источник, например, при создании нового приложения в тестах,
+// nil убирает очередь из метрики.
+func SetQueue(name string, depth func() int) {
+	queueDepth.mu.Lock()
+	defer queueDepth.mu.Unlock()
+	if depth == nil {
+		delete(queueDepth.depths, name)
+		return
+	}
+	queueDepth.depths[name] = depth
+}
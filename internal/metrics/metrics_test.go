@@ -0,0 +1,71 @@
+package metrics
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// scrape - возвращает текущие метрики в текстовом формате.
+func scrape(t *testing.T) string {
+	w := httptest.NewRecorder()
+	Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	body, err := io.ReadAll(w.Body)
+	require.NoError(t, err)
+	return string(body)
+}
+
+func TestHTTPMiddleware(t *testing.T) {
+	r := chi.NewRouter()
+	r.Use(HTTPMiddleware)
+	r.Get("/{id}", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "https://yandex.ru", http.StatusTemporaryRedirect)
+	})
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/abc", nil))
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/a/b", nil))
+	r.Get("/panic/{id}", func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	})
+	assert.Panics(t, func() {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/panic/abc", nil))
+	})
+
+	// Код ссылки не попадает в метки, неизвестные маршруты собираются в одну метку.
+	body := scrape(t)
+	assert.Contains(t, body, `shortener_http_requests_total{method="GET",route="/{id}",status="307"} 1`)
+	assert.Contains(t, body, `shortener_http_requests_total{method="GET",route="unmatched",status="404"} 1`)
+	// Запрос с паникой учитывается с кодом, который вернет Recoverer.
+	assert.Contains(t, body, `shortener_http_requests_total{method="GET",route="/panic/{id}",status="500"} 1`)
+	assert.Contains(t, body, `shortener_http_request_duration_seconds_count{method="GET",route="/{id}",status="307"} 1`)
+	assert.Contains(t, body, "go_goroutines")
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	interceptor := UnaryServerInterceptor()
+	info := &grpc.UnaryServerInfo{FullMethod: "/shortener.Sortener/GetURL"}
+	_, err := interceptor(context.Background(), nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, status.Error(codes.NotFound, "url not found")
+	})
+	require.Error(t, err)
+
+	// Повторная регистрация очереди заменяет источник.
+	SetQueue("test", func() int { return 1 })
+	SetQueue("test", func() int { return 3 })
+	SetQueue("removed", func() int { return 5 })
+	SetQueue("removed", nil)
+
+	body := scrape(t)
+	assert.Contains(t, body, `shortener_grpc_requests_total{code="NotFound",method="/shortener.Sortener/GetURL"} 1`)
+	assert.Contains(t, body, `shortener_queue_depth{queue="test"} 3`)
+	assert.NotContains(t, body, `queue="removed"`)
+}
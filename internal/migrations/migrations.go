@@ -0,0 +1,237 @@
+// Package migrations - версионированные миграции схемы базы данных.
+//
+// Скрипты миграций встроены в бинарный файл и называются NNNN_name.up.sql и NNNN_name.down.sql,
+// где NNNN - номер версии схемы. Примененные версии хранятся в таблице schema_version.
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strconv"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"github.com/darkseear/shortener/internal/logger"
+)
+
+//go:embed sql/*.sql
+var files embed.FS
+
+// lockID - ключ advisory-блокировки, под которой применяются миграции.
+// Не дает нескольким репликам, стартующим одновременно, применять миграции параллельно.
+const lockID int64 = 7254187409
+
+// ErrSchemaTooNew - версия схемы в базе данных новее, чем известно приложению.
+var ErrSchemaTooNew = errors.New("database schema is newer than supported")
+
+// Migration - одна миграция схемы со скриптами применения и отката.
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Load - читает встроенные миграции, упорядоченные по версии.
+// Возвращает ошибку, если у миграции нет одного из скриптов или версии идут не подряд.
+func Load() ([]Migration, error) {
+	entries, err := fs.ReadDir(files, "sql")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, e := range entries {
+		name := e.Name()
+		base, direction, ok := strings.Cut(strings.TrimSuffix(name, ".sql"), ".")
+		if !ok || (direction != "up" && direction != "down") {
+			return nil, fmt.Errorf("invalid migration file name %q", name)
+		}
+		num, title, ok := strings.Cut(base, "_")
+		if !ok {
+			return nil, fmt.Errorf("invalid migration file name %q", name)
+		}
+		version, err := strconv.Atoi(num)
+		if err != nil {
+			return nil, fmt.Errorf("invalid migration version %q: %w", name, err)
+		}
+		body, err := files.ReadFile("sql/" + name)
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: title}
+			byVersion[version] = m
+		}
+		if direction == "up" {
+			m.Up = string(body)
+		} else {
+			m.Down = string(body)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migration %d_%s must have up and down scripts", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	for i, m := range migrations {
+		if m.Version != i+1 {
+			return nil, fmt.Errorf("migration versions must be sequential, got %d at position %d", m.Version, i+1)
+		}
+	}
+	return migrations, nil
+}
+
+// Migrator - применяет и откатывает миграции в базе данных.
+type Migrator struct {
+	db         *sql.DB
+	migrations []Migration
+}
+
+// New - конструктор для создания нового Migrator со встроенными миграциями.
+func New(db *sql.DB) (*Migrator, error) {
+	migrations, err := Load()
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{db: db, migrations: migrations}, nil
+}
+
+// Latest - возвращает последнюю версию схемы, известную приложению.
+func (m *Migrator) Latest() int {
+	if len(m.migrations) == 0 {
+		return 0
+	}
+	return m.migrations[len(m.migrations)-1].Version
+}
+
+// Version - возвращает текущую версию схемы в базе данных.
+func (m *Migrator) Version(ctx context.Context) (int, error) {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+	if err := ensureVersionTable(ctx, conn); err != nil {
+		return 0, err
+	}
+	return currentVersion(ctx, conn)
+}
+
+// Up - применяет все неприменённые миграции.
+// Возвращает ErrSchemaTooNew, если схема в базе данных новее последней известной миграции.
+func (m *Migrator) Up(ctx context.Context) error {
+	return m.locked(ctx, func(conn *sql.Conn, current int) error {
+		if current > m.Latest() {
+			return fmt.Errorf("%w: database version %d, supported %d", ErrSchemaTooNew, current, m.Latest())
+		}
+		for _, mg := range m.migrations {
+			if mg.Version <= current {
+				continue
+			}
+			if err := apply(ctx, conn, mg.Up,
+				"INSERT INTO schema_version (version, name) VALUES ($1, $2)", mg.Version, mg.Name); err != nil {
+				return fmt.Errorf("migration %d_%s up: %w", mg.Version, mg.Name, err)
+			}
+			logger.Log.Info("Applied migration", zap.Int("version", mg.Version), zap.String("name", mg.Name))
+		}
+		return nil
+	})
+}
+
+// Down - откатывает миграции с версией больше target в обратном порядке.
+func (m *Migrator) Down(ctx context.Context, target int) error {
+	return m.locked(ctx, func(conn *sql.Conn, current int) error {
+		if current > m.Latest() {
+			return fmt.Errorf("%w: database version %d, supported %d", ErrSchemaTooNew, current, m.Latest())
+		}
+		for i := len(m.migrations) - 1; i >= 0; i-- {
+			mg := m.migrations[i]
+			if mg.Version > current || mg.Version <= target {
+				continue
+			}
+			if err := apply(ctx, conn, mg.Down,
+				"DELETE FROM schema_version WHERE version = $1", mg.Version); err != nil {
+				return fmt.Errorf("migration %d_%s down: %w", mg.Version, mg.Name, err)
+			}
+			logger.Log.Info("Reverted migration", zap.Int("version", mg.Version), zap.String("name", mg.Name))
+		}
+		return nil
+	})
+}
+
+// locked - выполняет fn на отдельном соединении под advisory-блокировкой.
+func (m *Migrator) locked(ctx context.Context, fn func(conn *sql.Conn, current int) error) error {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", lockID); err != nil {
+		return err
+	}
+	defer func() {
+		// Блокировка сессионная, снимаем её даже если контекст уже отменен.
+		if _, err := conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", lockID); err != nil {
+			logger.Log.Error("Error release migration lock", zap.Error(err))
+		}
+	}()
+
+	if err := ensureVersionTable(ctx, conn); err != nil {
+		return err
+	}
+	current, err := currentVersion(ctx, conn)
+	if err != nil {
+		return err
+	}
+	return fn(conn, current)
+}
+
+// apply - выполняет скрипт миграции и обновление schema_version в одной транзакции.
+func apply(ctx context.Context, conn *sql.Conn, script string, versionQuery string, args ...any) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, script); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, versionQuery, args...); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ensureVersionTable - создает таблицу schema_version, если она не существует.
+func ensureVersionTable(ctx context.Context, conn *sql.Conn) error {
+	query := "CREATE TABLE IF NOT EXISTS schema_version (" +
+		"version INTEGER PRIMARY KEY," +
+		"name VARCHAR(255) NOT NULL," +
+		"applied_at TIMESTAMPTZ NOT NULL DEFAULT now());"
+	_, err := conn.ExecContext(ctx, query)
+	return err
+}
+
+// currentVersion - возвращает максимальную примененную версию схемы.
+func currentVersion(ctx context.Context, conn *sql.Conn) (int, error) {
+	var version int
+	err := conn.QueryRowContext(ctx, "SELECT COALESCE(MAX(version), 0) FROM schema_version").Scan(&version)
+	return version, err
+}
@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS urls (
+    id SERIAL PRIMARY KEY,
+    long VARCHAR(255) NOT NULL UNIQUE,
+    shorten VARCHAR(50) NOT NULL UNIQUE,
+    userID VARCHAR(50),
+    is_deleted BOOL DEFAULT false
+);
@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS clicks (
+    id BIGSERIAL PRIMARY KEY,
+    shorten VARCHAR(50) NOT NULL REFERENCES urls (shorten) ON DELETE CASCADE,
+    clicked_at TIMESTAMPTZ NOT NULL,
+    referrer TEXT NOT NULL DEFAULT '',
+    user_agent TEXT NOT NULL DEFAULT '',
+    ip_hash TEXT NOT NULL DEFAULT ''
+);
+CREATE INDEX IF NOT EXISTS clicks_shorten_clicked_at_idx ON clicks (shorten, clicked_at);
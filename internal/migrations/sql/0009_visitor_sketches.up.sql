@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS visitor_sketches (
+    shorten VARCHAR(50) NOT NULL REFERENCES urls (shorten) ON DELETE CASCADE,
+    day DATE NOT NULL,
+    sketch BYTEA NOT NULL,
+    PRIMARY KEY (shorten, day)
+);
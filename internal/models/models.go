@@ -1,31 +1,105 @@
 package models
 
+import "time"
+
 // ShortenJSON - структура для хранения короткой ссылки.
 type ShortenJSON struct {
 	Result string `json:"result"`
 }
 
 // LongJSON - структура для хранения длинной ссылки.
+// Alias - необязательный короткий адрес, выбранный пользователем.
+// TTL - срок жизни ссылки в секундах, ExpiresAt - момент истечения, задается не больше одного из них.
+// MaxClicks - сколько раз можно перейти по ссылке, 0 - без ограничений.
+// Password - пароль, без которого переход по ссылке невозможен.
 type LongJSON struct {
-	URL string `json:"url"`
+	URL       string     `json:"url"`
+	Alias     string     `json:"alias,omitempty"`
+	TTL       int64      `json:"ttl,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	MaxClicks int64      `json:"max_clicks,omitempty"`
+	Password  string     `json:"password,omitempty"`
+}
+
+// ShortenOptions - дополнительные параметры сокращения URL.
+// Alias - короткий адрес, выбранный пользователем, если пуст, адрес генерируется.
+// ExpiresAt - момент истечения ссылки, нулевое значение - ссылка бессрочная.
+// MaxClicks - сколько раз можно перейти по ссылке, 0 - без ограничений.
+// PasswordHash - bcrypt-хеш пароля ссылки, пустой для ссылки без пароля.
+type ShortenOptions struct {
+	Alias        string
+	ExpiresAt    time.Time
+	MaxClicks    int64
+	PasswordHash string
+}
+
+// IsZero - проверяет, что параметры сокращения не заданы.
+func (o ShortenOptions) IsZero() bool {
+	return o == ShortenOptions{}
 }
 
-// MemoryFile - структура для хранения короткой и длинной ссылки в памяти.
+// Операции журнала файлового хранилища.
+// Записи без операции, как и в старых файлах, считаются созданием ссылки.
+const (
+	OpCreate  = ""
+	OpDelete  = "delete"
+	OpClick   = "click"   // переход по ссылке с ограничением числа переходов
+	OpRestore = "restore" // восстановление удаленной ссылки
+	OpPurge   = "purge"   // окончательное удаление, после которого адрес свободен
+)
+
+// MemoryFile - структура записи журнала файлового хранилища.
+// Хранит короткую и длинную ссылку, владельца и операцию над ссылкой.
+// Clicks заполняется только при сжатии журнала, чтобы не потерять уже сделанные переходы.
+// DeletedAt - момент удаления, задается в записи об удалении и для удаленных ссылок при сжатии.
 type MemoryFile struct {
-	ShortURL string `json:"shortURL"`
-	LongURL  string `json:"longURL"`
+	ShortURL     string     `json:"shortURL"`
+	LongURL      string     `json:"longURL,omitempty"`
+	UserID       string     `json:"userID,omitempty"`
+	ExpiresAt    *time.Time `json:"expiresAt,omitempty"`
+	MaxClicks    int64      `json:"maxClicks,omitempty"`
+	Clicks       int64      `json:"clicks,omitempty"`
+	PasswordHash string     `json:"passwordHash,omitempty"`
+	DeletedAt    *time.Time `json:"deletedAt,omitempty"`
+	Alias        bool       `json:"alias,omitempty"`
+	Op           string     `json:"op,omitempty"`
 }
 
 // BatchLongJSON - структура для хранения длинной ссылки в батче.
+// TTL и ExpiresAt задают срок жизни ссылки, как в LongJSON.
+// Перед передачей в хранилище TTL переводится в ExpiresAt.
 type BatchLongJSON struct {
-	CorrelationID string `json:"correlation_id"`
-	LongJSON      string `json:"original_url"`
+	CorrelationID string     `json:"correlation_id"`
+	LongJSON      string     `json:"original_url"`
+	TTL           int64      `json:"ttl,omitempty"`
+	ExpiresAt     *time.Time `json:"expires_at,omitempty"`
 }
 
+// Статусы элементов батча сокращения.
+const (
+	BatchStatusCreated  = "created"  // ссылка создана
+	BatchStatusExisting = "existing" // URL уже был сокращен, возвращена существующая ссылка
+	BatchStatusInvalid  = "invalid"  // URL не прошел проверку
+	BatchStatusFailed   = "failed"   // ошибка хранилища
+)
+
 // BatchShortenJSON - структура для хранения короткой ссылки в батче.
+// Status - один из BatchStatus*, Error - описание ошибки для invalid и failed.
 type BatchShortenJSON struct {
 	CorrelationID string `json:"correlation_id"`
-	ShortJSON     string `json:"short_url"`
+	ShortJSON     string `json:"short_url,omitempty"`
+	Status        string `json:"status"`
+	Error         string `json:"error,omitempty"`
+}
+
+// BatchResult - результат сокращения одного URL из батча в хранилище.
+// Err равен ErrConflict, если URL уже был сокращен, тогда ShortURL - существующий короткий адрес.
+// Status заполняется по Err при формировании ответа клиенту.
+type BatchResult struct {
+	CorrelationID string
+	ShortURL      string
+	Status        string
+	Err           error
 }
 
 // URLPair - структура для хранения короткой и длинной ссылки.
@@ -35,6 +109,133 @@ type URLPair struct {
 	LongURL  string `json:"original_url"`
 }
 
+// DeleteRequest - запрос пользователя на удаление его коротких ссылок.
+// Ссылки, которые пользователю не принадлежат, пропускаются.
+// JobID - идентификатор задачи удаления, по которому клиент узнает результат.
+type DeleteRequest struct {
+	JobID  string
+	UserID string
+	Codes  []string
+}
+
+// DeleteResult - результат удаления ссылок одного запроса в хранилище.
+// NotOwned - ссылки из запроса, которые не существуют или принадлежат другому пользователю.
+type DeleteResult struct {
+	NotOwned []string
+}
+
+// Статусы задачи удаления.
+const (
+	DeleteJobPending = "pending"
+	DeleteJobDone    = "done"
+	DeleteJobFailed  = "failed"
+)
+
+// DeleteJob - состояние задачи удаления ссылок.
+// Status - один из DeleteJob*, NotOwned заполняется после удаления, Error - для failed.
+type DeleteJob struct {
+	ID       string   `json:"id,omitempty"`
+	Status   string   `json:"status"`
+	NotOwned []string `json:"not_owned,omitempty"`
+	Error    string   `json:"error,omitempty"`
+}
+
+// RestoreResult - результат восстановления удаленных ссылок пользователя.
+// NotRestored - ссылки, которые не удалены, чужие, истекли или удалены раньше окна восстановления.
+type RestoreResult struct {
+	Restored    []string `json:"restored"`
+	NotRestored []string `json:"not_restored,omitempty"`
+}
+
+// ClickEvent - переход по короткой ссылке для аналитики.
+// IPHash - хеш IP-адреса клиента, сам адрес не хранится.
+type ClickEvent struct {
+	ShortURL  string    `json:"shortURL"`
+	At        time.Time `json:"at"`
+	Referrer  string    `json:"referrer,omitempty"`
+	UserAgent string    `json:"userAgent,omitempty"`
+	IPHash    string    `json:"ipHash,omitempty"`
+}
+
+// ClickAggregate - прирост переходов по ссылке за час в UTC для файла переходов:
+// количество переходов и их число по источникам и браузерам.
+// Записи одной ссылки и часа складываются, Op OpPurge отмечает окончательное удаление ссылки,
+// после которого записи о ней до этой строки отбрасываются.
+type ClickAggregate struct {
+	ShortURL   string           `json:"shortURL"`
+	Hour       time.Time        `json:"hour"`
+	Clicks     int64            `json:"clicks,omitempty"`
+	Referrers  map[string]int64 `json:"referrers,omitempty"`
+	UserAgents map[string]int64 `json:"userAgents,omitempty"`
+	Op         string           `json:"op,omitempty"`
+}
+
+// VisitorSketch - сериализованный скетч уникальных посетителей ссылки за сутки в UTC.
+// Скетчи одной ссылки и суток объединяются, поэтому в файл дописывается только прирост.
+// Op OpPurge отмечает окончательное удаление ссылки так же, как в ClickAggregate.
+type VisitorSketch struct {
+	ShortURL string    `json:"shortURL"`
+	Day      time.Time `json:"day"`
+	Sketch   []byte    `json:"sketch,omitempty"`
+	Op       string    `json:"op,omitempty"`
+}
+
+// Размеры интервалов в статистике переходов по ссылке.
+const (
+	StatsBucketHour = "hour"
+	StatsBucketDay  = "day"
+)
+
+// LinkStatsQuery - запрос статистики переходов по ссылке за период [From, To).
+// UserID - пользователь, запросивший статистику, она доступна только владельцу ссылки.
+// Top - сколько самых частых источников и браузеров вернуть.
+type LinkStatsQuery struct {
+	ShortURL string
+	UserID   string
+	From     time.Time
+	To       time.Time
+	Bucket   string
+	Top      int
+}
+
+// ClickBucket - количество переходов за интервал, начинающийся в Start.
+type ClickBucket struct {
+	Start  time.Time `json:"start"`
+	Clicks int64     `json:"clicks"`
+}
+
+// CountItem - значение и количество переходов с ним, например источник перехода.
+type CountItem struct {
+	Value string `json:"value"`
+	Count int64  `json:"count"`
+}
+
+// Problem - описание ошибки HTTP API в формате RFC 7807 (application/problem+json).
+// RequestID - идентификатор запроса для поиска записей в логе.
+type Problem struct {
+	Type      string `json:"type"`
+	Title     string `json:"title"`
+	Status    int    `json:"status"`
+	Detail    string `json:"detail,omitempty"`
+	Instance  string `json:"instance,omitempty"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// LinkStats - статистика переходов по ссылке за период.
+// Series содержит все интервалы периода, включая интервалы без переходов.
+// UniqueVisitors - приблизительная оценка по целым суткам в UTC, покрывающим период.
+type LinkStats struct {
+	ShortURL       string        `json:"short_url"`
+	From           time.Time     `json:"from"`
+	To             time.Time     `json:"to"`
+	Bucket         string        `json:"bucket"`
+	TotalClicks    int64         `json:"total_clicks"`
+	UniqueVisitors int64         `json:"unique_visitors"`
+	Series         []ClickBucket `json:"series"`
+	TopReferrers   []CountItem   `json:"top_referrers"`
+	TopUserAgents  []CountItem   `json:"top_user_agents"`
+}
+
 // URLPairBatch - структура для хранения флага удвления, номера пользователя, короткой и длинной ссылки в батче для бд.
 type DBUrlShorten struct {
 	ShortURL    string `json:"short_url"`
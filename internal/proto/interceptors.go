@@ -0,0 +1,46 @@
+package proto
+
+import (
+	"google.golang.org/grpc"
+
+	"github.com/darkseear/shortener/internal/logger"
+	"github.com/darkseear/shortener/internal/metrics"
+	"github.com/darkseear/shortener/internal/services"
+)
+
+// rateLimitedMethods - операции лимитов частоты запросов для методов gRPC.
+var rateLimitedMethods = map[string]string{
+	Sortener_AddURL_FullMethodName:       services.RateCreate,
+	Sortener_Shorten_FullMethodName:      services.RateCreate,
+	Sortener_ShortenBatch_FullMethodName: services.RateCreate,
+	Sortener_GetURL_FullMethodName:       services.RateRedirect,
+	Sortener_DeleteURL_FullMethodName:    services.RateDelete,
+}
+
+// ServerOptions - возвращает цепочки перехватчиков gRPC сервера для обычных и потоковых вызовов.
+// Порядок: идентификатор запроса, журнал, метрики, восстановление после паники, авторизация, лимиты частоты.
+// Журнал и метрики видят итоговый код статуса, в том числе после паники.
+// limiter можно разделить с HTTP сервером, если он nil, частота вызовов не ограничивается.
+// proxies - доверенные прокси, чьим метаданным client_ip лимиты верят при определении IP клиента.
+func ServerOptions(auth *services.AuthService, limiter *services.RateLimiter, proxies services.TrustedProxies) []grpc.ServerOption {
+	unary := []grpc.UnaryServerInterceptor{
+		logger.UnaryRequestIDInterceptor(),
+		logger.UnaryLoggingInterceptor(),
+		metrics.UnaryServerInterceptor(),
+		logger.UnaryRecoveryInterceptor(),
+		auth.UnaryAuthInterceptor(),
+	}
+	if limiter != nil {
+		unary = append(unary, limiter.UnaryRateLimitInterceptor(rateLimitedMethods, proxies))
+	}
+	return []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(unary...),
+		grpc.ChainStreamInterceptor(
+			logger.StreamRequestIDInterceptor(),
+			logger.StreamLoggingInterceptor(),
+			metrics.StreamServerInterceptor(),
+			logger.StreamRecoveryInterceptor(),
+			auth.StreamAuthInterceptor(),
+		),
+	}
+}
@@ -0,0 +1,117 @@
+package proto
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/reflection"
+	reflectionpb "google.golang.org/grpc/reflection/grpc_reflection_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/darkseear/shortener/internal/config"
+	"github.com/darkseear/shortener/internal/logger"
+	"github.com/darkseear/shortener/internal/services"
+	"github.com/darkseear/shortener/internal/storage"
+)
+
+func TestServerOptions(t *testing.T) {
+	cfg := &config.Config{URL: "http://localhost:8080", SecretKey: "secret"}
+	store, err := storage.New(cfg)
+	require.NoError(t, err)
+
+	lis := bufconn.Listen(1 << 20)
+	srv := grpc.NewServer(ServerOptions(services.NewAuthService(cfg.SecretKey), nil, nil)...)
+	RegisterSortenerServer(srv, NewGRPCShortenerServer(store, cfg))
+	healthpb.RegisterHealthServer(srv, health.NewServer())
+	reflection.Register(srv)
+	go srv.Serve(lis)
+	defer srv.Stop()
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	defer conn.Close()
+	client := NewSortenerClient(conn)
+
+	// Код статуса обработчика доходит до клиента, заголовки авторизации и идентификатора запроса отправляются.
+	ctx := metadata.AppendToOutgoingContext(context.Background(), logger.RequestIDMetadataKey, "abc-123")
+	var header metadata.MD
+	_, err = client.GetURL(ctx, &GetURLRequest{ShortUrl: "missing"}, grpc.Header(&header))
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	assert.Equal(t, []string{"abc-123"}, header.Get(logger.RequestIDMetadataKey))
+	assert.NotEmpty(t, header.Get("auth_token"))
+
+	_, err = client.GetURL(ctx, &GetURLRequest{})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	ping, err := client.PingDB(ctx, &PingDBRequest{})
+	require.NoError(t, err)
+	assert.True(t, ping.GetOk())
+
+	// Reflection работает через потоковую цепочку перехватчиков и видит все сервисы.
+	stream, err := reflectionpb.NewServerReflectionClient(conn).ServerReflectionInfo(context.Background())
+	require.NoError(t, err)
+	require.NoError(t, stream.Send(&reflectionpb.ServerReflectionRequest{
+		MessageRequest: &reflectionpb.ServerReflectionRequest_ListServices{},
+	}))
+	resp, err := stream.Recv()
+	require.NoError(t, err)
+	var names []string
+	for _, svc := range resp.GetListServicesResponse().GetService() {
+		names = append(names, svc.GetName())
+	}
+	assert.Contains(t, names, Sortener_ServiceDesc.ServiceName)
+	assert.Contains(t, names, healthpb.Health_ServiceDesc.ServiceName)
+}
+
+func TestServerOptionsRateLimit(t *testing.T) {
+	cfg := &config.Config{URL: "http://localhost:8080", SecretKey: "secret"}
+	store, err := storage.New(cfg)
+	require.NoError(t, err)
+
+	limiter := services.NewRateLimiter(map[string]services.RateLimit{
+		services.RateRedirect: {Rate: 0.5, Burst: 1},
+	})
+	lis := bufconn.Listen(1 << 20)
+	srv := grpc.NewServer(ServerOptions(services.NewAuthService(cfg.SecretKey), limiter, nil)...)
+	RegisterSortenerServer(srv, NewGRPCShortenerServer(store, cfg))
+	go srv.Serve(lis)
+	defer srv.Stop()
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	defer conn.Close()
+	client := NewSortenerClient(conn)
+
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "client_ip", "10.0.0.1")
+	_, err = client.GetURL(ctx, &GetURLRequest{ShortUrl: "missing"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	// Превышение лимита возвращает ResourceExhausted и время до повтора.
+	var header metadata.MD
+	_, err = client.GetURL(ctx, &GetURLRequest{ShortUrl: "missing"}, grpc.Header(&header))
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+	assert.Equal(t, []string{"2"}, header.Get(services.RetryAfterMetadataKey))
+
+	// client_ip от недоверенного клиента не сбрасывает лимит.
+	spoofed := metadata.AppendToOutgoingContext(context.Background(), "client_ip", "10.0.0.2")
+	_, err = client.GetURL(spoofed, &GetURLRequest{ShortUrl: "missing"})
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+
+	// Методы без лимита не ограничиваются.
+	_, err = client.PingDB(ctx, &PingDBRequest{})
+	assert.NoError(t, err)
+}
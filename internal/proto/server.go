@@ -2,39 +2,81 @@ package proto
 
 import (
 	"context"
-	"database/sql"
+	"errors"
+	"fmt"
 	"net"
+	"time"
 
 	"github.com/darkseear/shortener/internal/config"
 	"github.com/darkseear/shortener/internal/logger"
+	"github.com/darkseear/shortener/internal/metrics"
+	"github.com/darkseear/shortener/internal/models"
 	"github.com/darkseear/shortener/internal/services"
 	"github.com/darkseear/shortener/internal/storage"
 	"go.uber.org/zap"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
 )
 
 // GRPCShortenerServer - структура, представляющая gRPC сервер для сокращения URL.
+// Limiter ограничивает неверные пароли защищенных ссылок, его можно разделить с HTTP сервером.
+// Deletes - очередь асинхронного удаления, если она nil, ссылки удаляются в обработчике запроса.
+// Clicks - запись событий переходов для аналитики, если она nil, переходы не записываются.
 type GRPCShortenerServer struct {
 	UnimplementedSortenerServer
-	Store storage.Storage
-	Cfg   *config.Config
+	Store   storage.Storage
+	Cfg     *config.Config
+	Limiter *services.AttemptLimiter
+	Deletes *storage.DeleteQueue
+	Clicks  *storage.ClickRecorder
+	// Proxies - доверенные прокси, которым разрешено передавать IP клиента в метаданных client_ip.
+	Proxies services.TrustedProxies
 }
 
 // NewGRPCShortenerServer - конструктор для создания нового gRPC сервера.
 func NewGRPCShortenerServer(store storage.Storage, cfg *config.Config) *GRPCShortenerServer {
 	return &GRPCShortenerServer{
-		Store: store,
-		Cfg:   cfg,
+		Store:   store,
+		Cfg:     cfg,
+		Limiter: services.NewAttemptLimiter(services.PasswordMaxAttempts, services.PasswordAttemptWindow),
 	}
 }
 
+// shortenError - возвращает gRPC ошибку для результата сокращения URL.
+// Для уже сокращенного URL в сообщение добавляется существующий короткий адрес.
+func shortenError(ctx context.Context, err error, shortURL string) error {
+	if errors.Is(err, storage.ErrConflict) {
+		return status.Errorf(codes.AlreadyExists, "url already shortened: %s", shortURL)
+	}
+	if errors.Is(err, storage.ErrAliasTaken) {
+		return status.Error(codes.AlreadyExists, "alias already taken")
+	}
+	if errors.Is(err, storage.ErrOptionsConflict) {
+		return status.Error(codes.AlreadyExists, err.Error())
+	}
+	logger.FromContext(ctx).Error("Shorten url error", zap.Error(err))
+	return status.Error(codes.Internal, "failed to shorten URL")
+}
+
+// parseExpiresAt - разбирает момент истечения ссылки в формате RFC 3339, пустая строка - не задан.
+func parseExpiresAt(value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", services.ErrInvalidExpiry, err)
+	}
+	return &t, nil
+}
+
 // AddURL - метод для добавления нового URL в систему.
 func (s *GRPCShortenerServer) AddURL(ctx context.Context, req *AddURLRequest) (*AddURLResponse, error) {
 
 	userID, err := services.GetUserIDFromMetadata(ctx)
 	if err != nil || userID == "" {
-		logger.Log.Error("failed to control user ID", zap.Error(err))
+		logger.FromContext(ctx).Error("failed to control user ID", zap.Error(err))
 		return nil, status.Error(codes.Unauthenticated, "user ID is not provided")
 	}
 
@@ -42,9 +84,9 @@ func (s *GRPCShortenerServer) AddURL(ctx context.Context, req *AddURLRequest) (*
 		return nil, status.Error(codes.InvalidArgument, "Empty url")
 	}
 
-	short, storeStatus := s.Store.ShortenURL(req.Url, userID)
-	if storeStatus != 201 && storeStatus != 200 {
-		return nil, status.Error(codes.Internal, "failed to shorten URL")
+	short, err := s.Store.ShortenURL(ctx, req.Url, userID, models.ShortenOptions{})
+	if err != nil {
+		return nil, shortenError(ctx, err, s.Cfg.URL+"/"+short)
 	}
 
 	return &AddURLResponse{
@@ -53,10 +95,12 @@ func (s *GRPCShortenerServer) AddURL(ctx context.Context, req *AddURLRequest) (*
 }
 
 // GetURL - метод для получения оригинального URL по короткому.
+// Пароль защищенной ссылки передается в метаданных link_password.
+// Успешное получение URL записывается в аналитику как переход.
 func (s *GRPCShortenerServer) GetURL(ctx context.Context, req *GetURLRequest) (*GetURLResponse, error) {
 	userID, err := services.GetUserIDFromMetadata(ctx)
 	if err != nil || userID == "" {
-		logger.Log.Error("failed to control user ID", zap.Error(err))
+		logger.FromContext(ctx).Error("failed to control user ID", zap.Error(err))
 		return nil, status.Error(codes.Unauthenticated, "user ID is not provided")
 	}
 
@@ -65,24 +109,50 @@ func (s *GRPCShortenerServer) GetURL(ctx context.Context, req *GetURLRequest) (*
 		return nil, status.Error(codes.InvalidArgument, "short url is empty")
 	}
 
-	originalURL, err := s.Store.GetOriginalURL(paramURLID, userID)
-	if err == nil && originalURL == "GoneStatus" {
-		return nil, status.Error(codes.NotFound, "url is deleted")
+	attemptKey := services.PasswordAttemptKey(paramURLID, services.PeerIP(ctx, s.Proxies))
+	if err := s.Limiter.Allow(attemptKey); err != nil {
+		return nil, status.Error(codes.ResourceExhausted, err.Error())
 	}
-	if err != nil {
+
+	password := services.GetLinkPasswordFromMetadata(ctx)
+	originalURL, err := s.Store.GetOriginalURL(ctx, paramURLID, userID, password)
+	switch {
+	case errors.Is(err, storage.ErrWrongPassword):
+		s.Limiter.Fail(attemptKey)
+		return nil, status.Error(codes.PermissionDenied, "wrong password")
+	case errors.Is(err, storage.ErrPasswordRequired):
+		return nil, status.Error(codes.PermissionDenied, "password required")
+	case errors.Is(err, storage.ErrDeleted):
+		return nil, status.Error(codes.NotFound, "url is deleted")
+	case errors.Is(err, storage.ErrExpired):
+		return nil, status.Error(codes.NotFound, "url is expired")
+	case errors.Is(err, storage.ErrClicksExhausted):
+		return nil, status.Error(codes.NotFound, "url click limit reached")
+	case errors.Is(err, storage.ErrNotFound):
 		return nil, status.Error(codes.NotFound, "url not found")
+	case err != nil:
+		logger.FromContext(ctx).Error("Get url error", zap.Error(err))
+		return nil, status.Error(codes.Internal, "failed to get url")
 	}
 
+	if password != "" {
+		s.Limiter.Reset(attemptKey)
+	}
+	metrics.Redirect("grpc")
+	if s.Clicks != nil {
+		s.Clicks.Record(clickEvent(ctx, paramURLID, s.Cfg.SecretKey, s.Proxies))
+	}
 	return &GetURLResponse{
 		OriginalUrl: originalURL,
 	}, nil
 }
 
 // DeleteURL - метод для удаления URL по короткому идентификатору.
+// Возвращает задачу удаления, состояние которой можно узнать методом GetDeleteJob.
 func (s *GRPCShortenerServer) DeleteURL(ctx context.Context, req *DeleteURLRequest) (*DeleteURLResponse, error) {
 	userID, err := services.GetUserIDFromMetadata(ctx)
 	if err != nil || userID == "" {
-		logger.Log.Error("failed to control user ID", zap.Error(err))
+		logger.FromContext(ctx).Error("failed to control user ID", zap.Error(err))
 		return nil, status.Error(codes.Unauthenticated, "user ID is not provided")
 	}
 
@@ -90,27 +160,143 @@ func (s *GRPCShortenerServer) DeleteURL(ctx context.Context, req *DeleteURLReque
 		return nil, status.Error(codes.InvalidArgument, "no urls provided")
 	}
 
-	err = s.Store.DeleteURLByUserID(req.ShortUrls, userID)
+	var job models.DeleteJob
+	if s.Deletes != nil {
+		job.Status = models.DeleteJobPending
+		job.ID, err = s.Deletes.Enqueue(ctx, userID, req.ShortUrls)
+	} else {
+		job, err = storage.DeleteNow(ctx, s.Store, userID, req.ShortUrls)
+	}
+	if errors.Is(err, storage.ErrQueueClosed) {
+		return nil, status.Error(codes.Unavailable, "server is shutting down")
+	}
 	if err != nil {
-		logger.Log.Error("Delete error", zap.Error(err))
+		logger.FromContext(ctx).Error("Delete error", zap.Error(err))
 		return nil, status.Error(codes.Internal, "failed to delete urls")
 	}
 
-	logger.Log.Info("User", zap.String("Delete url is userID:", userID))
-	return &DeleteURLResponse{Success: true}, nil
+	logger.FromContext(ctx).Info("User", zap.String("Delete url is userID:", userID))
+	return &DeleteURLResponse{Success: true, Job: deleteJob(job)}, nil
+}
+
+// GetDeleteJob - метод для получения состояния задачи удаления пользователя.
+func (s *GRPCShortenerServer) GetDeleteJob(ctx context.Context, req *GetDeleteJobRequest) (*DeleteJob, error) {
+	userID, err := services.GetUserIDFromMetadata(ctx)
+	if err != nil || userID == "" {
+		logger.FromContext(ctx).Error("failed to control user ID", zap.Error(err))
+		return nil, status.Error(codes.Unauthenticated, "user ID is not provided")
+	}
+	if s.Deletes == nil {
+		return nil, status.Error(codes.NotFound, "delete job not found")
+	}
+
+	job, err := s.Deletes.Job(req.GetId(), userID)
+	if errors.Is(err, storage.ErrJobNotFound) {
+		return nil, status.Error(codes.NotFound, "delete job not found")
+	}
+	if err != nil {
+		return nil, status.Error(codes.Internal, "failed to get delete job")
+	}
+	return deleteJob(job), nil
+}
+
+// RestoreURL - метод для восстановления удаленных URL пользователя.
+func (s *GRPCShortenerServer) RestoreURL(ctx context.Context, req *RestoreURLRequest) (*RestoreURLResponse, error) {
+	userID, err := services.GetUserIDFromMetadata(ctx)
+	if err != nil || userID == "" {
+		logger.FromContext(ctx).Error("failed to control user ID", zap.Error(err))
+		return nil, status.Error(codes.Unauthenticated, "user ID is not provided")
+	}
+	if len(req.GetShortUrls()) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "no urls provided")
+	}
+
+	result, err := storage.RestoreURLs(ctx, s.Store, userID, req.ShortUrls, s.Cfg.DeleteGracePeriod)
+	if err != nil {
+		logger.FromContext(ctx).Error("Restore error", zap.Error(err))
+		return nil, status.Error(codes.Internal, "failed to restore urls")
+	}
+	return &RestoreURLResponse{Restored: result.Restored, NotRestored: result.NotRestored}, nil
+}
+
+// LinkStats - метод для получения статистики переходов по ссылке владельцем.
+func (s *GRPCShortenerServer) LinkStats(ctx context.Context, req *LinkStatsRequest) (*LinkStatsResponse, error) {
+	userID, err := services.GetUserIDFromMetadata(ctx)
+	if err != nil || userID == "" {
+		logger.FromContext(ctx).Error("failed to control user ID", zap.Error(err))
+		return nil, status.Error(codes.Unauthenticated, "user ID is not provided")
+	}
+
+	q, err := services.NewLinkStatsQuery(req.GetShortUrl(), userID, req.GetFrom(), req.GetTo(), req.GetBucket(), time.Now())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	stats, err := s.Store.LinkStats(ctx, q)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, status.Error(codes.NotFound, "url not found")
+	}
+	if err != nil {
+		logger.FromContext(ctx).Error("Link stats error", zap.Error(err))
+		return nil, status.Error(codes.Internal, "failed to get link stats")
+	}
+
+	resp := &LinkStatsResponse{
+		ShortUrl:       stats.ShortURL,
+		From:           stats.From.Format(time.RFC3339),
+		To:             stats.To.Format(time.RFC3339),
+		Bucket:         stats.Bucket,
+		TotalClicks:    stats.TotalClicks,
+		UniqueVisitors: stats.UniqueVisitors,
+		TopReferrers:   countItems(stats.TopReferrers),
+		TopUserAgents:  countItems(stats.TopUserAgents),
+	}
+	for _, b := range stats.Series {
+		resp.Series = append(resp.Series, &ClickBucket{Start: b.Start.Format(time.RFC3339), Clicks: b.Clicks})
+	}
+	return resp, nil
+}
+
+// countItems - переводит самые частые значения в сообщения gRPC.
+func countItems(items []models.CountItem) []*CountItem {
+	result := make([]*CountItem, 0, len(items))
+	for _, item := range items {
+		result = append(result, &CountItem{Value: item.Value, Count: item.Count})
+	}
+	return result
+}
+
+// clickEvent - создает событие перехода из метаданных запроса.
+// IP клиента берется из адреса соединения или из метаданных client_ip доверенного прокси.
+func clickEvent(ctx context.Context, shortURL string, salt string, proxies services.TrustedProxies) models.ClickEvent {
+	ip := services.PeerIP(ctx, proxies)
+	var referrer, userAgent string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if v := md.Get("referer"); len(v) > 0 {
+			referrer = v[0]
+		}
+		if v := md.Get("user-agent"); len(v) > 0 {
+			userAgent = v[0]
+		}
+	}
+	return services.NewClickEvent(shortURL, referrer, userAgent, ip, salt)
+}
+
+// deleteJob - переводит задачу удаления в сообщение gRPC.
+func deleteJob(job models.DeleteJob) *DeleteJob {
+	return &DeleteJob{Id: job.ID, Status: job.Status, NotOwned: job.NotOwned, Error: job.Error}
 }
 
 // ListURL - метод для получения списка всех URL, добавленных пользователем.
 func (s *GRPCShortenerServer) ListURL(ctx context.Context, req *ListURLRequest) (*ListURLResponse, error) {
 	userID, err := services.GetUserIDFromMetadata(ctx)
 	if err != nil || userID == "" {
-		logger.Log.Error("failed to control user ID", zap.Error(err))
+		logger.FromContext(ctx).Error("failed to control user ID", zap.Error(err))
 		return nil, status.Error(codes.Unauthenticated, "user ID is not provided")
 	}
 
-	urls, err := s.Store.GetOriginalURLByUserID(userID)
+	urls, err := s.Store.GetOriginalURLByUserID(ctx, userID)
 	if err != nil {
-		logger.Log.Error("failed to get URLs by user ID", zap.Error(err))
+		logger.FromContext(ctx).Error("failed to get URLs by user ID", zap.Error(err))
 		return nil, status.Error(codes.Internal, "failed to get URLs")
 	}
 	if len(urls) == 0 {
@@ -126,22 +312,15 @@ func (s *GRPCShortenerServer) ListURL(ctx context.Context, req *ListURLRequest)
 		})
 	}
 
-	logger.Log.Info("User", zap.String("userID", userID))
+	logger.FromContext(ctx).Info("User", zap.String("userID", userID))
 	return &ListURLResponse{Urls: items}, nil
 }
 
-// PingDB - метод для проверки доступности базы данных.
+// PingDB - метод для проверки доступности хранилища, используемого сервисом.
 func (s *GRPCShortenerServer) PingDB(ctx context.Context, req *PingDBRequest) (*PingDBResponse, error) {
-	db, err := sql.Open("pgx", s.Cfg.DatabaseDSN)
-	if err != nil {
-		logger.Log.Error("failed to open database", zap.Error(err))
-		return nil, status.Error(codes.Internal, "failed to open database")
-	}
-	defer db.Close()
-
-	if err := db.PingContext(ctx); err != nil {
-		logger.Log.Error("failed to ping database", zap.Error(err))
-		return nil, status.Error(codes.Unavailable, "database is unavailable")
+	if err := s.Store.Ping(ctx); err != nil {
+		logger.FromContext(ctx).Error("failed to ping storage", zap.Error(err))
+		return nil, status.Error(codes.Unavailable, "storage is unavailable")
 	}
 
 	return &PingDBResponse{Ok: true}, nil
@@ -171,15 +350,15 @@ func (s *GRPCShortenerServer) Stats(ctx context.Context, req *StatsRequest) (*St
 
 	stats, err := s.Store.Stats(ctx)
 	if err != nil {
-		logger.Log.Error("Error getting stats", zap.Error(err))
+		logger.FromContext(ctx).Error("Error getting stats", zap.Error(err))
 		return nil, status.Error(codes.Internal, "failed to get stats")
 	}
 	if stats.URLs == 0 && stats.Users == 0 {
 		return nil, status.Error(codes.NotFound, "no stats available")
 	}
 
-	logger.Log.Info("Stats requested", zap.Int("URLs", stats.URLs), zap.Int("Users", stats.Users))
-	logger.Log.Info("Client IP", zap.String("IP", clientIP))
+	logger.FromContext(ctx).Info("Stats requested", zap.Int("URLs", stats.URLs), zap.Int("Users", stats.Users))
+	logger.FromContext(ctx).Info("Client IP", zap.String("IP", clientIP))
 
 	return &StatsResponse{
 		Urls:  int64(stats.URLs),
@@ -188,10 +367,11 @@ func (s *GRPCShortenerServer) Stats(ctx context.Context, req *StatsRequest) (*St
 }
 
 // ShortenBatch - метод для пакетного сокращения URL.
+// Элемент с некорректным expires_at получает статус invalid, остальные элементы батча сокращаются.
 func (s *GRPCShortenerServer) ShortenBatch(ctx context.Context, req *ShortenBatchRequest) (*ShortenBatchResponse, error) {
 	userID, err := services.GetUserIDFromMetadata(ctx)
 	if err != nil || userID == "" {
-		logger.Log.Error("failed to control user ID", zap.Error(err))
+		logger.FromContext(ctx).Error("failed to control user ID", zap.Error(err))
 		return nil, status.Error(codes.Unauthenticated, "user ID is not provided")
 	}
 
@@ -199,13 +379,41 @@ func (s *GRPCShortenerServer) ShortenBatch(ctx context.Context, req *ShortenBatc
 		return nil, status.Error(codes.InvalidArgument, "no urls provided")
 	}
 
-	var results []*ShortenBatchResponseItem
-	for _, item := range req.Items {
-		shortenURL, _ := s.Store.ShortenURL(item.OriginalUrl, userID)
-		results = append(results, &ShortenBatchResponseItem{
-			CorrelationId: item.CorrelationId,
-			ShortUrl:      s.Cfg.URL + "/" + shortenURL,
+	results := make([]*ShortenBatchResponseItem, len(req.Items))
+	items := make([]models.BatchLongJSON, 0, len(req.Items))
+	positions := make([]int, 0, len(req.Items))
+	for i, item := range req.Items {
+		expiresAt, err := parseExpiresAt(item.ExpiresAt)
+		if err != nil {
+			results[i] = &ShortenBatchResponseItem{CorrelationId: item.CorrelationId, Status: models.BatchStatusInvalid, Error: err.Error()}
+			continue
+		}
+		items = append(items, models.BatchLongJSON{
+			CorrelationID: item.CorrelationId,
+			LongJSON:      item.OriginalUrl,
+			TTL:           item.Ttl,
+			ExpiresAt:     expiresAt,
 		})
+		positions = append(positions, i)
+	}
+
+	failed := 0
+	batch := storage.ShortenBatchItems(ctx, s.Store, items, userID)
+	for j, item := range batch {
+		out := &ShortenBatchResponseItem{CorrelationId: item.CorrelationID, Status: item.Status}
+		switch item.Status {
+		case models.BatchStatusCreated, models.BatchStatusExisting:
+			out.ShortUrl = s.Cfg.URL + "/" + item.ShortURL
+		case models.BatchStatusInvalid:
+			out.Error = item.Err.Error()
+		default:
+			out.Error = "failed to shorten url"
+			failed++
+		}
+		results[positions[j]] = out
+	}
+	if failed == len(req.Items) {
+		return nil, status.Error(codes.Internal, "failed to shorten batch")
 	}
 
 	return &ShortenBatchResponse{
@@ -218,7 +426,7 @@ func (s *GRPCShortenerServer) ShortenBatch(ctx context.Context, req *ShortenBatc
 func (s *GRPCShortenerServer) Shorten(ctx context.Context, req *ShortenRequest) (*ShortenResponse, error) {
 	userID, err := services.GetUserIDFromMetadata(ctx)
 	if err != nil || userID == "" {
-		logger.Log.Error("failed to control user ID", zap.Error(err))
+		logger.FromContext(ctx).Error("failed to control user ID", zap.Error(err))
 		return nil, status.Error(codes.Unauthenticated, "user ID is not provided")
 	}
 
@@ -226,10 +434,37 @@ func (s *GRPCShortenerServer) Shorten(ctx context.Context, req *ShortenRequest)
 	if longURL == "" {
 		return nil, status.Error(codes.InvalidArgument, "Empty url")
 	}
+	alias := req.GetAlias()
+	if alias != "" {
+		if err := services.ValidateAlias(alias); err != nil {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+	}
+	expiresAt, err := parseExpiresAt(req.GetExpiresAt())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	expiry, err := services.ResolveExpiry(req.GetTtl(), expiresAt, time.Now())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if err := services.ValidateMaxClicks(req.GetMaxClicks()); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	passwordHash, err := services.HashLinkPassword(req.GetPassword())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
 
-	shortenURL, storeStatus := s.Store.ShortenURL(longURL, userID)
-	if storeStatus != 201 && storeStatus != 200 {
-		return nil, status.Error(codes.Internal, "failed to shorten URL")
+	opts := models.ShortenOptions{
+		Alias:        alias,
+		ExpiresAt:    expiry,
+		MaxClicks:    req.GetMaxClicks(),
+		PasswordHash: passwordHash,
+	}
+	shortenURL, err := s.Store.ShortenURL(ctx, longURL, userID, opts)
+	if err != nil {
+		return nil, shortenError(ctx, err, s.Cfg.URL+"/"+shortenURL)
 	}
 
 	return &ShortenResponse{
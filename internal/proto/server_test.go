@@ -0,0 +1,40 @@
+package proto
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/darkseear/shortener/internal/config"
+	"github.com/darkseear/shortener/internal/models"
+	"github.com/darkseear/shortener/internal/storage"
+)
+
+func TestShortenBatchInvalidExpiry(t *testing.T) {
+	cfg := &config.Config{URL: "http://localhost:8080", SecretKey: "secret"}
+	store, err := storage.New(cfg)
+	require.NoError(t, err)
+	s := NewGRPCShortenerServer(store, cfg)
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("userid", "1"))
+
+	// Некорректный expires_at делает недействительным только свой элемент.
+	resp, err := s.ShortenBatch(ctx, &ShortenBatchRequest{Items: []*ShortenBatchRequestItem{
+		{CorrelationId: "1", OriginalUrl: "https://yandex.ru"},
+		{CorrelationId: "2", OriginalUrl: "https://ya.ru", ExpiresAt: "tomorrow"},
+		{CorrelationId: "3", OriginalUrl: "https://google.com", ExpiresAt: "2100-01-01T00:00:00Z"},
+	}})
+	require.NoError(t, err)
+	items := resp.GetItems()
+	require.Len(t, items, 3)
+	assert.Equal(t, "1", items[0].GetCorrelationId())
+	assert.Equal(t, models.BatchStatusCreated, items[0].GetStatus())
+	assert.Equal(t, "2", items[1].GetCorrelationId())
+	assert.Equal(t, models.BatchStatusInvalid, items[1].GetStatus())
+	assert.NotEmpty(t, items[1].GetError())
+	assert.Empty(t, items[1].GetShortUrl())
+	assert.Equal(t, "3", items[2].GetCorrelationId())
+	assert.Equal(t, models.BatchStatusCreated, items[2].GetStatus())
+}
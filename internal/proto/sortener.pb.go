@@ -199,8 +199,17 @@ func (x *AddURLResponse) GetShortUrl() string {
 }
 
 type ShortenRequest struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
-	Url           string                 `protobuf:"bytes,1,opt,name=url,proto3" json:"url,omitempty"`
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Url   string                 `protobuf:"bytes,1,opt,name=url,proto3" json:"url,omitempty"`
+	// Необязательный короткий адрес, выбранный пользователем.
+	Alias string `protobuf:"bytes,2,opt,name=alias,proto3" json:"alias,omitempty"`
+	// Срок жизни ссылки в секундах или момент истечения в RFC 3339, задается не больше одного.
+	Ttl       int64  `protobuf:"varint,3,opt,name=ttl,proto3" json:"ttl,omitempty"`
+	ExpiresAt string `protobuf:"bytes,4,opt,name=expires_at,json=expiresAt,proto3" json:"expires_at,omitempty"`
+	// Сколько раз можно перейти по ссылке, 0 - без ограничений.
+	MaxClicks int64 `protobuf:"varint,5,opt,name=max_clicks,json=maxClicks,proto3" json:"max_clicks,omitempty"`
+	// Пароль, без которого переход по ссылке невозможен, передается в GetURL в метаданных link_password.
+	Password      string `protobuf:"bytes,6,opt,name=password,proto3" json:"password,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
@@ -242,6 +251,41 @@ func (x *ShortenRequest) GetUrl() string {
 	return ""
 }
 
+func (x *ShortenRequest) GetAlias() string {
+	if x != nil {
+		return x.Alias
+	}
+	return ""
+}
+
+func (x *ShortenRequest) GetTtl() int64 {
+	if x != nil {
+		return x.Ttl
+	}
+	return 0
+}
+
+func (x *ShortenRequest) GetExpiresAt() string {
+	if x != nil {
+		return x.ExpiresAt
+	}
+	return ""
+}
+
+func (x *ShortenRequest) GetMaxClicks() int64 {
+	if x != nil {
+		return x.MaxClicks
+	}
+	return 0
+}
+
+func (x *ShortenRequest) GetPassword() string {
+	if x != nil {
+		return x.Password
+	}
+	return ""
+}
+
 type ShortenResponse struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
 	ShortUrl      string                 `protobuf:"bytes,1,opt,name=short_url,json=shortUrl,proto3" json:"short_url,omitempty"`
@@ -378,6 +422,9 @@ type ShortenBatchRequestItem struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
 	CorrelationId string                 `protobuf:"bytes,1,opt,name=correlation_id,json=correlationId,proto3" json:"correlation_id,omitempty"`
 	OriginalUrl   string                 `protobuf:"bytes,2,opt,name=original_url,json=originalUrl,proto3" json:"original_url,omitempty"`
+	// Срок жизни ссылки, как в ShortenRequest.
+	Ttl           int64  `protobuf:"varint,3,opt,name=ttl,proto3" json:"ttl,omitempty"`
+	ExpiresAt     string `protobuf:"bytes,4,opt,name=expires_at,json=expiresAt,proto3" json:"expires_at,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
@@ -426,10 +473,27 @@ func (x *ShortenBatchRequestItem) GetOriginalUrl() string {
 	return ""
 }
 
+func (x *ShortenBatchRequestItem) GetTtl() int64 {
+	if x != nil {
+		return x.Ttl
+	}
+	return 0
+}
+
+func (x *ShortenBatchRequestItem) GetExpiresAt() string {
+	if x != nil {
+		return x.ExpiresAt
+	}
+	return ""
+}
+
+// status - created, existing, invalid или failed; error - описание ошибки для invalid и failed.
 type ShortenBatchResponseItem struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
 	CorrelationId string                 `protobuf:"bytes,1,opt,name=correlation_id,json=correlationId,proto3" json:"correlation_id,omitempty"`
 	ShortUrl      string                 `protobuf:"bytes,2,opt,name=short_url,json=shortUrl,proto3" json:"short_url,omitempty"`
+	Status        string                 `protobuf:"bytes,3,opt,name=status,proto3" json:"status,omitempty"`
+	Error         string                 `protobuf:"bytes,4,opt,name=error,proto3" json:"error,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
@@ -478,6 +542,20 @@ func (x *ShortenBatchResponseItem) GetShortUrl() string {
 	return ""
 }
 
+func (x *ShortenBatchResponseItem) GetStatus() string {
+	if x != nil {
+		return x.Status
+	}
+	return ""
+}
+
+func (x *ShortenBatchResponseItem) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
 type URLItem struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
 	UserId        string                 `protobuf:"bytes,1,opt,name=user_id,json=userId,proto3" json:"user_id,omitempty"`
@@ -745,6 +823,7 @@ func (x *DeleteURLRequest) GetShortUrls() []string {
 type DeleteURLResponse struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
 	Success       bool                   `protobuf:"varint,1,opt,name=success,proto3" json:"success,omitempty"`
+	Job           *DeleteJob             `protobuf:"bytes,2,opt,name=job,proto3" json:"job,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
@@ -786,6 +865,504 @@ func (x *DeleteURLResponse) GetSuccess() bool {
 	return false
 }
 
+func (x *DeleteURLResponse) GetJob() *DeleteJob {
+	if x != nil {
+		return x.Job
+	}
+	return nil
+}
+
+type GetDeleteJobRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetDeleteJobRequest) Reset() {
+	*x = GetDeleteJobRequest{}
+	mi := &file_sortener_proto_msgTypes[17]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetDeleteJobRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetDeleteJobRequest) ProtoMessage() {}
+
+func (x *GetDeleteJobRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_sortener_proto_msgTypes[17]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetDeleteJobRequest.ProtoReflect.Descriptor instead.
+func (*GetDeleteJobRequest) Descriptor() ([]byte, []int) {
+	return file_sortener_proto_rawDescGZIP(), []int{17}
+}
+
+func (x *GetDeleteJobRequest) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+// status - pending, done или failed; not_owned - адреса, не принадлежащие пользователю.
+type DeleteJob struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Status        string                 `protobuf:"bytes,2,opt,name=status,proto3" json:"status,omitempty"`
+	NotOwned      []string               `protobuf:"bytes,3,rep,name=not_owned,json=notOwned,proto3" json:"not_owned,omitempty"`
+	Error         string                 `protobuf:"bytes,4,opt,name=error,proto3" json:"error,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DeleteJob) Reset() {
+	*x = DeleteJob{}
+	mi := &file_sortener_proto_msgTypes[18]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeleteJob) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeleteJob) ProtoMessage() {}
+
+func (x *DeleteJob) ProtoReflect() protoreflect.Message {
+	mi := &file_sortener_proto_msgTypes[18]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeleteJob.ProtoReflect.Descriptor instead.
+func (*DeleteJob) Descriptor() ([]byte, []int) {
+	return file_sortener_proto_rawDescGZIP(), []int{18}
+}
+
+func (x *DeleteJob) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *DeleteJob) GetStatus() string {
+	if x != nil {
+		return x.Status
+	}
+	return ""
+}
+
+func (x *DeleteJob) GetNotOwned() []string {
+	if x != nil {
+		return x.NotOwned
+	}
+	return nil
+}
+
+func (x *DeleteJob) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+type RestoreURLRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	ShortUrls     []string               `protobuf:"bytes,1,rep,name=short_urls,json=shortUrls,proto3" json:"short_urls,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RestoreURLRequest) Reset() {
+	*x = RestoreURLRequest{}
+	mi := &file_sortener_proto_msgTypes[19]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RestoreURLRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RestoreURLRequest) ProtoMessage() {}
+
+func (x *RestoreURLRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_sortener_proto_msgTypes[19]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RestoreURLRequest.ProtoReflect.Descriptor instead.
+func (*RestoreURLRequest) Descriptor() ([]byte, []int) {
+	return file_sortener_proto_rawDescGZIP(), []int{19}
+}
+
+func (x *RestoreURLRequest) GetShortUrls() []string {
+	if x != nil {
+		return x.ShortUrls
+	}
+	return nil
+}
+
+// not_restored - адреса, которые не удалены, чужие, истекли или удалены раньше окна восстановления.
+type RestoreURLResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Restored      []string               `protobuf:"bytes,1,rep,name=restored,proto3" json:"restored,omitempty"`
+	NotRestored   []string               `protobuf:"bytes,2,rep,name=not_restored,json=notRestored,proto3" json:"not_restored,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RestoreURLResponse) Reset() {
+	*x = RestoreURLResponse{}
+	mi := &file_sortener_proto_msgTypes[20]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RestoreURLResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RestoreURLResponse) ProtoMessage() {}
+
+func (x *RestoreURLResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_sortener_proto_msgTypes[20]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RestoreURLResponse.ProtoReflect.Descriptor instead.
+func (*RestoreURLResponse) Descriptor() ([]byte, []int) {
+	return file_sortener_proto_rawDescGZIP(), []int{20}
+}
+
+func (x *RestoreURLResponse) GetRestored() []string {
+	if x != nil {
+		return x.Restored
+	}
+	return nil
+}
+
+func (x *RestoreURLResponse) GetNotRestored() []string {
+	if x != nil {
+		return x.NotRestored
+	}
+	return nil
+}
+
+// from и to - границы периода в RFC3339, bucket - hour или day.
+type LinkStatsRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	ShortUrl      string                 `protobuf:"bytes,1,opt,name=short_url,json=shortUrl,proto3" json:"short_url,omitempty"`
+	From          string                 `protobuf:"bytes,2,opt,name=from,proto3" json:"from,omitempty"`
+	To            string                 `protobuf:"bytes,3,opt,name=to,proto3" json:"to,omitempty"`
+	Bucket        string                 `protobuf:"bytes,4,opt,name=bucket,proto3" json:"bucket,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *LinkStatsRequest) Reset() {
+	*x = LinkStatsRequest{}
+	mi := &file_sortener_proto_msgTypes[21]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *LinkStatsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*LinkStatsRequest) ProtoMessage() {}
+
+func (x *LinkStatsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_sortener_proto_msgTypes[21]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use LinkStatsRequest.ProtoReflect.Descriptor instead.
+func (*LinkStatsRequest) Descriptor() ([]byte, []int) {
+	return file_sortener_proto_rawDescGZIP(), []int{21}
+}
+
+func (x *LinkStatsRequest) GetShortUrl() string {
+	if x != nil {
+		return x.ShortUrl
+	}
+	return ""
+}
+
+func (x *LinkStatsRequest) GetFrom() string {
+	if x != nil {
+		return x.From
+	}
+	return ""
+}
+
+func (x *LinkStatsRequest) GetTo() string {
+	if x != nil {
+		return x.To
+	}
+	return ""
+}
+
+func (x *LinkStatsRequest) GetBucket() string {
+	if x != nil {
+		return x.Bucket
+	}
+	return ""
+}
+
+type ClickBucket struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Start         string                 `protobuf:"bytes,1,opt,name=start,proto3" json:"start,omitempty"`
+	Clicks        int64                  `protobuf:"varint,2,opt,name=clicks,proto3" json:"clicks,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ClickBucket) Reset() {
+	*x = ClickBucket{}
+	mi := &file_sortener_proto_msgTypes[22]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ClickBucket) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ClickBucket) ProtoMessage() {}
+
+func (x *ClickBucket) ProtoReflect() protoreflect.Message {
+	mi := &file_sortener_proto_msgTypes[22]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ClickBucket.ProtoReflect.Descriptor instead.
+func (*ClickBucket) Descriptor() ([]byte, []int) {
+	return file_sortener_proto_rawDescGZIP(), []int{22}
+}
+
+func (x *ClickBucket) GetStart() string {
+	if x != nil {
+		return x.Start
+	}
+	return ""
+}
+
+func (x *ClickBucket) GetClicks() int64 {
+	if x != nil {
+		return x.Clicks
+	}
+	return 0
+}
+
+type CountItem struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Value         string                 `protobuf:"bytes,1,opt,name=value,proto3" json:"value,omitempty"`
+	Count         int64                  `protobuf:"varint,2,opt,name=count,proto3" json:"count,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CountItem) Reset() {
+	*x = CountItem{}
+	mi := &file_sortener_proto_msgTypes[23]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CountItem) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CountItem) ProtoMessage() {}
+
+func (x *CountItem) ProtoReflect() protoreflect.Message {
+	mi := &file_sortener_proto_msgTypes[23]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CountItem.ProtoReflect.Descriptor instead.
+func (*CountItem) Descriptor() ([]byte, []int) {
+	return file_sortener_proto_rawDescGZIP(), []int{23}
+}
+
+func (x *CountItem) GetValue() string {
+	if x != nil {
+		return x.Value
+	}
+	return ""
+}
+
+func (x *CountItem) GetCount() int64 {
+	if x != nil {
+		return x.Count
+	}
+	return 0
+}
+
+type LinkStatsResponse struct {
+	state          protoimpl.MessageState `protogen:"open.v1"`
+	ShortUrl       string                 `protobuf:"bytes,1,opt,name=short_url,json=shortUrl,proto3" json:"short_url,omitempty"`
+	From           string                 `protobuf:"bytes,2,opt,name=from,proto3" json:"from,omitempty"`
+	To             string                 `protobuf:"bytes,3,opt,name=to,proto3" json:"to,omitempty"`
+	Bucket         string                 `protobuf:"bytes,4,opt,name=bucket,proto3" json:"bucket,omitempty"`
+	TotalClicks    int64                  `protobuf:"varint,5,opt,name=total_clicks,json=totalClicks,proto3" json:"total_clicks,omitempty"`
+	UniqueVisitors int64                  `protobuf:"varint,6,opt,name=unique_visitors,json=uniqueVisitors,proto3" json:"unique_visitors,omitempty"`
+	Series         []*ClickBucket         `protobuf:"bytes,7,rep,name=series,proto3" json:"series,omitempty"`
+	TopReferrers   []*CountItem           `protobuf:"bytes,8,rep,name=top_referrers,json=topReferrers,proto3" json:"top_referrers,omitempty"`
+	TopUserAgents  []*CountItem           `protobuf:"bytes,9,rep,name=top_user_agents,json=topUserAgents,proto3" json:"top_user_agents,omitempty"`
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
+}
+
+func (x *LinkStatsResponse) Reset() {
+	*x = LinkStatsResponse{}
+	mi := &file_sortener_proto_msgTypes[24]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *LinkStatsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*LinkStatsResponse) ProtoMessage() {}
+
+func (x *LinkStatsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_sortener_proto_msgTypes[24]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use LinkStatsResponse.ProtoReflect.Descriptor instead.
+func (*LinkStatsResponse) Descriptor() ([]byte, []int) {
+	return file_sortener_proto_rawDescGZIP(), []int{24}
+}
+
+func (x *LinkStatsResponse) GetShortUrl() string {
+	if x != nil {
+		return x.ShortUrl
+	}
+	return ""
+}
+
+func (x *LinkStatsResponse) GetFrom() string {
+	if x != nil {
+		return x.From
+	}
+	return ""
+}
+
+func (x *LinkStatsResponse) GetTo() string {
+	if x != nil {
+		return x.To
+	}
+	return ""
+}
+
+func (x *LinkStatsResponse) GetBucket() string {
+	if x != nil {
+		return x.Bucket
+	}
+	return ""
+}
+
+func (x *LinkStatsResponse) GetTotalClicks() int64 {
+	if x != nil {
+		return x.TotalClicks
+	}
+	return 0
+}
+
+func (x *LinkStatsResponse) GetUniqueVisitors() int64 {
+	if x != nil {
+		return x.UniqueVisitors
+	}
+	return 0
+}
+
+func (x *LinkStatsResponse) GetSeries() []*ClickBucket {
+	if x != nil {
+		return x.Series
+	}
+	return nil
+}
+
+func (x *LinkStatsResponse) GetTopReferrers() []*CountItem {
+	if x != nil {
+		return x.TopReferrers
+	}
+	return nil
+}
+
+func (x *LinkStatsResponse) GetTopUserAgents() []*CountItem {
+	if x != nil {
+		return x.TopUserAgents
+	}
+	return nil
+}
+
 type StatsRequest struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
 	unknownFields protoimpl.UnknownFields
@@ -794,7 +1371,7 @@ type StatsRequest struct {
 
 func (x *StatsRequest) Reset() {
 	*x = StatsRequest{}
-	mi := &file_sortener_proto_msgTypes[17]
+	mi := &file_sortener_proto_msgTypes[25]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -806,7 +1383,7 @@ func (x *StatsRequest) String() string {
 func (*StatsRequest) ProtoMessage() {}
 
 func (x *StatsRequest) ProtoReflect() protoreflect.Message {
-	mi := &file_sortener_proto_msgTypes[17]
+	mi := &file_sortener_proto_msgTypes[25]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -819,7 +1396,7 @@ func (x *StatsRequest) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use StatsRequest.ProtoReflect.Descriptor instead.
 func (*StatsRequest) Descriptor() ([]byte, []int) {
-	return file_sortener_proto_rawDescGZIP(), []int{17}
+	return file_sortener_proto_rawDescGZIP(), []int{25}
 }
 
 type StatsResponse struct {
@@ -832,7 +1409,7 @@ type StatsResponse struct {
 
 func (x *StatsResponse) Reset() {
 	*x = StatsResponse{}
-	mi := &file_sortener_proto_msgTypes[18]
+	mi := &file_sortener_proto_msgTypes[26]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -844,7 +1421,7 @@ func (x *StatsResponse) String() string {
 func (*StatsResponse) ProtoMessage() {}
 
 func (x *StatsResponse) ProtoReflect() protoreflect.Message {
-	mi := &file_sortener_proto_msgTypes[18]
+	mi := &file_sortener_proto_msgTypes[26]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -857,7 +1434,7 @@ func (x *StatsResponse) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use StatsResponse.ProtoReflect.Descriptor instead.
 func (*StatsResponse) Descriptor() ([]byte, []int) {
-	return file_sortener_proto_rawDescGZIP(), []int{18}
+	return file_sortener_proto_rawDescGZIP(), []int{26}
 }
 
 func (x *StatsResponse) GetUrls() int64 {
@@ -886,21 +1463,33 @@ const file_sortener_proto_rawDesc = "" +
 	"\rAddURLRequest\x12\x10\n" +
 	"\x03url\x18\x01 \x01(\tR\x03url\"-\n" +
 	"\x0eAddURLResponse\x12\x1b\n" +
-	"\tshort_url\x18\x01 \x01(\tR\bshortUrl\"\"\n" +
+	"\tshort_url\x18\x01 \x01(\tR\bshortUrl\"\xa4\x01\n" +
 	"\x0eShortenRequest\x12\x10\n" +
-	"\x03url\x18\x01 \x01(\tR\x03url\".\n" +
+	"\x03url\x18\x01 \x01(\tR\x03url\x12\x14\n" +
+	"\x05alias\x18\x02 \x01(\tR\x05alias\x12\x10\n" +
+	"\x03ttl\x18\x03 \x01(\x03R\x03ttl\x12\x1d\n" +
+	"\n" +
+	"expires_at\x18\x04 \x01(\tR\texpiresAt\x12\x1d\n" +
+	"\n" +
+	"max_clicks\x18\x05 \x01(\x03R\tmaxClicks\x12\x1a\n" +
+	"\bpassword\x18\x06 \x01(\tR\bpassword\".\n" +
 	"\x0fShortenResponse\x12\x1b\n" +
 	"\tshort_url\x18\x01 \x01(\tR\bshortUrl\"K\n" +
 	"\x13ShortenBatchRequest\x124\n" +
 	"\x05items\x18\x01 \x03(\v2\x1e.proto.ShortenBatchRequestItemR\x05items\"M\n" +
 	"\x14ShortenBatchResponse\x125\n" +
-	"\x05items\x18\x01 \x03(\v2\x1f.proto.ShortenBatchResponseItemR\x05items\"c\n" +
+	"\x05items\x18\x01 \x03(\v2\x1f.proto.ShortenBatchResponseItemR\x05items\"\x94\x01\n" +
 	"\x17ShortenBatchRequestItem\x12%\n" +
 	"\x0ecorrelation_id\x18\x01 \x01(\tR\rcorrelationId\x12!\n" +
-	"\foriginal_url\x18\x02 \x01(\tR\voriginalUrl\"^\n" +
+	"\foriginal_url\x18\x02 \x01(\tR\voriginalUrl\x12\x10\n" +
+	"\x03ttl\x18\x03 \x01(\x03R\x03ttl\x12\x1d\n" +
+	"\n" +
+	"expires_at\x18\x04 \x01(\tR\texpiresAt\"\x8c\x01\n" +
 	"\x18ShortenBatchResponseItem\x12%\n" +
 	"\x0ecorrelation_id\x18\x01 \x01(\tR\rcorrelationId\x12\x1b\n" +
-	"\tshort_url\x18\x02 \x01(\tR\bshortUrl\"b\n" +
+	"\tshort_url\x18\x02 \x01(\tR\bshortUrl\x12\x16\n" +
+	"\x06status\x18\x03 \x01(\tR\x06status\x12\x14\n" +
+	"\x05error\x18\x04 \x01(\tR\x05error\"b\n" +
 	"\aURLItem\x12\x17\n" +
 	"\auser_id\x18\x01 \x01(\tR\x06userId\x12\x1b\n" +
 	"\tshort_url\x18\x02 \x01(\tR\bshortUrl\x12!\n" +
@@ -913,13 +1502,48 @@ const file_sortener_proto_rawDesc = "" +
 	"\x04urls\x18\x01 \x03(\v2\x0e.proto.URLItemR\x04urls\"1\n" +
 	"\x10DeleteURLRequest\x12\x1d\n" +
 	"\n" +
-	"short_urls\x18\x01 \x03(\tR\tshortUrls\"-\n" +
+	"short_urls\x18\x01 \x03(\tR\tshortUrls\"Q\n" +
 	"\x11DeleteURLResponse\x12\x18\n" +
-	"\asuccess\x18\x01 \x01(\bR\asuccess\"\x0e\n" +
+	"\asuccess\x18\x01 \x01(\bR\asuccess\x12\"\n" +
+	"\x03job\x18\x02 \x01(\v2\x10.proto.DeleteJobR\x03job\"%\n" +
+	"\x13GetDeleteJobRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\"f\n" +
+	"\tDeleteJob\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x16\n" +
+	"\x06status\x18\x02 \x01(\tR\x06status\x12\x1b\n" +
+	"\tnot_owned\x18\x03 \x03(\tR\bnotOwned\x12\x14\n" +
+	"\x05error\x18\x04 \x01(\tR\x05error\"2\n" +
+	"\x11RestoreURLRequest\x12\x1d\n" +
+	"\n" +
+	"short_urls\x18\x01 \x03(\tR\tshortUrls\"S\n" +
+	"\x12RestoreURLResponse\x12\x1a\n" +
+	"\brestored\x18\x01 \x03(\tR\brestored\x12!\n" +
+	"\fnot_restored\x18\x02 \x03(\tR\vnotRestored\"k\n" +
+	"\x10LinkStatsRequest\x12\x1b\n" +
+	"\tshort_url\x18\x01 \x01(\tR\bshortUrl\x12\x12\n" +
+	"\x04from\x18\x02 \x01(\tR\x04from\x12\x0e\n" +
+	"\x02to\x18\x03 \x01(\tR\x02to\x12\x16\n" +
+	"\x06bucket\x18\x04 \x01(\tR\x06bucket\";\n" +
+	"\vClickBucket\x12\x14\n" +
+	"\x05start\x18\x01 \x01(\tR\x05start\x12\x16\n" +
+	"\x06clicks\x18\x02 \x01(\x03R\x06clicks\"7\n" +
+	"\tCountItem\x12\x14\n" +
+	"\x05value\x18\x01 \x01(\tR\x05value\x12\x14\n" +
+	"\x05count\x18\x02 \x01(\x03R\x05count\"\xd5\x02\n" +
+	"\x11LinkStatsResponse\x12\x1b\n" +
+	"\tshort_url\x18\x01 \x01(\tR\bshortUrl\x12\x12\n" +
+	"\x04from\x18\x02 \x01(\tR\x04from\x12\x0e\n" +
+	"\x02to\x18\x03 \x01(\tR\x02to\x12\x16\n" +
+	"\x06bucket\x18\x04 \x01(\tR\x06bucket\x12!\n" +
+	"\ftotal_clicks\x18\x05 \x01(\x03R\vtotalClicks\x12'\n" +
+	"\x0funique_visitors\x18\x06 \x01(\x03R\x0euniqueVisitors\x12*\n" +
+	"\x06series\x18\a \x03(\v2\x12.proto.ClickBucketR\x06series\x125\n" +
+	"\rtop_referrers\x18\b \x03(\v2\x10.proto.CountItemR\ftopReferrers\x128\n" +
+	"\x0ftop_user_agents\x18\t \x03(\v2\x10.proto.CountItemR\rtopUserAgents\"\x0e\n" +
 	"\fStatsRequest\"9\n" +
 	"\rStatsResponse\x12\x12\n" +
 	"\x04urls\x18\x01 \x01(\x03R\x04urls\x12\x14\n" +
-	"\x05users\x18\x02 \x01(\x03R\x05users2\xe0\x03\n" +
+	"\x05users\x18\x02 \x01(\x03R\x05users2\xa1\x05\n" +
 	"\bSortener\x125\n" +
 	"\x06GetURL\x12\x14.proto.GetURLRequest\x1a\x15.proto.GetURLResponse\x125\n" +
 	"\x06AddURL\x12\x14.proto.AddURLRequest\x1a\x15.proto.AddURLResponse\x128\n" +
@@ -927,7 +1551,11 @@ const file_sortener_proto_rawDesc = "" +
 	"\fShortenBatch\x12\x1a.proto.ShortenBatchRequest\x1a\x1b.proto.ShortenBatchResponse\x125\n" +
 	"\x06PingDB\x12\x14.proto.PingDBRequest\x1a\x15.proto.PingDBResponse\x128\n" +
 	"\aListURL\x12\x15.proto.ListURLRequest\x1a\x16.proto.ListURLResponse\x12>\n" +
-	"\tDeleteURL\x12\x17.proto.DeleteURLRequest\x1a\x18.proto.DeleteURLResponse\x122\n" +
+	"\tDeleteURL\x12\x17.proto.DeleteURLRequest\x1a\x18.proto.DeleteURLResponse\x12<\n" +
+	"\fGetDeleteJob\x12\x1a.proto.GetDeleteJobRequest\x1a\x10.proto.DeleteJob\x12A\n" +
+	"\n" +
+	"RestoreURL\x12\x18.proto.RestoreURLRequest\x1a\x19.proto.RestoreURLResponse\x12>\n" +
+	"\tLinkStats\x12\x17.proto.LinkStatsRequest\x1a\x18.proto.LinkStatsResponse\x122\n" +
 	"\x05Stats\x12\x13.proto.StatsRequest\x1a\x14.proto.StatsResponseB8Z6github.com/darkseear/shortener/internal/proto/sortenerb\x06proto3"
 
 var (
@@ -942,7 +1570,7 @@ func file_sortener_proto_rawDescGZIP() []byte {
 	return file_sortener_proto_rawDescData
 }
 
-var file_sortener_proto_msgTypes = make([]protoimpl.MessageInfo, 19)
+var file_sortener_proto_msgTypes = make([]protoimpl.MessageInfo, 27)
 var file_sortener_proto_goTypes = []any{
 	(*GetURLRequest)(nil),            // 0: proto.GetURLRequest
 	(*GetURLResponse)(nil),           // 1: proto.GetURLResponse
@@ -961,34 +1589,52 @@ var file_sortener_proto_goTypes = []any{
 	(*ListURLResponse)(nil),          // 14: proto.ListURLResponse
 	(*DeleteURLRequest)(nil),         // 15: proto.DeleteURLRequest
 	(*DeleteURLResponse)(nil),        // 16: proto.DeleteURLResponse
-	(*StatsRequest)(nil),             // 17: proto.StatsRequest
-	(*StatsResponse)(nil),            // 18: proto.StatsResponse
+	(*GetDeleteJobRequest)(nil),      // 17: proto.GetDeleteJobRequest
+	(*DeleteJob)(nil),                // 18: proto.DeleteJob
+	(*RestoreURLRequest)(nil),        // 19: proto.RestoreURLRequest
+	(*RestoreURLResponse)(nil),       // 20: proto.RestoreURLResponse
+	(*LinkStatsRequest)(nil),         // 21: proto.LinkStatsRequest
+	(*ClickBucket)(nil),              // 22: proto.ClickBucket
+	(*CountItem)(nil),                // 23: proto.CountItem
+	(*LinkStatsResponse)(nil),        // 24: proto.LinkStatsResponse
+	(*StatsRequest)(nil),             // 25: proto.StatsRequest
+	(*StatsResponse)(nil),            // 26: proto.StatsResponse
 }
 var file_sortener_proto_depIdxs = []int32{
 	8,  // 0: proto.ShortenBatchRequest.items:type_name -> proto.ShortenBatchRequestItem
 	9,  // 1: proto.ShortenBatchResponse.items:type_name -> proto.ShortenBatchResponseItem
 	10, // 2: proto.ListURLResponse.urls:type_name -> proto.URLItem
-	0,  // 3: proto.Sortener.GetURL:input_type -> proto.GetURLRequest
-	2,  // 4: proto.Sortener.AddURL:input_type -> proto.AddURLRequest
-	4,  // 5: proto.Sortener.Shorten:input_type -> proto.ShortenRequest
-	6,  // 6: proto.Sortener.ShortenBatch:input_type -> proto.ShortenBatchRequest
-	11, // 7: proto.Sortener.PingDB:input_type -> proto.PingDBRequest
-	13, // 8: proto.Sortener.ListURL:input_type -> proto.ListURLRequest
-	15, // 9: proto.Sortener.DeleteURL:input_type -> proto.DeleteURLRequest
-	17, // 10: proto.Sortener.Stats:input_type -> proto.StatsRequest
-	1,  // 11: proto.Sortener.GetURL:output_type -> proto.GetURLResponse
-	3,  // 12: proto.Sortener.AddURL:output_type -> proto.AddURLResponse
-	5,  // 13: proto.Sortener.Shorten:output_type -> proto.ShortenResponse
-	7,  // 14: proto.Sortener.ShortenBatch:output_type -> proto.ShortenBatchResponse
-	12, // 15: proto.Sortener.PingDB:output_type -> proto.PingDBResponse
-	14, // 16: proto.Sortener.ListURL:output_type -> proto.ListURLResponse
-	16, // 17: proto.Sortener.DeleteURL:output_type -> proto.DeleteURLResponse
-	18, // 18: proto.Sortener.Stats:output_type -> proto.StatsResponse
-	11, // [11:19] is the sub-list for method output_type
-	3,  // [3:11] is the sub-list for method input_type
-	3,  // [3:3] is the sub-list for extension type_name
-	3,  // [3:3] is the sub-list for extension extendee
-	0,  // [0:3] is the sub-list for field type_name
+	18, // 3: proto.DeleteURLResponse.job:type_name -> proto.DeleteJob
+	22, // 4: proto.LinkStatsResponse.series:type_name -> proto.ClickBucket
+	23, // 5: proto.LinkStatsResponse.top_referrers:type_name -> proto.CountItem
+	23, // 6: proto.LinkStatsResponse.top_user_agents:type_name -> proto.CountItem
+	0,  // 7: proto.Sortener.GetURL:input_type -> proto.GetURLRequest
+	2,  // 8: proto.Sortener.AddURL:input_type -> proto.AddURLRequest
+	4,  // 9: proto.Sortener.Shorten:input_type -> proto.ShortenRequest
+	6,  // 10: proto.Sortener.ShortenBatch:input_type -> proto.ShortenBatchRequest
+	11, // 11: proto.Sortener.PingDB:input_type -> proto.PingDBRequest
+	13, // 12: proto.Sortener.ListURL:input_type -> proto.ListURLRequest
+	15, // 13: proto.Sortener.DeleteURL:input_type -> proto.DeleteURLRequest
+	17, // 14: proto.Sortener.GetDeleteJob:input_type -> proto.GetDeleteJobRequest
+	19, // 15: proto.Sortener.RestoreURL:input_type -> proto.RestoreURLRequest
+	21, // 16: proto.Sortener.LinkStats:input_type -> proto.LinkStatsRequest
+	25, // 17: proto.Sortener.Stats:input_type -> proto.StatsRequest
+	1,  // 18: proto.Sortener.GetURL:output_type -> proto.GetURLResponse
+	3,  // 19: proto.Sortener.AddURL:output_type -> proto.AddURLResponse
+	5,  // 20: proto.Sortener.Shorten:output_type -> proto.ShortenResponse
+	7,  // 21: proto.Sortener.ShortenBatch:output_type -> proto.ShortenBatchResponse
+	12, // 22: proto.Sortener.PingDB:output_type -> proto.PingDBResponse
+	14, // 23: proto.Sortener.ListURL:output_type -> proto.ListURLResponse
+	16, // 24: proto.Sortener.DeleteURL:output_type -> proto.DeleteURLResponse
+	18, // 25: proto.Sortener.GetDeleteJob:output_type -> proto.DeleteJob
+	20, // 26: proto.Sortener.RestoreURL:output_type -> proto.RestoreURLResponse
+	24, // 27: proto.Sortener.LinkStats:output_type -> proto.LinkStatsResponse
+	26, // 28: proto.Sortener.Stats:output_type -> proto.StatsResponse
+	18, // [18:29] is the sub-list for method output_type
+	7,  // [7:18] is the sub-list for method input_type
+	7,  // [7:7] is the sub-list for extension type_name
+	7,  // [7:7] is the sub-list for extension extendee
+	0,  // [0:7] is the sub-list for field type_name
 }
 
 func init() { file_sortener_proto_init() }
@@ -1002,7 +1648,7 @@ func file_sortener_proto_init() {
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: unsafe.Slice(unsafe.StringData(file_sortener_proto_rawDesc), len(file_sortener_proto_rawDesc)),
 			NumEnums:      0,
-			NumMessages:   19,
+			NumMessages:   27,
 			NumExtensions: 0,
 			NumServices:   1,
 		},
@@ -26,6 +26,9 @@ const (
 	Sortener_PingDB_FullMethodName       = "/proto.Sortener/PingDB"
 	Sortener_ListURL_FullMethodName      = "/proto.Sortener/ListURL"
 	Sortener_DeleteURL_FullMethodName    = "/proto.Sortener/DeleteURL"
+	Sortener_GetDeleteJob_FullMethodName = "/proto.Sortener/GetDeleteJob"
+	Sortener_RestoreURL_FullMethodName   = "/proto.Sortener/RestoreURL"
+	Sortener_LinkStats_FullMethodName    = "/proto.Sortener/LinkStats"
 	Sortener_Stats_FullMethodName        = "/proto.Sortener/Stats"
 )
 
@@ -40,6 +43,9 @@ type SortenerClient interface {
 	PingDB(ctx context.Context, in *PingDBRequest, opts ...grpc.CallOption) (*PingDBResponse, error)
 	ListURL(ctx context.Context, in *ListURLRequest, opts ...grpc.CallOption) (*ListURLResponse, error)
 	DeleteURL(ctx context.Context, in *DeleteURLRequest, opts ...grpc.CallOption) (*DeleteURLResponse, error)
+	GetDeleteJob(ctx context.Context, in *GetDeleteJobRequest, opts ...grpc.CallOption) (*DeleteJob, error)
+	RestoreURL(ctx context.Context, in *RestoreURLRequest, opts ...grpc.CallOption) (*RestoreURLResponse, error)
+	LinkStats(ctx context.Context, in *LinkStatsRequest, opts ...grpc.CallOption) (*LinkStatsResponse, error)
 	Stats(ctx context.Context, in *StatsRequest, opts ...grpc.CallOption) (*StatsResponse, error)
 }
 
@@ -121,6 +127,36 @@ func (c *sortenerClient) DeleteURL(ctx context.Context, in *DeleteURLRequest, op
 	return out, nil
 }
 
+func (c *sortenerClient) GetDeleteJob(ctx context.Context, in *GetDeleteJobRequest, opts ...grpc.CallOption) (*DeleteJob, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(DeleteJob)
+	err := c.cc.Invoke(ctx, Sortener_GetDeleteJob_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *sortenerClient) RestoreURL(ctx context.Context, in *RestoreURLRequest, opts ...grpc.CallOption) (*RestoreURLResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(RestoreURLResponse)
+	err := c.cc.Invoke(ctx, Sortener_RestoreURL_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *sortenerClient) LinkStats(ctx context.Context, in *LinkStatsRequest, opts ...grpc.CallOption) (*LinkStatsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(LinkStatsResponse)
+	err := c.cc.Invoke(ctx, Sortener_LinkStats_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 func (c *sortenerClient) Stats(ctx context.Context, in *StatsRequest, opts ...grpc.CallOption) (*StatsResponse, error) {
 	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
 	out := new(StatsResponse)
@@ -142,6 +178,9 @@ type SortenerServer interface {
 	PingDB(context.Context, *PingDBRequest) (*PingDBResponse, error)
 	ListURL(context.Context, *ListURLRequest) (*ListURLResponse, error)
 	DeleteURL(context.Context, *DeleteURLRequest) (*DeleteURLResponse, error)
+	GetDeleteJob(context.Context, *GetDeleteJobRequest) (*DeleteJob, error)
+	RestoreURL(context.Context, *RestoreURLRequest) (*RestoreURLResponse, error)
+	LinkStats(context.Context, *LinkStatsRequest) (*LinkStatsResponse, error)
 	Stats(context.Context, *StatsRequest) (*StatsResponse, error)
 	mustEmbedUnimplementedSortenerServer()
 }
@@ -174,6 +213,15 @@ func (UnimplementedSortenerServer) ListURL(context.Context, *ListURLRequest) (*L
 func (UnimplementedSortenerServer) DeleteURL(context.Context, *DeleteURLRequest) (*DeleteURLResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method DeleteURL not implemented")
 }
+func (UnimplementedSortenerServer) GetDeleteJob(context.Context, *GetDeleteJobRequest) (*DeleteJob, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetDeleteJob not implemented")
+}
+func (UnimplementedSortenerServer) RestoreURL(context.Context, *RestoreURLRequest) (*RestoreURLResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RestoreURL not implemented")
+}
+func (UnimplementedSortenerServer) LinkStats(context.Context, *LinkStatsRequest) (*LinkStatsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method LinkStats not implemented")
+}
 func (UnimplementedSortenerServer) Stats(context.Context, *StatsRequest) (*StatsResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method Stats not implemented")
 }
@@ -324,6 +372,60 @@ func _Sortener_DeleteURL_Handler(srv interface{}, ctx context.Context, dec func(
 	return interceptor(ctx, in, info, handler)
 }
 
+func _Sortener_GetDeleteJob_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetDeleteJobRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SortenerServer).GetDeleteJob(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Sortener_GetDeleteJob_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SortenerServer).GetDeleteJob(ctx, req.(*GetDeleteJobRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Sortener_RestoreURL_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RestoreURLRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SortenerServer).RestoreURL(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Sortener_RestoreURL_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SortenerServer).RestoreURL(ctx, req.(*RestoreURLRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Sortener_LinkStats_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(LinkStatsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SortenerServer).LinkStats(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Sortener_LinkStats_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SortenerServer).LinkStats(ctx, req.(*LinkStatsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 func _Sortener_Stats_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
 	in := new(StatsRequest)
 	if err := dec(in); err != nil {
@@ -377,6 +479,18 @@ var Sortener_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "DeleteURL",
 			Handler:    _Sortener_DeleteURL_Handler,
 		},
+		{
+			MethodName: "GetDeleteJob",
+			Handler:    _Sortener_GetDeleteJob_Handler,
+		},
+		{
+			MethodName: "RestoreURL",
+			Handler:    _Sortener_RestoreURL_Handler,
+		},
+		{
+			MethodName: "LinkStats",
+			Handler:    _Sortener_LinkStats_Handler,
+		},
 		{
 			MethodName: "Stats",
 			Handler:    _Sortener_Stats_Handler,
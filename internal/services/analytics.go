@@ -0,0 +1,208 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"sort"
+	"time"
+
+	"github.com/darkseear/shortener/internal/models"
+)
+
+// ErrInvalidStatsQuery - некорректный период или интервал в запросе статистики.
+var ErrInvalidStatsQuery = errors.New("invalid stats query")
+
+// Параметры статистики переходов по умолчанию.
+const (
+	defaultStatsRange = 7 * 24 * time.Hour
+	defaultStatsTop   = 10
+	maxStatsBuckets   = 24 * 366
+)
+
+// NewLinkStatsQuery - разбирает параметры запроса статистики ссылки.
+// from и to задаются в RFC3339, по умолчанию период - последние 7 дней до now.
+// bucket - hour или day, по умолчанию day. Период выравнивается по границам интервалов в UTC.
+func NewLinkStatsQuery(shortURL string, userID string, from string, to string, bucket string, now time.Time) (models.LinkStatsQuery, error) {
+	q := models.LinkStatsQuery{ShortURL: shortURL, UserID: userID, Bucket: bucket, Top: defaultStatsTop}
+	if q.Bucket == "" {
+		q.Bucket = models.StatsBucketDay
+	}
+	step, ok := bucketSize(q.Bucket)
+	if !ok {
+		return q, fmt.Errorf("%w: bucket must be hour or day", ErrInvalidStatsQuery)
+	}
+
+	q.To = now
+	if to != "" {
+		t, err := time.Parse(time.RFC3339, to)
+		if err != nil {
+			return q, fmt.Errorf("%w: to: %v", ErrInvalidStatsQuery, err)
+		}
+		q.To = t
+	}
+	q.From = q.To.Add(-defaultStatsRange)
+	if from != "" {
+		t, err := time.Parse(time.RFC3339, from)
+		if err != nil {
+			return q, fmt.Errorf("%w: from: %v", ErrInvalidStatsQuery, err)
+		}
+		q.From = t
+	}
+
+	q.From = q.From.UTC().Truncate(step)
+	if end := q.To.UTC().Truncate(step); end.Equal(q.To.UTC()) {
+		q.To = end
+	} else {
+		q.To = end.Add(step)
+	}
+	if !q.From.Before(q.To) {
+		return q, fmt.Errorf("%w: from must be before to", ErrInvalidStatsQuery)
+	}
+	if q.To.Sub(q.From)/step > maxStatsBuckets {
+		return q, fmt.Errorf("%w: period is longer than %d buckets", ErrInvalidStatsQuery, maxStatsBuckets)
+	}
+	return q, nil
+}
+
+// bucketSize - возвращает длительность интервала статистики.
+func bucketSize(bucket string) (time.Duration, bool) {
+	switch bucket {
+	case models.StatsBucketHour:
+		return time.Hour, true
+	case models.StatsBucketDay:
+		return 24 * time.Hour, true
+	}
+	return 0, false
+}
+
+// visitorDay - возвращает сутки в UTC, в скетч уникальных посетителей которых попадает момент t.
+func visitorDay(t time.Time) time.Time {
+	return t.UTC().Truncate(24 * time.Hour)
+}
+
+// visitorDays - возвращает первые и последние сутки скетчей, пересекающихся с периодом запроса.
+func visitorDays(q models.LinkStatsQuery) (time.Time, time.Time) {
+	return visitorDay(q.From), visitorDay(q.To.Add(-time.Nanosecond))
+}
+
+// clickKey - ссылка и час агрегата переходов в UTC.
+type clickKey struct {
+	shortURL string
+	hour     time.Time
+}
+
+// clickAggregate - переходы по ссылке за час: количество и их число по источникам и браузерам.
+// По часовым агрегатам считается статистика с интервалами hour и day без хранения самих событий.
+type clickAggregate struct {
+	clicks     int64
+	referrers  map[string]int64
+	userAgents map[string]int64
+}
+
+// newClickAggregate - конструктор для создания пустого агрегата переходов.
+func newClickAggregate() *clickAggregate {
+	return &clickAggregate{referrers: make(map[string]int64), userAgents: make(map[string]int64)}
+}
+
+// Merge - прибавляет к агрегату переходы other.
+func (a *clickAggregate) Merge(other *clickAggregate) {
+	a.clicks += other.clicks
+	for v, c := range other.referrers {
+		a.referrers[v] += c
+	}
+	for v, c := range other.userAgents {
+		a.userAgents[v] += c
+	}
+}
+
+// clickAggregateRecord - возвращает копию агрегата переходов в виде записи файла переходов.
+func clickAggregateRecord(key clickKey, agg *clickAggregate) models.ClickAggregate {
+	return models.ClickAggregate{
+		ShortURL:   key.shortURL,
+		Hour:       key.hour,
+		Clicks:     agg.clicks,
+		Referrers:  maps.Clone(agg.referrers),
+		UserAgents: maps.Clone(agg.userAgents),
+	}
+}
+
+// groupClicks - собирает агрегаты переходов из событий по ссылкам и часам.
+// Пустые источники и браузеры не учитываются, так как не попадают в топы статистики.
+func groupClicks(events []models.ClickEvent) map[clickKey]*clickAggregate {
+	aggregates := make(map[clickKey]*clickAggregate)
+	for _, ev := range events {
+		key := clickKey{shortURL: ev.ShortURL, hour: ev.At.UTC().Truncate(time.Hour)}
+		agg, ok := aggregates[key]
+		if !ok {
+			agg = newClickAggregate()
+			aggregates[key] = agg
+		}
+		agg.clicks++
+		if ev.Referrer != "" {
+			agg.referrers[ev.Referrer]++
+		}
+		if ev.UserAgent != "" {
+			agg.userAgents[ev.UserAgent]++
+		}
+	}
+	return aggregates
+}
+
+// visitorKey - ссылка и сутки скетча уникальных посетителей.
+type visitorKey struct {
+	shortURL string
+	day      time.Time
+}
+
+// groupVisitors - собирает скетчи уникальных посетителей из событий по ссылкам и суткам.
+// События без хеша адреса не учитываются.
+func groupVisitors(events []models.ClickEvent) map[visitorKey]*hyperLogLog {
+	sketches := make(map[visitorKey]*hyperLogLog)
+	for _, ev := range events {
+		if ev.IPHash == "" {
+			continue
+		}
+		key := visitorKey{shortURL: ev.ShortURL, day: visitorDay(ev.At)}
+		sketch, ok := sketches[key]
+		if !ok {
+			sketch = newHyperLogLog()
+			sketches[key] = sketch
+		}
+		sketch.Add(ev.IPHash)
+	}
+	return sketches
+}
+
+// fillSeries - возвращает все интервалы периода запроса с количеством переходов из counts.
+// Ключ counts - начало интервала в UTC.
+func fillSeries(q models.LinkStatsQuery, counts map[time.Time]int64) []models.ClickBucket {
+	step, _ := bucketSize(q.Bucket)
+	series := make([]models.ClickBucket, 0, q.To.Sub(q.From)/step)
+	for t := q.From; t.Before(q.To); t = t.Add(step) {
+		series = append(series, models.ClickBucket{Start: t, Clicks: counts[t]})
+	}
+	return series
+}
+
+// topCounts - возвращает до n самых частых значений, при равенстве - в алфавитном порядке.
+// Пустые значения не учитываются.
+func topCounts(counts map[string]int64, n int) []models.CountItem {
+	items := make([]models.CountItem, 0, len(counts))
+	for v, c := range counts {
+		if v == "" {
+			continue
+		}
+		items = append(items, models.CountItem{Value: v, Count: c})
+	}
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].Count != items[j].Count {
+			return items[i].Count > items[j].Count
+		}
+		return items[i].Value < items[j].Value
+	})
+	if len(items) > n {
+		items = items[:n]
+	}
+	return items
+}
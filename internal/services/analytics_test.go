@@ -0,0 +1,94 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/darkseear/shortener/internal/config"
+	"github.com/darkseear/shortener/internal/models"
+)
+
+func TestNewLinkStatsQuery(t *testing.T) {
+	now := time.Date(2024, 3, 10, 15, 30, 0, 0, time.UTC)
+	day := func(d int) time.Time { return time.Date(2024, 3, d, 0, 0, 0, 0, time.UTC) }
+
+	tests := []struct {
+		name     string
+		from     string
+		to       string
+		bucket   string
+		wantFrom time.Time
+		wantTo   time.Time
+		wantErr  bool
+	}{
+		{name: "defaults", wantFrom: day(3), wantTo: day(11)},
+		{
+			name:     "hour buckets",
+			from:     "2024-03-10T10:15:00Z",
+			to:       "2024-03-10T12:00:00Z",
+			bucket:   models.StatsBucketHour,
+			wantFrom: time.Date(2024, 3, 10, 10, 0, 0, 0, time.UTC),
+			wantTo:   time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC),
+		},
+		{name: "time zone", from: "2024-03-05T01:00:00+03:00", to: "2024-03-06T00:00:00Z", wantFrom: day(4), wantTo: day(6)},
+		{name: "bad bucket", bucket: "week", wantErr: true},
+		{name: "bad time", from: "yesterday", wantErr: true},
+		{name: "empty period", from: "2024-03-06T00:00:00Z", to: "2024-03-05T00:00:00Z", wantErr: true},
+		{name: "too long", from: "2020-01-01T00:00:00Z", bucket: models.StatsBucketHour, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, err := NewLinkStatsQuery("code", "1", tt.from, tt.to, tt.bucket, now)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrInvalidStatsQuery)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantFrom, q.From)
+			assert.Equal(t, tt.wantTo, q.To)
+		})
+	}
+}
+
+func TestMemoryStorageLinkStats(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemoryStorage(&config.Config{URL: "http://localhost:8080"})
+	short, err := m.ShortenURL(ctx, "https://yandex.ru", "1", models.ShortenOptions{})
+	require.NoError(t, err)
+
+	at := time.Date(2024, 3, 10, 10, 30, 0, 0, time.UTC)
+	click := func(at time.Time, referrer string, ip string) models.ClickEvent {
+		ev := NewClickEvent(short, referrer, "curl", ip, "secret")
+		ev.At = at
+		return ev
+	}
+	require.NoError(t, m.RecordClicks(ctx, []models.ClickEvent{
+		click(at, "https://google.com", "10.0.0.1"),
+		click(at.Add(time.Minute), "https://google.com", "10.0.0.1"),
+		click(at.Add(time.Hour), "https://ya.ru", "10.0.0.2"),
+		click(at.Add(-24*time.Hour), "", "10.0.0.3"),
+	}))
+
+	q, err := NewLinkStatsQuery(short, "1", "2024-03-10T10:00:00Z", "2024-03-10T13:00:00Z", models.StatsBucketHour, at)
+	require.NoError(t, err)
+	stats, err := m.LinkStats(ctx, q)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), stats.TotalClicks)
+	assert.Equal(t, int64(2), stats.UniqueVisitors)
+	assert.Equal(t, []models.ClickBucket{
+		{Start: at.Truncate(time.Hour), Clicks: 2},
+		{Start: at.Truncate(time.Hour).Add(time.Hour), Clicks: 1},
+		{Start: at.Truncate(time.Hour).Add(2 * time.Hour), Clicks: 0},
+	}, stats.Series)
+	assert.Equal(t, []models.CountItem{{Value: "https://google.com", Count: 2}, {Value: "https://ya.ru", Count: 1}}, stats.TopReferrers)
+	assert.Equal(t, []models.CountItem{{Value: "curl", Count: 3}}, stats.TopUserAgents)
+
+	// Статистика чужой ссылки недоступна.
+	q.UserID = "2"
+	_, err = m.LinkStats(ctx, q)
+	assert.ErrorIs(t, err, ErrNotFound)
+}
@@ -0,0 +1,35 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+
+	"github.com/darkseear/shortener/internal/models"
+)
+
+// ipHashLength - длина хеша IP-адреса в байтах, достаточная для подсчета уникальных посетителей.
+const ipHashLength = 16
+
+// HashClientIP - возвращает HMAC-SHA256 IP-адреса клиента с ключом salt.
+// Сам адрес не сохраняется, а без ключа хеш нельзя сопоставить с адресом перебором.
+func HashClientIP(ip string, salt string) string {
+	if ip == "" {
+		return ""
+	}
+	mac := hmac.New(sha256.New, []byte(salt))
+	mac.Write([]byte(ip))
+	return hex.EncodeToString(mac.Sum(nil)[:ipHashLength])
+}
+
+// NewClickEvent - создает событие перехода по ссылке в текущий момент.
+func NewClickEvent(shortURL string, referrer string, userAgent string, ip string, salt string) models.ClickEvent {
+	return models.ClickEvent{
+		ShortURL:  shortURL,
+		At:        time.Now().UTC(),
+		Referrer:  referrer,
+		UserAgent: userAgent,
+		IPHash:    HashClientIP(ip, salt),
+	}
+}
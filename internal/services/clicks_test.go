@@ -0,0 +1,131 @@
+package services
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/darkseear/shortener/internal/config"
+	"github.com/darkseear/shortener/internal/models"
+)
+
+func TestHashClientIP(t *testing.T) {
+	h := HashClientIP("192.168.1.1", "secret")
+	assert.Len(t, h, ipHashLength*2)
+	assert.Equal(t, h, HashClientIP("192.168.1.1", "secret"))
+	assert.NotEqual(t, h, HashClientIP("192.168.1.1", "other"))
+	assert.NotEqual(t, h, HashClientIP("192.168.1.2", "secret"))
+	assert.Empty(t, HashClientIP("", "secret"))
+}
+
+func TestFileStoreClicks(t *testing.T) {
+	ctx := context.Background()
+	file := filepath.Join(t.TempDir(), "memory.log")
+	cfg := &config.Config{}
+
+	f, err := NewFileStore(file, cfg)
+	require.NoError(t, err)
+	short1, _ := f.ShortenURL(ctx, "https://yandex.ru", "1", models.ShortenOptions{})
+	short2, _ := f.ShortenURL(ctx, "https://ya.ru", "1", models.ShortenOptions{})
+	for i := 0; i < 3; i++ {
+		require.NoError(t, f.RecordClicks(ctx, []models.ClickEvent{
+			NewClickEvent(short1, "https://google.com", "curl", "10.0.0.1", "secret"),
+			NewClickEvent(short2, "", "curl", "10.0.0.2", "secret"),
+			NewClickEvent("unknown", "", "curl", "10.0.0.3", "secret"),
+		}))
+	}
+	require.NoError(t, f.DeleteURLByUserID(ctx, []string{short2}, "1"))
+	_, err = f.PurgeDeleted(ctx, time.Now(), 10)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	// После перезапуска остаются только переходы существующих ссылок, прирост складывается.
+	f, err = NewFileStore(file, cfg)
+	require.NoError(t, err)
+	defer f.Close()
+	clicks := f.index.allClicks()
+	require.Len(t, clicks, 1)
+	assert.Equal(t, short1, clicks[0].ShortURL)
+	assert.Equal(t, int64(3), clicks[0].Clicks)
+	assert.Equal(t, map[string]int64{"https://google.com": 3}, clicks[0].Referrers)
+
+	// Сжатие оставляет по одной строке на агрегат.
+	require.NoError(t, f.CompactClicks())
+	var lines []models.ClickAggregate
+	_, err = LoadClicksFile(f.ClicksFile, func(r *models.ClickAggregate) {
+		lines = append(lines, *r)
+	})
+	require.NoError(t, err)
+	assert.Equal(t, clicks, lines)
+}
+
+func TestFileStoreVisitors(t *testing.T) {
+	ctx := context.Background()
+	file := filepath.Join(t.TempDir(), "memory.log")
+	cfg := &config.Config{}
+
+	f, err := NewFileStore(file, cfg)
+	require.NoError(t, err)
+	short, _ := f.ShortenURL(ctx, "https://yandex.ru", "1", models.ShortenOptions{})
+	require.NoError(t, f.RecordClicks(ctx, []models.ClickEvent{
+		NewClickEvent(short, "", "curl", "10.0.0.1", "secret"),
+		NewClickEvent(short, "", "curl", "10.0.0.2", "secret"),
+	}))
+	require.NoError(t, f.RecordClicks(ctx, []models.ClickEvent{
+		NewClickEvent(short, "", "curl", "10.0.0.1", "secret"),
+		NewClickEvent(short, "", "curl", "10.0.0.3", "secret"),
+	}))
+	require.NoError(t, f.Close())
+
+	// Скетчи посетителей восстанавливаются из своего файла без событий переходов.
+	require.NoError(t, os.Truncate(f.ClicksFile, 0))
+	f, err = NewFileStore(file, cfg)
+	require.NoError(t, err)
+	defer f.Close()
+
+	q, err := NewLinkStatsQuery(short, "1", "", "", models.StatsBucketDay, time.Now())
+	require.NoError(t, err)
+	stats, err := f.LinkStats(ctx, q)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), stats.UniqueVisitors)
+	assert.Equal(t, int64(0), stats.TotalClicks)
+}
+
+func TestFileStoreClicksPurgedCode(t *testing.T) {
+	ctx := context.Background()
+	file := filepath.Join(t.TempDir(), "memory.log")
+	cfg := &config.Config{}
+
+	f, err := NewFileStore(file, cfg)
+	require.NoError(t, err)
+	_, err = f.ShortenURL(ctx, "https://yandex.ru", "1", models.ShortenOptions{Alias: "promo"})
+	require.NoError(t, err)
+	require.NoError(t, f.RecordClicks(ctx, []models.ClickEvent{
+		NewClickEvent("promo", "", "curl", "10.0.0.1", "secret"),
+		NewClickEvent("promo", "", "curl", "10.0.0.2", "secret"),
+	}))
+	require.NoError(t, f.DeleteURLByUserID(ctx, []string{"promo"}, "1"))
+	_, err = f.PurgeDeleted(ctx, time.Now(), 10)
+	require.NoError(t, err)
+
+	// Освободившийся адрес занимает новая ссылка, переходы удаленной ей не достаются и после перезапуска.
+	_, err = f.ShortenURL(ctx, "https://ya.ru", "2", models.ShortenOptions{Alias: "promo"})
+	require.NoError(t, err)
+	require.NoError(t, f.RecordClicks(ctx, []models.ClickEvent{NewClickEvent("promo", "", "curl", "10.0.0.3", "secret")}))
+	require.NoError(t, f.Close())
+
+	f, err = NewFileStore(file, cfg)
+	require.NoError(t, err)
+	defer f.Close()
+	q, err := NewLinkStatsQuery("promo", "2", "", "", models.StatsBucketDay, time.Now())
+	require.NoError(t, err)
+	stats, err := f.LinkStats(ctx, q)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), stats.TotalClicks)
+	assert.Equal(t, int64(1), stats.UniqueVisitors)
+}
@@ -0,0 +1,266 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/darkseear/shortener/internal/config"
+)
+
+// Типы генераторов коротких адресов, выбираются в конфигурации.
+const (
+	GeneratorRandom  = "random"
+	GeneratorCounter = "counter"
+	GeneratorHash    = "hash"
+)
+
+// DefaultAlphabet - алфавит base62, используемый, если в конфигурации алфавит не задан.
+const DefaultAlphabet = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// DefaultCodeLength - длина короткого адреса по умолчанию.
+const DefaultCodeLength = 8
+
+// maxCodeLength - максимальная длина короткого адреса, ограничена колонкой shorten в базе данных.
+const maxCodeLength = 50
+
+// maxGenerateAttempts - количество попыток сгенерировать свободный короткий адрес.
+const maxGenerateAttempts = 5
+
+// ErrCodeCollision - не удалось сгенерировать свободный короткий адрес за maxGenerateAttempts попыток.
+var ErrCodeCollision = errors.New("failed to generate unique short code")
+
+// CodeGenerator - генератор коротких адресов.
+// attempt - номер попытки начиная с 0, при коллизии хранилище повторяет генерацию со следующим номером.
+type CodeGenerator interface {
+	Generate(ctx context.Context, longURL string, attempt int) (string, error)
+}
+
+// Sequence - источник возрастающих номеров для CounterGenerator.
+type Sequence func(ctx context.Context) (int64, error)
+
+// NewCodeGenerator - создает генератор коротких адресов по конфигурации.
+// seq используется счетчиком, если он nil, счетчик хранится в памяти процесса.
+func NewCodeGenerator(cfg *config.Config, seq Sequence) (CodeGenerator, error) {
+	alphabet := cfg.ShortCodeAlphabet
+	if alphabet == "" {
+		alphabet = DefaultAlphabet
+	}
+	length := cfg.ShortCodeLength
+	if length == 0 {
+		length = DefaultCodeLength
+	}
+	if err := validateAlphabet(alphabet); err != nil {
+		return nil, err
+	}
+	if length < 1 || length > maxCodeLength {
+		return nil, fmt.Errorf("short code length must be between 1 and %d, got %d", maxCodeLength, length)
+	}
+
+	switch cfg.ShortCodeGenerator {
+	case "", GeneratorRandom:
+		return &RandomGenerator{alphabet: alphabet, length: length}, nil
+	case GeneratorCounter:
+		g := &CounterGenerator{alphabet: alphabet, length: length, next: seq}
+		if seq == nil {
+			g.mem = NewMemorySequence()
+			g.next = g.mem.Next
+		}
+		return g, nil
+	case GeneratorHash:
+		return &HashGenerator{alphabet: alphabet, length: length}, nil
+	default:
+		return nil, fmt.Errorf("unknown short code generator %q", cfg.ShortCodeGenerator)
+	}
+}
+
+// ValidateCodeGenerator - проверяет настройки генератора коротких адресов в конфигурации.
+func ValidateCodeGenerator(cfg *config.Config) error {
+	_, err := NewCodeGenerator(cfg, nil)
+	return err
+}
+
+// validateAlphabet - проверяет, что в алфавите не меньше двух символов ASCII без повторов
+// и без символов, которые нельзя использовать в пути URL.
+func validateAlphabet(alphabet string) error {
+	if len(alphabet) < 2 {
+		return errors.New("short code alphabet must contain at least 2 characters")
+	}
+	seen := make(map[rune]bool, len(alphabet))
+	for _, c := range alphabet {
+		if c > 127 || strings.ContainsRune("/?#% ", c) {
+			return fmt.Errorf("short code alphabet contains invalid character %q", c)
+		}
+		if seen[c] {
+			return fmt.Errorf("short code alphabet contains duplicate character %q", c)
+		}
+		seen[c] = true
+	}
+	return nil
+}
+
+// RandomGenerator - генерирует случайные короткие адреса заданной длины из алфавита.
+type RandomGenerator struct {
+	alphabet string
+	length   int
+}
+
+// Generate - возвращает случайный короткий адрес, longURL и attempt не используются.
+func (g *RandomGenerator) Generate(ctx context.Context, longURL string, attempt int) (string, error) {
+	n := len(g.alphabet)
+	// Байты из "хвоста" диапазона отбрасываются, чтобы символы были распределены равномерно.
+	limit := 256 - 256%n
+	code := make([]byte, 0, g.length)
+	buf := make([]byte, g.length*2)
+	for len(code) < g.length {
+		if _, err := rand.Read(buf); err != nil {
+			return "", err
+		}
+		for _, b := range buf {
+			if int(b) >= limit {
+				continue
+			}
+			code = append(code, g.alphabet[int(b)%n])
+			if len(code) == g.length {
+				break
+			}
+		}
+	}
+	return string(code), nil
+}
+
+// CounterGenerator - кодирует в алфавите очередное значение счетчика.
+// Короткие адреса дополняются слева до заданной длины и становятся длиннее после ее исчерпания.
+type CounterGenerator struct {
+	alphabet string
+	length   int
+	next     Sequence
+	mem      *MemorySequence
+}
+
+// Generate - возвращает короткий адрес для следующего значения счетчика.
+func (g *CounterGenerator) Generate(ctx context.Context, longURL string, attempt int) (string, error) {
+	n, err := g.next(ctx)
+	if err != nil {
+		return "", err
+	}
+	return padCode(encode(big.NewInt(n), g.alphabet), g.alphabet, g.length), nil
+}
+
+// Observe - сдвигает счетчик в памяти за значение существующего короткого адреса.
+// Используется при загрузке файлового хранилища, чтобы новые адреса не совпадали с уже выданными.
+// Адреса, которые генератор не мог выдать (другой длины, с лишним символом дополнения
+// или вне алфавита), пропускаются. Для счетчика в базе данных ничего не делает.
+func (g *CounterGenerator) Observe(code string) {
+	if g.mem == nil || !g.issued(code) {
+		return
+	}
+	if v, ok := decode(code, g.alphabet); ok {
+		g.mem.observe(v)
+	}
+}
+
+// issued - проверяет, мог ли короткий адрес быть выдан генератором: адреса короче длины
+// дополняются до нее, а длиннее становятся, только когда значение перестает в нее помещаться.
+func (g *CounterGenerator) issued(code string) bool {
+	switch {
+	case len(code) < g.length:
+		return false
+	case len(code) > g.length:
+		return code[:1] != g.alphabet[:1]
+	}
+	return true
+}
+
+// HashGenerator - строит короткий адрес из SHA-256 длинного URL.
+// Хранилища возвращают уже выданный адрес для сокращенного URL, поэтому один и тот же URL
+// получает один и тот же адрес. Номер попытки добавляется к URL только при совпадении адресов разных URL.
+type HashGenerator struct {
+	alphabet string
+	length   int
+}
+
+// Generate - возвращает короткий адрес, вычисленный из longURL и attempt.
+func (g *HashGenerator) Generate(ctx context.Context, longURL string, attempt int) (string, error) {
+	data := longURL
+	if attempt > 0 {
+		data += "#" + strconv.Itoa(attempt)
+	}
+	sum := sha256.Sum256([]byte(data))
+	// Берем остаток от деления на base^length, чтобы все символы адреса были распределены равномерно.
+	space := new(big.Int).Exp(big.NewInt(int64(len(g.alphabet))), big.NewInt(int64(g.length)), nil)
+	v := new(big.Int).Mod(new(big.Int).SetBytes(sum[:]), space)
+	return padCode(encode(v, g.alphabet), g.alphabet, g.length), nil
+}
+
+// padCode - дополняет короткий адрес слева первым символом алфавита до заданной длины.
+func padCode(code string, alphabet string, length int) string {
+	if pad := length - len(code); pad > 0 {
+		return strings.Repeat(alphabet[:1], pad) + code
+	}
+	return code
+}
+
+// encode - записывает неотрицательное число в системе счисления с заданным алфавитом.
+func encode(v *big.Int, alphabet string) string {
+	base := big.NewInt(int64(len(alphabet)))
+	if v.Sign() == 0 {
+		return alphabet[:1]
+	}
+	v = new(big.Int).Set(v)
+	mod := new(big.Int)
+	var out []byte
+	for v.Sign() > 0 {
+		v.DivMod(v, base, mod)
+		out = append(out, alphabet[mod.Int64()])
+	}
+	for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+		out[i], out[j] = out[j], out[i]
+	}
+	return string(out)
+}
+
+// decode - переводит короткий адрес обратно в число, ok равен false, если символ не из алфавита.
+func decode(code string, alphabet string) (int64, bool) {
+	var v int64
+	base := int64(len(alphabet))
+	for _, c := range code {
+		idx := strings.IndexRune(alphabet, c)
+		if idx < 0 || v > (1<<62)/base {
+			return 0, false
+		}
+		v = v*base + int64(idx)
+	}
+	return v, true
+}
+
+// MemorySequence - счетчик в памяти процесса для CounterGenerator без базы данных.
+type MemorySequence struct {
+	v atomic.Int64
+}
+
+// NewMemorySequence - создает счетчик в памяти, первое значение равно 1.
+func NewMemorySequence() *MemorySequence {
+	return &MemorySequence{}
+}
+
+// Next - возвращает следующее значение счетчика.
+func (s *MemorySequence) Next(ctx context.Context) (int64, error) {
+	return s.v.Add(1), nil
+}
+
+// observe - сдвигает счетчик так, чтобы следующее значение было больше v.
+func (s *MemorySequence) observe(v int64) {
+	for {
+		cur := s.v.Load()
+		if cur >= v || s.v.CompareAndSwap(cur, v) {
+			return
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package services
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/darkseear/shortener/internal/config"
+	"github.com/darkseear/shortener/internal/models"
+)
+
+func TestNewCodeGenerator(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     config.Config
+		wantErr bool
+	}{
+		{name: "default", cfg: config.Config{}},
+		{name: "counter", cfg: config.Config{ShortCodeGenerator: GeneratorCounter}},
+		{name: "hash", cfg: config.Config{ShortCodeGenerator: GeneratorHash, ShortCodeLength: 12}},
+		{name: "unknown", cfg: config.Config{ShortCodeGenerator: "uuid"}, wantErr: true},
+		{name: "long", cfg: config.Config{ShortCodeLength: maxCodeLength + 1}, wantErr: true},
+		{name: "short alphabet", cfg: config.Config{ShortCodeAlphabet: "a"}, wantErr: true},
+		{name: "duplicate", cfg: config.Config{ShortCodeAlphabet: "abca"}, wantErr: true},
+		{name: "slash", cfg: config.Config{ShortCodeAlphabet: "ab/"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewCodeGenerator(&tt.cfg, nil)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestCodeGenerators(t *testing.T) {
+	ctx := context.Background()
+
+	random, err := NewCodeGenerator(&config.Config{ShortCodeAlphabet: "abc", ShortCodeLength: 10}, nil)
+	require.NoError(t, err)
+	code, err := random.Generate(ctx, "https://yandex.ru", 0)
+	require.NoError(t, err)
+	assert.Len(t, code, 10)
+	assert.Empty(t, strings.Trim(code, "abc"))
+
+	counter, err := NewCodeGenerator(&config.Config{ShortCodeGenerator: GeneratorCounter, ShortCodeAlphabet: "01", ShortCodeLength: 3}, nil)
+	require.NoError(t, err)
+	var codes []string
+	for i := 0; i < 9; i++ {
+		code, err := counter.Generate(ctx, "", 0)
+		require.NoError(t, err)
+		codes = append(codes, code)
+	}
+	assert.Equal(t, []string{"001", "010", "011", "100", "101", "110", "111", "1000", "1001"}, codes)
+
+	hash, err := NewCodeGenerator(&config.Config{ShortCodeGenerator: GeneratorHash}, nil)
+	require.NoError(t, err)
+	first, _ := hash.Generate(ctx, "https://yandex.ru", 0)
+	again, _ := hash.Generate(ctx, "https://yandex.ru", 0)
+	retry, _ := hash.Generate(ctx, "https://yandex.ru", 1)
+	assert.Len(t, first, DefaultCodeLength)
+	assert.Equal(t, first, again)
+	assert.NotEqual(t, first, retry)
+}
+
+func TestHashGeneratorCollision(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemoryStorage(&config.Config{ShortCodeGenerator: GeneratorHash})
+
+	// Повторное сокращение того же URL возвращает тот же адрес и конфликт.
+	short1, err := m.ShortenURL(ctx, "https://yandex.ru", "1", models.ShortenOptions{})
+	require.NoError(t, err)
+	short2, err := m.ShortenURL(ctx, "https://yandex.ru", "2", models.ShortenOptions{})
+	assert.ErrorIs(t, err, ErrConflict)
+	assert.Equal(t, short1, short2)
+
+	results, err := m.ShortenBatch(ctx, []models.BatchLongJSON{{CorrelationID: "1", LongJSON: "https://yandex.ru"}}, "1")
+	require.NoError(t, err)
+	assert.ErrorIs(t, results[0].Err, ErrConflict)
+	assert.Equal(t, short1, results[0].ShortURL)
+
+	// Адрес, занятый другим URL, дает коллизию и новый адрес со следующей попытки.
+	code, _ := m.gen.Generate(ctx, "https://ya.ru", 0)
+	m.put(code, &memoryRecord{LongURL: "https://other.ru"})
+	short3, err := m.ShortenURL(ctx, "https://ya.ru", "1", models.ShortenOptions{})
+	require.NoError(t, err)
+	assert.NotEqual(t, code, short3)
+}
+
+func TestCounterGeneratorFileReload(t *testing.T) {
+	ctx := context.Background()
+	file := filepath.Join(t.TempDir(), "memory.log")
+	cfg := &config.Config{ShortCodeGenerator: GeneratorCounter}
+
+	f, err := NewFileStore(file, cfg)
+	require.NoError(t, err)
+	short1, _ := f.ShortenURL(ctx, "https://yandex.ru", "1", models.ShortenOptions{})
+	_, err = f.ShortenURL(ctx, "https://go.dev", "1", models.ShortenOptions{Alias: "zzzzzzzz"})
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	// После перезапуска счетчик продолжается с последнего выданного адреса,
+	// выбранные пользователем адреса счетчик не сдвигают.
+	f, err = NewFileStore(file, cfg)
+	require.NoError(t, err)
+	defer f.Close()
+	short2, err := f.ShortenURL(ctx, "https://ya.ru", "1", models.ShortenOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "00000001", short1)
+	assert.Equal(t, "00000002", short2)
+}
+
+func TestCounterGeneratorObserve(t *testing.T) {
+	gen, err := NewCodeGenerator(&config.Config{ShortCodeGenerator: GeneratorCounter, ShortCodeLength: 3, ShortCodeAlphabet: "01"}, nil)
+	require.NoError(t, err)
+	counter := gen.(*CounterGenerator)
+
+	// Адреса, которые генератор не мог выдать, пропускаются.
+	for _, code := range []string{"11", "01111", "abc"} {
+		counter.Observe(code)
+	}
+	code, err := counter.Generate(context.Background(), "", 0)
+	require.NoError(t, err)
+	assert.Equal(t, "001", code)
+
+	counter.Observe("1001")
+	code, err = counter.Generate(context.Background(), "", 0)
+	require.NoError(t, err)
+	assert.Equal(t, "1010", code)
+}
@@ -0,0 +1,26 @@
+package services
+
+import "errors"
+
+// Ошибки хранилища, по которым обработчики HTTP и gRPC выбирают свой код ответа.
+var (
+	// ErrNotFound - короткая ссылка не найдена.
+	ErrNotFound = errors.New("url not found")
+	// ErrDeleted - короткая ссылка удалена владельцем.
+	ErrDeleted = errors.New("url is deleted")
+	// ErrExpired - срок жизни короткой ссылки истек.
+	ErrExpired = errors.New("url is expired")
+	// ErrClicksExhausted - исчерпано разрешенное число переходов по короткой ссылке.
+	ErrClicksExhausted = errors.New("url click limit reached")
+	// ErrPasswordRequired - ссылка защищена паролем, а пароль не передан.
+	ErrPasswordRequired = errors.New("password required")
+	// ErrWrongPassword - передан неверный пароль ссылки.
+	ErrWrongPassword = errors.New("wrong password")
+	// ErrConflict - длинный URL уже сокращен, вместе с ошибкой возвращается существующий короткий адрес.
+	ErrConflict = errors.New("url already shortened")
+	// ErrOptionsConflict - длинный URL уже сокращен, а для новой ссылки заданы параметры
+	// (адрес, срок жизни, лимит переходов или пароль), которые нельзя применить к существующей.
+	ErrOptionsConflict = errors.New("url already shortened, options cannot be applied")
+	// ErrAliasTaken - выбранный пользователем короткий адрес уже занят.
+	ErrAliasTaken = errors.New("alias already taken")
+)
@@ -0,0 +1,138 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"math"
+	"math/bits"
+)
+
+// ErrCorruptSketch - сериализованный скетч уникальных посетителей поврежден.
+var ErrCorruptSketch = errors.New("corrupt hyperloglog sketch")
+
+// hllPrecision - количество бит хеша для выбора регистра.
+// 2^12 регистров занимают 4 КБ и дают стандартную погрешность около 1,6%.
+const hllPrecision = 12
+
+// hllRegisters - количество регистров скетча.
+const hllRegisters = 1 << hllPrecision
+
+// Форматы сериализации скетча: разреженный хранит только ненулевые регистры.
+const (
+	hllFormatSparse byte = 1
+	hllFormatDense  byte = 2
+)
+
+// hyperLogLog - скетч HyperLogLog для приблизительного подсчета уникальных значений.
+// Размер скетча не зависит от количества добавленных значений, скетчи объединяются без потерь.
+type hyperLogLog struct {
+	registers [hllRegisters]uint8
+}
+
+// newHyperLogLog - конструктор для создания пустого скетча.
+func newHyperLogLog() *hyperLogLog {
+	return &hyperLogLog{}
+}
+
+// Add - добавляет значение в скетч.
+func (h *hyperLogLog) Add(value string) {
+	sum := sha256.Sum256([]byte(value))
+	x := binary.BigEndian.Uint64(sum[:8])
+	idx := x >> (64 - hllPrecision)
+	// Младший бит-ограничитель не дает ранговому счету выйти за пределы оставшихся бит.
+	rank := uint8(bits.LeadingZeros64(x<<hllPrecision|1<<(hllPrecision-1)) + 1)
+	if rank > h.registers[idx] {
+		h.registers[idx] = rank
+	}
+}
+
+// Merge - объединяет скетч с other, результат оценивает объединение множеств.
+func (h *hyperLogLog) Merge(other *hyperLogLog) {
+	for i, r := range other.registers {
+		if r > h.registers[i] {
+			h.registers[i] = r
+		}
+	}
+}
+
+// Estimate - возвращает оценку количества уникальных значений.
+// Для малых значений используется линейный подсчет по пустым регистрам.
+func (h *hyperLogLog) Estimate() int64 {
+	m := float64(hllRegisters)
+	sum, zeros := 0.0, 0
+	for _, r := range h.registers {
+		sum += math.Ldexp(1, -int(r))
+		if r == 0 {
+			zeros++
+		}
+	}
+	estimate := 0.7213 / (1 + 1.079/m) * m * m / sum
+	if estimate <= 2.5*m && zeros > 0 {
+		estimate = m * math.Log(m/float64(zeros))
+	}
+	return int64(math.Round(estimate))
+}
+
+// MarshalBinary - сериализует скетч: формат, точность и регистры.
+// Если ненулевых регистров мало, сохраняются только они парами индекс-значение.
+func (h *hyperLogLog) MarshalBinary() ([]byte, error) {
+	nonzero := 0
+	for _, r := range h.registers {
+		if r != 0 {
+			nonzero++
+		}
+	}
+	if nonzero*3 >= hllRegisters {
+		data := make([]byte, 2, 2+hllRegisters)
+		data[0], data[1] = hllFormatDense, hllPrecision
+		return append(data, h.registers[:]...), nil
+	}
+	data := make([]byte, 2, 2+nonzero*3)
+	data[0], data[1] = hllFormatSparse, hllPrecision
+	for i, r := range h.registers {
+		if r != 0 {
+			data = binary.BigEndian.AppendUint16(data, uint16(i))
+			data = append(data, r)
+		}
+	}
+	return data, nil
+}
+
+// UnmarshalBinary - восстанавливает скетч, сериализованный MarshalBinary.
+// Возвращает ErrCorruptSketch, если данные повреждены или точность отличается.
+func (h *hyperLogLog) UnmarshalBinary(data []byte) error {
+	if len(data) < 2 || data[1] != hllPrecision {
+		return ErrCorruptSketch
+	}
+	const maxRank = 64 - hllPrecision + 1
+	var registers [hllRegisters]uint8
+	body := data[2:]
+	switch data[0] {
+	case hllFormatDense:
+		if len(body) != hllRegisters {
+			return ErrCorruptSketch
+		}
+		copy(registers[:], body)
+	case hllFormatSparse:
+		if len(body)%3 != 0 {
+			return ErrCorruptSketch
+		}
+		for ; len(body) > 0; body = body[3:] {
+			idx := binary.BigEndian.Uint16(body)
+			if idx >= hllRegisters {
+				return ErrCorruptSketch
+			}
+			registers[idx] = body[2]
+		}
+	default:
+		return ErrCorruptSketch
+	}
+	for _, r := range registers {
+		if r > maxRank {
+			return ErrCorruptSketch
+		}
+	}
+	h.registers = registers
+	return nil
+}
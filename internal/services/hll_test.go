@@ -0,0 +1,56 @@
+package services
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHyperLogLog(t *testing.T) {
+	a, b := newHyperLogLog(), newHyperLogLog()
+	assert.Equal(t, int64(0), a.Estimate())
+
+	// Повторы не увеличивают оценку, малые количества считаются почти точно.
+	for i := 0; i < 3; i++ {
+		a.Add("visitor-1")
+		a.Add("visitor-2")
+	}
+	assert.Equal(t, int64(2), a.Estimate())
+
+	for i := 0; i < 50000; i++ {
+		a.Add("a-" + strconv.Itoa(i))
+		b.Add("b-" + strconv.Itoa(i))
+		b.Add("a-" + strconv.Itoa(i))
+	}
+	assert.InEpsilon(t, 50002, a.Estimate(), 0.05)
+	a.Merge(b)
+	assert.InEpsilon(t, 100002, a.Estimate(), 0.05)
+}
+
+func TestHyperLogLogMarshal(t *testing.T) {
+	small, large := newHyperLogLog(), newHyperLogLog()
+	small.Add("visitor")
+	for i := 0; i < 10000; i++ {
+		large.Add(strconv.Itoa(i))
+	}
+
+	for _, h := range []*hyperLogLog{small, large} {
+		data, err := h.MarshalBinary()
+		require.NoError(t, err)
+		got := newHyperLogLog()
+		require.NoError(t, got.UnmarshalBinary(data))
+		assert.Equal(t, h.registers, got.registers)
+	}
+
+	// Разреженный формат занимает несколько байт, плотный - не больше числа регистров.
+	data, _ := small.MarshalBinary()
+	assert.Len(t, data, 5)
+	data, _ = large.MarshalBinary()
+	assert.Len(t, data, 2+hllRegisters)
+
+	for _, data := range [][]byte{nil, {hllFormatSparse, 10}, {hllFormatSparse, hllPrecision, 0}, {3, hllPrecision}} {
+		assert.ErrorIs(t, newHyperLogLog().UnmarshalBinary(data), ErrCorruptSketch)
+	}
+}
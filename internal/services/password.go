@@ -0,0 +1,136 @@
+package services
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	// ErrInvalidPassword - пароль длиннее, чем может обработать bcrypt.
+	ErrInvalidPassword = errors.New("password must be at most 72 bytes")
+	// ErrTooManyAttempts - слишком много неверных паролей для ссылки, попытки временно запрещены.
+	ErrTooManyAttempts = errors.New("too many password attempts")
+)
+
+// maxPasswordLength - максимальная длина пароля в байтах, которую учитывает bcrypt.
+const maxPasswordLength = 72
+
+// Ограничение неверных паролей по умолчанию для HTTP и gRPC серверов.
+const (
+	PasswordMaxAttempts   = 5
+	PasswordAttemptWindow = 15 * time.Minute
+)
+
+// HashLinkPassword - возвращает bcrypt-хеш пароля ссылки, пустой пароль означает ссылку без пароля.
+func HashLinkPassword(password string) (string, error) {
+	if password == "" {
+		return "", nil
+	}
+	if len(password) > maxPasswordLength {
+		return "", ErrInvalidPassword
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// checkLinkPassword - проверяет пароль перехода по ссылке с хешем hash.
+// Для ссылки без пароля проверка всегда успешна.
+func checkLinkPassword(hash string, password string) error {
+	if hash == "" {
+		return nil
+	}
+	if password == "" {
+		return ErrPasswordRequired
+	}
+	if bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) != nil {
+		return ErrWrongPassword
+	}
+	return nil
+}
+
+// AttemptLimiter - ограничивает количество неверных паролей для каждого ключа попыток.
+// После max неудачных попыток за окно window новые попытки с этим ключом отклоняются до конца окна.
+// Ключ строится PasswordAttemptKey из ссылки и IP-адреса клиента, чтобы перебор с одного адреса
+// не блокировал ссылку для владельца и остальных клиентов.
+// Безопасен для конкурентного использования.
+type AttemptLimiter struct {
+	mu       sync.Mutex
+	max      int
+	window   time.Duration
+	attempts map[string]*attempts
+	pruned   time.Time
+}
+
+// attempts - неудачные попытки для одного ключа с начала окна.
+type attempts struct {
+	count int
+	start time.Time
+}
+
+// NewAttemptLimiter - конструктор для создания нового AttemptLimiter.
+func NewAttemptLimiter(max int, window time.Duration) *AttemptLimiter {
+	return &AttemptLimiter{max: max, window: window, attempts: make(map[string]*attempts)}
+}
+
+// PasswordAttemptKey - возвращает ключ попыток для ссылки shortURL и IP-адреса клиента ip.
+func PasswordAttemptKey(shortURL string, ip string) string {
+	return shortURL + "|" + ip
+}
+
+// Allow - возвращает ErrTooManyAttempts, если попытки для ключа исчерпаны.
+func (l *AttemptLimiter) Allow(key string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	a, ok := l.attempts[key]
+	if !ok {
+		return nil
+	}
+	if time.Since(a.start) >= l.window {
+		delete(l.attempts, key)
+		return nil
+	}
+	if a.count >= l.max {
+		return ErrTooManyAttempts
+	}
+	return nil
+}
+
+// Fail - учитывает неудачную попытку для ключа.
+func (l *AttemptLimiter) Fail(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	a, ok := l.attempts[key]
+	if !ok || now.Sub(a.start) >= l.window {
+		l.prune(now)
+		l.attempts[key] = &attempts{count: 1, start: now}
+		return
+	}
+	a.count++
+}
+
+// Reset - сбрасывает неудачные попытки ключа после успешного перехода.
+func (l *AttemptLimiter) Reset(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.attempts, key)
+}
+
+// prune - удаляет записи с закончившимся окном не чаще раза за окно, вызывается под блокировкой.
+func (l *AttemptLimiter) prune(now time.Time) {
+	if now.Sub(l.pruned) < l.window {
+		return
+	}
+	l.pruned = now
+	for key, a := range l.attempts {
+		if now.Sub(a.start) >= l.window {
+			delete(l.attempts, key)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/darkseear/shortener/internal/config"
+	"github.com/darkseear/shortener/internal/models"
+)
+
+func TestLinkPassword(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemoryStorage(&config.Config{URL: "http://localhost:8080"})
+
+	hash, err := HashLinkPassword("secret")
+	require.NoError(t, err)
+	short, err := m.ShortenURL(ctx, "https://yandex.ru", "1", models.ShortenOptions{PasswordHash: hash, MaxClicks: 1})
+	require.NoError(t, err)
+
+	_, err = m.GetOriginalURL(ctx, short, "1", "")
+	assert.ErrorIs(t, err, ErrPasswordRequired)
+	_, err = m.GetOriginalURL(ctx, short, "1", "wrong")
+	assert.ErrorIs(t, err, ErrWrongPassword)
+
+	// Неверный пароль не расходует переходы.
+	long, err := m.GetOriginalURL(ctx, short, "1", "secret")
+	require.NoError(t, err)
+	assert.Equal(t, "https://yandex.ru", long)
+
+	_, err = HashLinkPassword(string(make([]byte, maxPasswordLength+1)))
+	assert.ErrorIs(t, err, ErrInvalidPassword)
+}
+
+func TestAttemptLimiter(t *testing.T) {
+	l := NewAttemptLimiter(2, time.Hour)
+	require.NoError(t, l.Allow("a"))
+	l.Fail("a")
+	require.NoError(t, l.Allow("a"))
+	l.Fail("a")
+	assert.ErrorIs(t, l.Allow("a"), ErrTooManyAttempts)
+	assert.NoError(t, l.Allow("b"))
+
+	l.Reset("a")
+	assert.NoError(t, l.Allow("a"))
+
+	// После окна попытки снова разрешены.
+	l = NewAttemptLimiter(1, time.Millisecond)
+	l.Fail("a")
+	time.Sleep(2 * time.Millisecond)
+	assert.NoError(t, l.Allow("a"))
+}
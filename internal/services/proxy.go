@@ -0,0 +1,71 @@
+package services
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// TrustedProxies - подсети доверенных прокси.
+// Адресу клиента из заголовков X-Real-IP и метаданных client_ip верят, только если соединение пришло из этих подсетей.
+type TrustedProxies []*net.IPNet
+
+// ParseTrustedProxies - разбирает список подсетей доверенных прокси через запятую.
+// Элемент списка - подсеть CIDR или отдельный IP-адрес, пустая строка - нет доверенных прокси.
+func ParseTrustedProxies(list string) (TrustedProxies, error) {
+	var proxies TrustedProxies
+	for _, item := range strings.Split(list, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		if !strings.Contains(item, "/") {
+			ip := net.ParseIP(item)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q", item)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			proxies = append(proxies, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, subnet, err := net.ParseCIDR(item)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", item, err)
+		}
+		proxies = append(proxies, subnet)
+	}
+	return proxies, nil
+}
+
+// ClientIP - возвращает IP-адрес клиента по адресу соединения remoteAddr (host:port или host)
+// и адресу forwarded, переданному прокси. forwarded учитывается, только если соединение
+// пришло от доверенного прокси и forwarded - корректный IP-адрес.
+func (p TrustedProxies) ClientIP(remoteAddr string, forwarded string) string {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	if forwarded == "" || !p.contains(net.ParseIP(host)) {
+		return host
+	}
+	if ip := net.ParseIP(strings.TrimSpace(forwarded)); ip != nil {
+		return ip.String()
+	}
+	return host
+}
+
+// contains - проверяет, входит ли ip в одну из подсетей доверенных прокси.
+func (p TrustedProxies) contains(ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	for _, subnet := range p {
+		if subnet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
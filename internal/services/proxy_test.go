@@ -0,0 +1,33 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTrustedProxies(t *testing.T) {
+	proxies, err := ParseTrustedProxies("192.168.0.0/24, 10.1.1.1, ::1")
+	require.NoError(t, err)
+	require.Len(t, proxies, 3)
+
+	// Адрес из заголовка принимается только от доверенного прокси.
+	assert.Equal(t, "203.0.113.5", proxies.ClientIP("192.168.0.10:1234", "203.0.113.5"))
+	assert.Equal(t, "203.0.113.5", proxies.ClientIP("10.1.1.1:1234", "203.0.113.5"))
+	assert.Equal(t, "203.0.113.5", proxies.ClientIP("[::1]:1234", "203.0.113.5"))
+	assert.Equal(t, "10.1.1.2", proxies.ClientIP("10.1.1.2:1234", "203.0.113.5"))
+	assert.Equal(t, "192.168.0.10", proxies.ClientIP("192.168.0.10:1234", "not-an-ip"))
+	assert.Equal(t, "192.168.0.10", proxies.ClientIP("192.168.0.10", ""))
+
+	// Без доверенных прокси заголовок игнорируется.
+	assert.Equal(t, "10.0.0.1", TrustedProxies(nil).ClientIP("10.0.0.1:1234", "203.0.113.5"))
+
+	for _, list := range []string{"bad", "10.0.0.0/33"} {
+		_, err := ParseTrustedProxies(list)
+		assert.Error(t, err)
+	}
+	proxies, err = ParseTrustedProxies("")
+	require.NoError(t, err)
+	assert.Empty(t, proxies)
+}
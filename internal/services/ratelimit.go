@@ -0,0 +1,189 @@
+package services
+
+import (
+	"context"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/time/rate"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"github.com/darkseear/shortener/internal/logger"
+)
+
+// Операции с отдельными лимитами частоты запросов.
+const (
+	RateCreate   = "create"
+	RateRedirect = "redirect"
+	RateDelete   = "delete"
+)
+
+// rateLimiterIdle - минимальное время без запросов, после которого состояние ключа удаляется.
+const rateLimiterIdle = 10 * time.Minute
+
+// RetryAfterMetadataKey - ключ метаданных ответа gRPC со временем до повтора запроса в секундах.
+const RetryAfterMetadataKey = "retry-after"
+
+// RateLimit - лимит операции: Rate запросов в секунду в среднем и до Burst запросов подряд.
+// Нулевой Rate отключает ограничение операции, Burst меньше 1 считается равным 1.
+type RateLimit struct {
+	Rate  float64
+	Burst int
+}
+
+// RateLimiter - ограничивает частоту запросов по алгоритму token bucket
+// отдельно для каждой операции и каждого ключа (пользователя или IP-адреса клиента).
+// Безопасен для конкурентного использования.
+type RateLimiter struct {
+	mu      sync.Mutex
+	limits  map[string]RateLimit
+	buckets map[rateKey]*rateBucket
+	pruned  time.Time
+}
+
+// rateKey - операция и ключ клиента.
+type rateKey struct {
+	op  string
+	key string
+}
+
+// rateBucket - token bucket ключа и время последнего запроса.
+type rateBucket struct {
+	limiter *rate.Limiter
+	seen    time.Time
+}
+
+// NewRateLimiter - конструктор для создания нового RateLimiter с лимитами по операциям.
+func NewRateLimiter(limits map[string]RateLimit) *RateLimiter {
+	return &RateLimiter{limits: limits, buckets: make(map[rateKey]*rateBucket)}
+}
+
+// UserRateKey - возвращает ключ лимита для пользователя.
+func UserRateKey(userID string) string {
+	return "user:" + userID
+}
+
+// IPRateKey - возвращает ключ лимита для IP-адреса клиента.
+func IPRateKey(ip string) string {
+	return "ip:" + ip
+}
+
+// Allow - проверяет запрос операции op от клиента с ключами keys, пустые ключи пропускаются.
+// Запрос разрешен, только если его разрешают лимиты всех ключей, иначе токены не расходуются
+// и возвращается время, через которое запрос будет разрешен.
+func (l *RateLimiter) Allow(op string, keys ...string) (time.Duration, bool) {
+	limit, ok := l.limits[op]
+	if !ok || limit.Rate <= 0 {
+		return 0, true
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	l.prune(now)
+
+	reservations := make([]*rate.Reservation, 0, len(keys))
+	var wait time.Duration
+	for _, key := range keys {
+		if key == "" {
+			continue
+		}
+		b := l.bucket(rateKey{op: op, key: key}, limit, now)
+		r := b.limiter.ReserveN(now, 1)
+		reservations = append(reservations, r)
+		if delay := r.DelayFrom(now); delay > wait {
+			wait = delay
+		}
+	}
+	if wait == 0 {
+		return 0, true
+	}
+	for _, r := range reservations {
+		r.CancelAt(now)
+	}
+	return wait, false
+}
+
+// bucket - возвращает token bucket ключа, создавая его с полным запасом токенов, вызывается под блокировкой.
+func (l *RateLimiter) bucket(k rateKey, limit RateLimit, now time.Time) *rateBucket {
+	b, ok := l.buckets[k]
+	if !ok {
+		b = &rateBucket{limiter: rate.NewLimiter(rate.Limit(limit.Rate), max(limit.Burst, 1))}
+		l.buckets[k] = b
+	}
+	b.seen = now
+	return b
+}
+
+// prune - удаляет состояние ключей, не использованных дольше, чем нужно для восстановления всех токенов.
+// Выполняется не чаще раза в rateLimiterIdle, вызывается под блокировкой.
+func (l *RateLimiter) prune(now time.Time) {
+	if now.Sub(l.pruned) < rateLimiterIdle {
+		return
+	}
+	l.pruned = now
+	for k, b := range l.buckets {
+		idle := rateLimiterIdle
+		if limit := l.limits[k.op]; limit.Rate > 0 {
+			if refill := time.Duration(float64(limit.Burst) / limit.Rate * float64(time.Second)); refill > idle {
+				idle = refill
+			}
+		}
+		if now.Sub(b.seen) >= idle {
+			delete(l.buckets, k)
+		}
+	}
+}
+
+// RetryAfter - возвращает значение заголовка Retry-After: время ожидания в целых секундах с округлением вверх.
+func RetryAfter(wait time.Duration) string {
+	return strconv.FormatInt(int64(math.Ceil(wait.Seconds())), 10)
+}
+
+// UnaryRateLimitInterceptor - возвращает перехватчик gRPC, ограничивающий частоту вызовов.
+// ops сопоставляет полное имя метода с операцией, вызовы других методов не ограничиваются.
+// Пользователь берется из метаданных userid и учитывается, только если клиент прислал действительный токен,
+// поэтому перехватчик ставится после авторизации. Без токена лимит считается только по IP-адресу -
+// из адреса соединения или из метаданных client_ip, если соединение пришло от доверенного прокси.
+// При превышении лимита возвращается ResourceExhausted и заголовок retry-after.
+func (l *RateLimiter) UnaryRateLimitInterceptor(ops map[string]string, proxies TrustedProxies) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		op, ok := ops[info.FullMethod]
+		if !ok {
+			return handler(ctx, req)
+		}
+		var keys []string
+		if userID, err := GetUserIDFromMetadata(ctx); err == nil && TokenPresented(ctx) {
+			keys = append(keys, UserRateKey(userID))
+		}
+		if ip := PeerIP(ctx, proxies); ip != "" {
+			keys = append(keys, IPRateKey(ip))
+		}
+		wait, ok := l.Allow(op, keys...)
+		if ok {
+			return handler(ctx, req)
+		}
+		if err := grpc.SetHeader(ctx, metadata.Pairs(RetryAfterMetadataKey, RetryAfter(wait))); err != nil {
+			logger.FromContext(ctx).Error("set retry-after header error", zap.Error(err))
+		}
+		return nil, status.Error(codes.ResourceExhausted, "rate limit exceeded")
+	}
+}
+
+// PeerIP - возвращает IP-адрес клиента gRPC из адреса соединения.
+// Метаданные client_ip учитываются, только если соединение пришло от доверенного прокси.
+func PeerIP(ctx context.Context, proxies TrustedProxies) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ""
+	}
+	forwarded, _ := GetClientIPFromMetadata(ctx)
+	return proxies.ClientIP(p.Addr.String(), forwarded)
+}
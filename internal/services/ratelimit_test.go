@@ -0,0 +1,78 @@
+package services
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+func TestRateLimiter(t *testing.T) {
+	l := NewRateLimiter(map[string]RateLimit{
+		RateCreate: {Rate: 1, Burst: 2},
+		RateDelete: {Rate: 0, Burst: 1},
+	})
+	user, ip := UserRateKey("1"), IPRateKey("10.0.0.1")
+
+	// Запас токенов расходуется, затем запрос отклоняется со временем ожидания.
+	for i := 0; i < 2; i++ {
+		_, ok := l.Allow(RateCreate, user, ip)
+		assert.True(t, ok)
+	}
+	wait, ok := l.Allow(RateCreate, user, ip)
+	assert.False(t, ok)
+	assert.InDelta(t, time.Second, wait, float64(100*time.Millisecond))
+
+	// Другой пользователь с того же IP ограничен лимитом IP, а его собственный лимит не расходуется.
+	other := UserRateKey("2")
+	_, ok = l.Allow(RateCreate, other, ip)
+	assert.False(t, ok)
+	_, ok = l.Allow(RateCreate, other, IPRateKey("10.0.0.2"))
+	assert.True(t, ok)
+	_, ok = l.Allow(RateCreate, other, IPRateKey("10.0.0.3"))
+	assert.True(t, ok)
+
+	// Лимиты операций независимы, нулевой лимит и неизвестная операция не ограничиваются.
+	_, ok = l.Allow(RateRedirect, user, ip)
+	assert.True(t, ok)
+	for i := 0; i < 5; i++ {
+		_, ok = l.Allow(RateDelete, user, ip)
+		assert.True(t, ok)
+	}
+}
+
+func TestUnaryRateLimitInterceptor(t *testing.T) {
+	l := NewRateLimiter(map[string]RateLimit{RateCreate: {Rate: 0.5, Burst: 1}})
+	interceptor := l.UnaryRateLimitInterceptor(map[string]string{"/create": RateCreate}, nil)
+	info := &grpc.UnaryServerInfo{FullMethod: "/create"}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) { return "ok", nil }
+	call := func(ip string, presented bool) codes.Code {
+		ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("userid", "1"))
+		ctx = context.WithValue(ctx, contextKey("token_presented"), presented)
+		ctx = peer.NewContext(ctx, &peer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP(ip), Port: 1234}})
+		_, err := interceptor(ctx, nil, info, handler)
+		return status.Code(err)
+	}
+
+	// Пользователь, выданный без присланного токена, не учитывается: лимит считается по IP.
+	assert.Equal(t, codes.OK, call("10.0.0.1", false))
+	assert.Equal(t, codes.OK, call("10.0.0.2", false))
+	assert.Equal(t, codes.ResourceExhausted, call("10.0.0.2", false))
+
+	// Пользователь с присланным токеном ограничен и с другого IP.
+	assert.Equal(t, codes.OK, call("10.0.0.3", true))
+	assert.Equal(t, codes.ResourceExhausted, call("10.0.0.4", true))
+}
+
+func TestRetryAfter(t *testing.T) {
+	assert.Equal(t, "1", RetryAfter(10*time.Millisecond))
+	assert.Equal(t, "2", RetryAfter(1500*time.Millisecond))
+	assert.Equal(t, "0", RetryAfter(0))
+}
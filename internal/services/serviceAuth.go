@@ -73,11 +73,12 @@ func (s *AuthService) ValidateToken(tokenString string) (string, error) {
 
 // SetCookie - метод для установки куки с токеном.
 // Он принимает http.ResponseWriter и userID, генерирует токен и устанавливает его в куки.
-func (s *AuthService) SetCookie(w http.ResponseWriter, userID string) string {
+// Если токен сгенерировать не удалось, куки не устанавливается и возвращается ошибка,
+// ответ с ошибкой пишет вызывающий.
+func (s *AuthService) SetCookie(w http.ResponseWriter, userID string) (string, error) {
 	tokenString, err := s.GenerateToken(userID)
 	if err != nil {
-		http.Error(w, "Failed to generate token", http.StatusInternalServerError)
-		return ""
+		return "", err
 	}
 	http.SetCookie(w, &http.Cookie{
 		Name:     "auth_token",
@@ -85,30 +86,29 @@ func (s *AuthService) SetCookie(w http.ResponseWriter, userID string) string {
 		Expires:  time.Now().Add(72 * time.Hour),
 		HttpOnly: true,
 	})
-	return userID
+	return userID, nil
 }
 
 // IssueCookie - метод для проверки наличия куки и его валидности.
 // Если куки нет или он не валиден, то генерируется новый токен и устанавливается в куки.
-func (s *AuthService) IssueCookie(w http.ResponseWriter, r *http.Request, userID string) string {
+func (s *AuthService) IssueCookie(w http.ResponseWriter, r *http.Request, userID string) (string, error) {
 	cookie, err := r.Cookie("auth_token")
 	if err != nil || cookie == nil {
-		logger.Log.Info("Создаем и применяем новое куки если его нет")
-		UID := s.SetCookie(w, userID)
-		return UID
+		logger.FromContext(r.Context()).Info("Создаем и применяем новое куки если его нет")
+		return s.SetCookie(w, userID)
 	}
 
 	userID, err = s.ValidateToken(cookie.Value)
 	if err != nil {
-		logger.Log.Info("Токен не действителен")
-		UID := s.SetCookie(w, userID)
-		return UID
+		logger.FromContext(r.Context()).Info("Токен не действителен")
+		return s.SetCookie(w, userID)
 	}
 
-	return userID
+	return userID, nil
 }
 
 // UnaryAuthInterceptor возвращает grpc.UnaryServerInterceptor для проверки JWT токена.
+// Ошибки обработчика возвращаются без изменений, чтобы клиент получал исходный код статуса.
 func (s *AuthService) UnaryAuthInterceptor() grpc.UnaryServerInterceptor {
 	return func(
 		ctx context.Context,
@@ -116,62 +116,84 @@ func (s *AuthService) UnaryAuthInterceptor() grpc.UnaryServerInterceptor {
 		info *grpc.UnaryServerInfo,
 		handler grpc.UnaryHandler,
 	) (interface{}, error) {
-		var token string
-		var err error
-		var userID string
-		var newCtx context.Context
-
-		md, ok := metadata.FromIncomingContext(ctx)
-		if !ok {
-			return nil, status.Error(codes.Unauthenticated, "metadata is not provided")
-		} else {
-			values := md.Get("auth_token")
-			if len(values) > 0 {
-				token = values[0]
-			} else {
-				userID = fmt.Sprintf("%d", int(math.Floor(1000+math.Floor(9000*rand.Float64()))))
-				token, err = s.GenerateToken(userID)
-				if err != nil {
-					logger.Log.Error("Ошибка при генерации токена", zap.Error(err))
-					return nil, status.Error(codes.Internal, "failed to generate token")
-				}
-			}
+		newCtx, header, err := s.authenticate(ctx)
+		if err != nil {
+			return nil, err
 		}
-
-		if token == "" {
-			return nil, status.Error(codes.Unauthenticated, "authorization token is not provided")
+		if err := grpc.SetHeader(newCtx, header); err != nil {
+			logger.FromContext(ctx).Error("Ошибка при отправке заголовков", zap.Error(err))
+			return nil, status.Error(codes.Internal, "failed to send headers")
 		}
+		return handler(newCtx, req)
+	}
+}
 
-		userID, err = s.ValidateToken(token)
+// StreamAuthInterceptor возвращает grpc.StreamServerInterceptor для проверки JWT токена.
+func (s *AuthService) StreamAuthInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		newCtx, header, err := s.authenticate(ss.Context())
 		if err != nil {
-			return nil, status.Error(codes.Unauthenticated, "invalid token")
+			return err
 		}
-		clientIP := ""
-		if mdClientIP, ok := md["client_ip"]; ok && len(mdClientIP) > 0 {
-			clientIP = mdClientIP[0]
+		if err := ss.SetHeader(header); err != nil {
+			logger.FromContext(newCtx).Error("Ошибка при отправке заголовков", zap.Error(err))
+			return status.Error(codes.Internal, "failed to send headers")
 		}
+		return handler(srv, &logger.ContextStream{ServerStream: ss, Ctx: newCtx})
+	}
+}
+
+// authenticate - проверяет JWT токен из метаданных вызова, при его отсутствии выдает новый.
+// Возвращает контекст с пользователем и метаданные с токеном для заголовка ответа.
+func (s *AuthService) authenticate(ctx context.Context) (context.Context, metadata.MD, error) {
+	var token string
+	var err error
+	var userID string
 
-		// Добавляем в context для дальнейшего использования
-		newCtx = context.WithValue(ctx, contextKey("userid"), userID)
-		newCtx = context.WithValue(newCtx, contextKey("client_ip"), clientIP)
-		newCtx = context.WithValue(newCtx, contextKey("auth_token"), token)
-		// Добавляем userID и auth_token в метаданные gRPC запроса
-		md = metadata.Pairs("userid", userID, "auth_token", token, "client_ip", clientIP)
-		newCtx = metadata.NewIncomingContext(newCtx, md)
-		// Передаем новый контекст с userID дальше в цепочку вызовов
-		logger.Log.Info("Проверка токена прошла успешно")
-		res, err := handler(newCtx, req)
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return nil, nil, status.Error(codes.Unauthenticated, "metadata is not provided")
+	}
+	values := md.Get("auth_token")
+	if len(values) > 0 {
+		token = values[0]
+	} else {
+		userID = fmt.Sprintf("%d", int(math.Floor(1000+math.Floor(9000*rand.Float64()))))
+		token, err = s.GenerateToken(userID)
 		if err != nil {
-			logger.Log.Error("Ошибка при обработке запроса", zap.Error(err))
-			return nil, status.Error(codes.Internal, "internal server error")
+			logger.FromContext(ctx).Error("Ошибка при генерации токена", zap.Error(err))
+			return nil, nil, status.Error(codes.Internal, "failed to generate token")
 		}
+	}
 
-		if err := grpc.SendHeader(newCtx, md); err != nil {
-			logger.Log.Error("Ошибка при отправке заголовков", zap.Error(err))
-			return nil, status.Error(codes.Internal, "failed to send headers")
-		}
-		return res, nil
+	if token == "" {
+		return nil, nil, status.Error(codes.Unauthenticated, "authorization token is not provided")
 	}
+
+	userID, err = s.ValidateToken(token)
+	if err != nil {
+		return nil, nil, status.Error(codes.Unauthenticated, "invalid token")
+	}
+	clientIP := ""
+	if mdClientIP, ok := md["client_ip"]; ok && len(mdClientIP) > 0 {
+		clientIP = mdClientIP[0]
+	}
+
+	// Добавляем в context для дальнейшего использования
+	newCtx := context.WithValue(ctx, contextKey("userid"), userID)
+	newCtx = context.WithValue(newCtx, contextKey("client_ip"), clientIP)
+	newCtx = context.WithValue(newCtx, contextKey("auth_token"), token)
+	newCtx = context.WithValue(newCtx, contextKey("token_presented"), len(values) > 0)
+	// Добавляем userID и auth_token в метаданные gRPC запроса вместо присланных клиентом,
+	// остальные метаданные клиента сохраняются
+	header := metadata.Pairs("userid", userID, "auth_token", token, "client_ip", clientIP)
+	md = md.Copy()
+	for key, values := range header {
+		md.Set(key, values...)
+	}
+	newCtx = metadata.NewIncomingContext(newCtx, md)
+	logger.FromContext(ctx).Info("Проверка токена прошла успешно")
+	return newCtx, header, nil
 }
 
 // GetUserIDFromContext - извлекает userID из контекста запроса.
@@ -183,6 +205,13 @@ func GetUserIDFromContext(ctx context.Context) (string, error) {
 	return userID, nil
 }
 
+// TokenPresented - проверяет, что пользователь вызова определен по действительному токену,
+// присланному клиентом, а не по токену, выданному при этом вызове.
+func TokenPresented(ctx context.Context) bool {
+	presented, _ := ctx.Value(contextKey("token_presented")).(bool)
+	return presented
+}
+
 // GetUserIDFromMetadata - извлекает userID из метаданных gRPC запроса.
 func GetUserIDFromMetadata(ctx context.Context) (string, error) {
 	md, ok := metadata.FromIncomingContext(ctx)
@@ -222,3 +251,17 @@ func GetClientIPFromMetadata(ctx context.Context) (string, error) {
 
 	return clientIP, nil
 }
+
+// GetLinkPasswordFromMetadata - извлекает пароль защищенной ссылки из метаданных gRPC запроса.
+// Возвращает пустую строку, если пароль не передан.
+func GetLinkPasswordFromMetadata(ctx context.Context) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+	values := md["link_password"]
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
@@ -1,12 +1,15 @@
 package services
 
 import (
+	"bufio"
+	"bytes"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"os"
+	"path/filepath"
 
-	"github.com/darkseear/shortener/internal/logger"
 	"github.com/darkseear/shortener/internal/models"
 )
 
@@ -16,12 +19,6 @@ type Producer struct {
 	encoder *json.Encoder
 }
 
-// Consumer - структура для чтения из файла.
-type Consumer struct {
-	file    *os.File
-	decoder *json.Decoder
-}
-
 // NewProducer - создает новый экземпляр Producer.
 // Принимает имя файла в качестве аргумента и возвращает указатель на Producer и ошибку.
 func NewProducer(filename string) (*Producer, error) {
@@ -42,90 +39,233 @@ func (p *Producer) WriteMemoryFile(memoryFile *models.MemoryFile) error {
 	return p.encoder.Encode(&memoryFile)
 }
 
+// Sync - сбрасывает записанные данные файла на диск.
+func (p *Producer) Sync() error {
+	return p.file.Sync()
+}
+
+// WriteClicks - дописывает прирост переходов в файл в формате JSON.
+func (p *Producer) WriteClicks(clicks *models.ClickAggregate) error {
+	return p.encoder.Encode(clicks)
+}
+
+// WriteVisitorSketch - дописывает скетч уникальных посетителей в файл в формате JSON.
+func (p *Producer) WriteVisitorSketch(sketch *models.VisitorSketch) error {
+	return p.encoder.Encode(sketch)
+}
+
 // Close - закрывает файл, связанный с Producer.
 // Возвращает ошибку, если закрытие файла не удалось.
 func (p *Producer) Close() error {
 	return p.file.Close()
 }
 
-// NewConsumer - создает новый экземпляр Consumer.
-// Принимает имя файла в качестве аргумента и возвращает указатель на Consumer и ошибку.
-func NewConsumer(filename string) (*Consumer, error) {
-	file, err := os.OpenFile(filename, os.O_RDONLY|os.O_CREATE, 0666)
-	if err != nil {
-		return nil, err
-	}
+// ErrCorruptFile - ошибка чтения поврежденного журнала файлового хранилища.
+var ErrCorruptFile = errors.New("memory file is corrupt")
 
-	return &Consumer{
-		file:    file,
-		decoder: json.NewDecoder(file),
-	}, nil
+// LoadReport - результат чтения журнала файлового хранилища.
+type LoadReport struct {
+	Records int   // количество прочитанных корректных записей
+	Skipped int   // количество записей, пропущенных после повреждения
+	Size    int64 // размер корректной части файла в байтах
 }
 
-// ReadMemoryFile - читает объект MemoryFile из файла в формате JSON.
-// Возвращает указатель на MemoryFile и ошибку.
-func (c *Consumer) ReadMemoryFile() (*models.MemoryFile, error) {
-	event := &models.MemoryFile{}
-	if err := c.decoder.Decode(&event); err != nil {
-		return nil, err
+// LoadMemoryFile - построчно читает журнал и передает каждую запись в apply.
+// При повреждении возвращает ErrCorruptFile и отчет, в котором Size - длина корректной части файла,
+// а Skipped - количество строк начиная с первой поврежденной.
+func LoadMemoryFile(filename string, apply func(*models.MemoryFile)) (LoadReport, error) {
+	var report LoadReport
+	file, err := os.OpenFile(filename, os.O_RDONLY|os.O_CREATE, 0666)
+	if err != nil {
+		return report, err
 	}
+	defer file.Close()
 
-	return event, nil
-}
-
-// ReadMemoryFileAll - читает все объекты MemoryFile из файла в формате JSON.
-// Возвращает карту, где ключ - короткий URL, а значение - длинный URL, и ошибку.
-func (c *Consumer) ReadMemoryFileAll() (map[string]string, error) {
-	result := map[string]string{}
-	line := &models.MemoryFile{}
-
+	reader := bufio.NewReader(file)
+	var corrupt error
 	for {
-		err := c.decoder.Decode(&line)
+		line, err := reader.ReadBytes('\n')
+		if len(bytes.TrimSpace(line)) > 0 {
+			if corrupt != nil {
+				report.Skipped++
+			} else {
+				rec := &models.MemoryFile{}
+				if errJSON := json.Unmarshal(line, rec); errJSON != nil {
+					corrupt = fmt.Errorf("%w: record %d: %v", ErrCorruptFile, report.Records+1, errJSON)
+					report.Skipped++
+				} else {
+					apply(rec)
+					report.Records++
+				}
+			}
+		}
+		if corrupt == nil {
+			report.Size += int64(len(line))
+		}
 		if err != nil {
 			if errors.Is(err, io.EOF) {
 				break
 			}
-			return nil, err
+			return report, err
 		}
-		result[line.ShortURL] = line.LongURL
 	}
 
-	return result, nil
+	return report, corrupt
 }
 
-// Close - закрывает файл, связанный с Consumer.
-func (c *Consumer) Close() error {
-	return c.file.Close()
-}
-
-// MemoryFileSave - сохраняет данные из MemoryStorage в файл.
-// Принимает имя файла и указатель на MemoryStorage в качестве аргументов и возвращает ошибку.
-func MemoryFileSave(filename string, m *MemoryStorage) error {
+// RecoverMemoryFile - обрезает поврежденный хвост журнала до корректной части из отчета.
+// Если последняя корректная запись не завершена переводом строки, он дописывается.
+func RecoverMemoryFile(filename string, report LoadReport) error {
+	if err := os.Truncate(filename, report.Size); err != nil {
+		return err
+	}
+	if report.Size == 0 {
+		return nil
+	}
 
-	Producer, err := NewProducer(filename)
+	file, err := os.OpenFile(filename, os.O_RDWR, 0666)
 	if err != nil {
-		logger.Log.Error("no file")
 		return err
 	}
-	defer Producer.Close()
+	defer file.Close()
 
-	Consumer, err := NewConsumer(filename)
-	if err != nil {
-		logger.Log.Error("no file")
+	last := make([]byte, 1)
+	if _, err := file.ReadAt(last, report.Size-1); err != nil {
 		return err
 	}
+	if last[0] != '\n' {
+		if _, err := file.WriteAt([]byte{'\n'}, report.Size); err != nil {
+			return err
+		}
+	}
+	return file.Sync()
+}
 
-	defer Consumer.Close()
+// WriteMemoryFileAtomic - атомарно перезаписывает журнал переданными записями.
+// Записи пишутся во временный файл рядом с журналом, который синхронизируется на диск
+// и переименовывается поверх журнала.
+func WriteMemoryFileAtomic(filename string, records []*models.MemoryFile) error {
+	return writeFileAtomic(filename, func(enc *json.Encoder) error {
+		for _, rec := range records {
+			if err := enc.Encode(rec); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
 
-	readMemoryFile, err := Consumer.ReadMemoryFileAll()
+// WriteClicksFileAtomic - атомарно перезаписывает файл переходов переданными агрегатами.
+func WriteClicksFileAtomic(filename string, clicks []models.ClickAggregate) error {
+	return writeFileAtomic(filename, func(enc *json.Encoder) error {
+		for i := range clicks {
+			if err := enc.Encode(&clicks[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// WriteVisitorsFileAtomic - атомарно перезаписывает файл скетчей уникальных посетителей переданными скетчами.
+func WriteVisitorsFileAtomic(filename string, sketches []models.VisitorSketch) error {
+	return writeFileAtomic(filename, func(enc *json.Encoder) error {
+		for i := range sketches {
+			if err := enc.Encode(&sketches[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// LoadClicksFile - построчно читает агрегаты переходов из файла и передает каждый в apply.
+// Файл переходов нужен только для аналитики, поэтому поврежденные строки пропускаются.
+// Возвращает количество пропущенных строк.
+func LoadClicksFile(filename string, apply func(*models.ClickAggregate)) (int, error) {
+	return loadAnalyticsFile(filename, func(line []byte) bool {
+		clicks := &models.ClickAggregate{}
+		if json.Unmarshal(line, clicks) != nil {
+			return false
+		}
+		apply(clicks)
+		return true
+	})
+}
+
+// LoadVisitorsFile - читает скетчи уникальных посетителей из файла и передает каждый в apply.
+// Поврежденные строки пропускаются так же, как в LoadClicksFile.
+func LoadVisitorsFile(filename string, apply func(*models.VisitorSketch)) (int, error) {
+	return loadAnalyticsFile(filename, func(line []byte) bool {
+		sketch := &models.VisitorSketch{}
+		if json.Unmarshal(line, sketch) != nil {
+			return false
+		}
+		apply(sketch)
+		return true
+	})
+}
+
+// loadAnalyticsFile - построчно читает файл аналитики и передает непустые строки в parse.
+// Возвращает количество строк, которые parse не смог разобрать.
+func loadAnalyticsFile(filename string, parse func(line []byte) bool) (int, error) {
+	file, err := os.OpenFile(filename, os.O_RDONLY|os.O_CREATE, 0666)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	skipped := 0
+	reader := bufio.NewReader(file)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(bytes.TrimSpace(line)) > 0 && !parse(line) {
+			skipped++
+		}
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return skipped, nil
+			}
+			return skipped, err
+		}
+	}
+}
+
+// writeFileAtomic - записывает файл через временный файл рядом с ним, который синхронизируется
+// на диск и переименовывается поверх исходного.
+func writeFileAtomic(filename string, write func(enc *json.Encoder) error) error {
+	dir := filepath.Dir(filename)
+	tmp, err := os.CreateTemp(dir, filepath.Base(filename)+".compact-*")
 	if err != nil {
-		logger.Log.Error("no read file")
 		return err
 	}
+	defer os.Remove(tmp.Name())
 
-	for key, item := range readMemoryFile {
-		m.Memory[key] = item
+	w := bufio.NewWriter(tmp)
+	if err := write(json.NewEncoder(w)); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), filename); err != nil {
+		return err
 	}
 
-	return nil
+	// Синхронизируем каталог, чтобы переименование пережило сбой.
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
 }
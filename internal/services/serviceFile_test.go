@@ -0,0 +1,233 @@
+package services
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/darkseear/shortener/internal/config"
+	"github.com/darkseear/shortener/internal/models"
+)
+
+func TestFileStoreReload(t *testing.T) {
+	ctx := context.Background()
+	file := filepath.Join(t.TempDir(), "memory.log")
+	cfg := &config.Config{URL: "http://localhost:8080", MemoryFile: file}
+
+	f, err := NewFileStore(file, cfg)
+	require.NoError(t, err)
+
+	short1, err := f.ShortenURL(ctx, "https://yandex.ru", "1", models.ShortenOptions{})
+	require.NoError(t, err)
+	short2, _ := f.ShortenURL(ctx, "https://ya.ru", "2", models.ShortenOptions{})
+	require.NoError(t, f.DeleteURLByUserID(ctx, []string{short1, short2}, "1"))
+	require.NoError(t, f.Close())
+
+	// После перезапуска индекс восстанавливается из журнала.
+	f, err = NewFileStore(file, cfg)
+	require.NoError(t, err)
+	defer f.Close()
+
+	_, err = f.GetOriginalURL(ctx, short1, "1", "")
+	assert.ErrorIs(t, err, ErrDeleted)
+
+	long, err := f.GetOriginalURL(ctx, short2, "2", "")
+	require.NoError(t, err)
+	assert.Equal(t, "https://ya.ru", long)
+
+	urls, err := f.GetOriginalURLByUserID(ctx, "2")
+	require.NoError(t, err)
+	require.Len(t, urls, 1)
+	assert.Equal(t, short2, urls[0].ShortURL)
+
+	stats, err := f.Stats(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, stats.URLs)
+	assert.Equal(t, 1, stats.Users)
+}
+
+func TestFileStoreReopen(t *testing.T) {
+	ctx := context.Background()
+	file := filepath.Join(t.TempDir(), "memory.log")
+	cfg := &config.Config{URL: "http://localhost:8080", MemoryFile: file}
+
+	f, err := NewFileStore(file, cfg)
+	require.NoError(t, err)
+	defer f.Close()
+	short, err := f.ShortenURL(ctx, "https://yandex.ru", "1", models.ShortenOptions{})
+	require.NoError(t, err)
+	results, err := f.ShortenBatch(ctx, []models.BatchLongJSON{
+		{CorrelationID: "1", LongJSON: "https://ya.ru"},
+		{CorrelationID: "2", LongJSON: "https://google.com"},
+	}, "1")
+	require.NoError(t, err)
+
+	// Записи сброшены на диск до ответа, поэтому видны без закрытия хранилища.
+	reopened, err := NewFileStore(file, cfg)
+	require.NoError(t, err)
+	defer reopened.Close()
+
+	urls, err := reopened.GetOriginalURLByUserID(ctx, "1")
+	require.NoError(t, err)
+	assert.Len(t, urls, 3)
+	long, err := reopened.GetOriginalURL(ctx, results[1].ShortURL, "1", "")
+	require.NoError(t, err)
+	assert.Equal(t, "https://google.com", long)
+	long, err = reopened.GetOriginalURL(ctx, short, "1", "")
+	require.NoError(t, err)
+	assert.Equal(t, "https://yandex.ru", long)
+}
+
+func TestFileStoreCloseTwice(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "memory.log")
+	f, err := NewFileStore(file, &config.Config{URL: "http://localhost:8080", MemoryFile: file, FileCompactInterval: time.Hour})
+	require.NoError(t, err)
+
+	require.NoError(t, f.Close())
+	assert.NotPanics(t, func() { assert.NoError(t, f.Close()) })
+}
+
+func TestFileStoreRecover(t *testing.T) {
+	ctx := context.Background()
+	file := filepath.Join(t.TempDir(), "memory.log")
+	content := `{"shortURL":"a","longURL":"https://yandex.ru","userID":"1"}
+{"shortURL":"b","longURL":"https://ya.ru","userID":"1"}
+{"shortURL":"c","longURL":"https://goo`
+	require.NoError(t, os.WriteFile(file, []byte(content), 0666))
+
+	_, err := NewFileStore(file, &config.Config{})
+	require.ErrorIs(t, err, ErrCorruptFile)
+
+	f, err := NewFileStore(file, &config.Config{FileRecover: true})
+	require.NoError(t, err)
+	short, _ := f.ShortenURL(ctx, "https://google.com", "2", models.ShortenOptions{})
+	require.NoError(t, f.Close())
+
+	report, err := LoadMemoryFile(file, func(*models.MemoryFile) {})
+	require.NoError(t, err)
+	assert.Equal(t, 3, report.Records)
+
+	f, err = NewFileStore(file, &config.Config{})
+	require.NoError(t, err)
+	defer f.Close()
+	long, err := f.GetOriginalURL(ctx, short, "2", "")
+	require.NoError(t, err)
+	assert.Equal(t, "https://google.com", long)
+}
+
+func TestFileStoreCompact(t *testing.T) {
+	ctx := context.Background()
+	file := filepath.Join(t.TempDir(), "memory.log")
+	cfg := &config.Config{}
+
+	f, err := NewFileStore(file, cfg)
+	require.NoError(t, err)
+	short1, _ := f.ShortenURL(ctx, "https://yandex.ru", "1", models.ShortenOptions{})
+	short2, _ := f.ShortenURL(ctx, "https://ya.ru", "1", models.ShortenOptions{})
+	require.NoError(t, f.DeleteURLByUserID(ctx, []string{short1}, "1"))
+	n, err := f.PurgeDeleted(ctx, time.Now(), 10)
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+
+	require.NoError(t, f.Compact())
+	short3, _ := f.ShortenURL(ctx, "https://google.com", "1", models.ShortenOptions{})
+	require.NoError(t, f.Close())
+
+	var codes []string
+	report, err := LoadMemoryFile(file, func(rec *models.MemoryFile) {
+		codes = append(codes, rec.ShortURL)
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 2, report.Records)
+	assert.Equal(t, []string{short2, short3}, codes)
+}
+
+func TestFileStoreExpiry(t *testing.T) {
+	ctx := context.Background()
+	file := filepath.Join(t.TempDir(), "memory.log")
+	cfg := &config.Config{}
+	expiresAt := time.Now().Add(time.Hour).Truncate(time.Second)
+
+	f, err := NewFileStore(file, cfg)
+	require.NoError(t, err)
+	short, _ := f.ShortenURL(ctx, "https://yandex.ru", "1", models.ShortenOptions{ExpiresAt: expiresAt})
+	require.NoError(t, f.Close())
+
+	// Срок жизни сохраняется в журнале и восстанавливается после перезапуска.
+	f, err = NewFileStore(file, cfg)
+	require.NoError(t, err)
+	_, err = f.GetOriginalURL(ctx, short, "1", "")
+	require.NoError(t, err)
+
+	n, err := f.DeleteExpired(ctx, expiresAt, 10)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	require.NoError(t, f.Close())
+
+	f, err = NewFileStore(file, cfg)
+	require.NoError(t, err)
+	defer f.Close()
+	_, err = f.GetOriginalURL(ctx, short, "1", "")
+	assert.ErrorIs(t, err, ErrDeleted)
+}
+
+func TestFileStoreMaxClicks(t *testing.T) {
+	ctx := context.Background()
+	file := filepath.Join(t.TempDir(), "memory.log")
+	cfg := &config.Config{}
+
+	f, err := NewFileStore(file, cfg)
+	require.NoError(t, err)
+	short, _ := f.ShortenURL(ctx, "https://yandex.ru", "1", models.ShortenOptions{MaxClicks: 2})
+	_, err = f.GetOriginalURL(ctx, short, "1", "")
+	require.NoError(t, err)
+	require.NoError(t, f.Compact())
+	require.NoError(t, f.Close())
+
+	// Переход, сделанный до сжатия и перезапуска, сохраняется.
+	f, err = NewFileStore(file, cfg)
+	require.NoError(t, err)
+	defer f.Close()
+	_, err = f.GetOriginalURL(ctx, short, "1", "")
+	require.NoError(t, err)
+	_, err = f.GetOriginalURL(ctx, short, "1", "")
+	assert.ErrorIs(t, err, ErrClicksExhausted)
+}
+
+func TestFileStoreRestore(t *testing.T) {
+	ctx := context.Background()
+	file := filepath.Join(t.TempDir(), "memory.log")
+	cfg := &config.Config{}
+
+	f, err := NewFileStore(file, cfg)
+	require.NoError(t, err)
+	short1, _ := f.ShortenURL(ctx, "https://yandex.ru", "1", models.ShortenOptions{})
+	short2, _ := f.ShortenURL(ctx, "https://ya.ru", "1", models.ShortenOptions{})
+	require.NoError(t, f.DeleteURLByUserID(ctx, []string{short1, short2}, "1"))
+	require.NoError(t, f.Compact())
+	require.NoError(t, f.Close())
+
+	// Удаленные ссылки переживают сжатие и перезапуск вместе с моментом удаления.
+	f, err = NewFileStore(file, cfg)
+	require.NoError(t, err)
+	restored, err := f.RestoreURLs(ctx, []string{short1}, "1", time.Now().Add(-time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, []string{short1}, restored)
+	n, err := f.PurgeDeleted(ctx, time.Now(), 10)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	require.NoError(t, f.Close())
+
+	f, err = NewFileStore(file, cfg)
+	require.NoError(t, err)
+	defer f.Close()
+	_, err = f.GetOriginalURL(ctx, short1, "1", "")
+	require.NoError(t, err)
+	_, err = f.GetOriginalURL(ctx, short2, "1", "")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
@@ -2,11 +2,11 @@ package services
 
 import (
 	"context"
-	"crypto/rand"
 	"database/sql"
-	"encoding/base64"
-	"fmt"
-	"net/http"
+	"errors"
+	"os"
+	"sort"
+	"sync"
 	"time"
 
 	"github.com/jackc/pgerrcode"
@@ -17,74 +17,736 @@ import (
 
 	"github.com/darkseear/shortener/internal/config"
 	"github.com/darkseear/shortener/internal/logger"
+	"github.com/darkseear/shortener/internal/migrations"
 	"github.com/darkseear/shortener/internal/models"
 )
 
-// sizeURL - размер короткого адреса.
-const sizeURL int64 = 8
+// shortenUniqueConstraint - имя ограничения уникальности колонки shorten в таблице urls.
+const shortenUniqueConstraint = "urls_shorten_key"
+
+// newGenerator - создает генератор коротких адресов по конфигурации.
+// Конфигурация проверяется в storage.New, поэтому при ошибке используется генератор по умолчанию.
+func newGenerator(cfg *config.Config, seq Sequence) CodeGenerator {
+	gen, err := NewCodeGenerator(cfg, seq)
+	if err != nil {
+		logger.Log.Error("Error create code generator, use default", zap.Error(err))
+		return &RandomGenerator{alphabet: DefaultAlphabet, length: DefaultCodeLength}
+	}
+	return gen
+}
+
+// memoryRecord - запись о короткой ссылке в памяти.
+// Нулевой ExpiresAt означает бессрочную ссылку.
+// MaxClicks - разрешенное число переходов, 0 - без ограничений, Clicks - сделанные переходы.
+// PasswordHash - bcrypt-хеш пароля, пустой для ссылки без пароля.
+// DeletedAt - момент удаления, нулевой для удаленных ссылок из старых журналов.
+type memoryRecord struct {
+	LongURL      string
+	UserID       string
+	ExpiresAt    time.Time
+	MaxClicks    int64
+	Clicks       int64
+	PasswordHash string
+	Deleted      bool
+	DeletedAt    time.Time
+	Alias        bool
+}
+
+// linkView - копия полей ссылки, нужных для перехода, чтобы проверять пароль без блокировки.
+type linkView struct {
+	LongURL      string
+	PasswordHash string
+	Limited      bool
+}
+
+// expired - проверяет, истек ли срок жизни ссылки к моменту now.
+func (r *memoryRecord) expired(now time.Time) bool {
+	return !r.ExpiresAt.IsZero() && !now.Before(r.ExpiresAt)
+}
+
+// expiryPtr - возвращает указатель на момент истечения для записи в журнал, nil для бессрочной ссылки.
+func expiryPtr(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+// expiryTime - возвращает момент истечения из записи журнала или запроса, нулевой для бессрочной ссылки.
+func expiryTime(t *time.Time) time.Time {
+	if t == nil {
+		return time.Time{}
+	}
+	return *t
+}
 
 // MemoryStorage - структура для хранения в памяти.
 // Используется для тестирования и в случае, если не требуется постоянное хранение данных.
+// Все методы безопасны для конкурентного использования.
+// clicks - агрегаты переходов по каждой ссылке и часу в UTC для аналитики,
+// visitors - скетчи уникальных посетителей по каждой ссылке и суткам в UTC.
+// Сами события переходов не хранятся, поэтому память растет с числом активных часов, а не переходов.
 type MemoryStorage struct {
-	Memory map[string]string
-	cfg    *config.Config
+	mu       sync.RWMutex
+	Memory   map[string]*memoryRecord
+	longs    map[string]string
+	users    map[string]map[string]struct{}
+	clicks   map[string]map[time.Time]*clickAggregate
+	visitors map[string]map[time.Time]*hyperLogLog
+	gen      CodeGenerator
+	cfg      *config.Config
 }
 
 // NewMemoryStorage - конструктор для создания нового экземпляра MemoryStorage.
 // Принимает конфигурацию в качестве параметра и инициализирует память.
 func NewMemoryStorage(cfg *config.Config) *MemoryStorage {
 	return &MemoryStorage{
-		Memory: make(map[string]string), cfg: cfg}
+		Memory:   make(map[string]*memoryRecord),
+		longs:    make(map[string]string),
+		users:    make(map[string]map[string]struct{}),
+		clicks:   make(map[string]map[time.Time]*clickAggregate),
+		visitors: make(map[string]map[time.Time]*hyperLogLog),
+		gen:      newGenerator(cfg, nil),
+		cfg:      cfg,
+	}
+}
+
+// put - добавляет запись в память, вызывается под блокировкой на запись.
+func (m *MemoryStorage) put(shortURL string, rec *memoryRecord) {
+	m.Memory[shortURL] = rec
+	m.longs[rec.LongURL] = shortURL
+	if rec.UserID == "" {
+		return
+	}
+	codes, ok := m.users[rec.UserID]
+	if !ok {
+		codes = make(map[string]struct{})
+		m.users[rec.UserID] = codes
+	}
+	codes[shortURL] = struct{}{}
+}
+
+// codeOf - возвращает короткий адрес, под которым длинный URL уже сокращен.
+func (m *MemoryStorage) codeOf(longURL string) (string, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	code, ok := m.longs[longURL]
+	return code, ok
+}
+
+// existingLink - возвращает результат повторного сокращения URL, уже сокращенного под адресом short:
+// существующий адрес и ErrConflict или ErrOptionsConflict, если для новой ссылки заданы параметры,
+// как при повторном сокращении URL в базе данных.
+func existingLink(short string, opts models.ShortenOptions) (string, error) {
+	if !opts.IsZero() {
+		return "", ErrOptionsConflict
+	}
+	return short, ErrConflict
+}
+
+// owner - возвращает длинный URL, под которым занят короткий адрес.
+func (m *MemoryStorage) owner(shortURL string) (string, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.ownerLocked(shortURL)
+}
+
+// ownerLocked - возвращает длинный URL, под которым занят короткий адрес, вызывается под блокировкой.
+func (m *MemoryStorage) ownerLocked(shortURL string) (string, bool) {
+	rec, ok := m.Memory[shortURL]
+	if !ok {
+		return "", false
+	}
+	return rec.LongURL, true
+}
+
+// newCode - генерирует свободный короткий адрес, повторяя генерацию при коллизии.
+// Если сгенерированный адрес уже выдан тому же длинному URL (генератор детерминирован),
+// возвращает его и ErrConflict, как при повторном сокращении URL в базе данных.
+// owner вызывается, пока вызывающий держит блокировку, исключающую параллельную запись.
+func newCode(ctx context.Context, gen CodeGenerator, longURL string, owner func(string) (string, bool)) (string, error) {
+	for attempt := 0; attempt < maxGenerateAttempts; attempt++ {
+		code, err := gen.Generate(ctx, longURL, attempt)
+		if err != nil {
+			return "", err
+		}
+		long, taken := owner(code)
+		if !taken {
+			return code, nil
+		}
+		if long == longURL {
+			logger.FromContext(ctx).Info("Conflict long", zap.String("longURL", longURL), zap.String("shortURL", code))
+			return code, ErrConflict
+		}
+		logger.FromContext(ctx).Info("Short code collision, retry", zap.String("shortURL", code), zap.Int("attempt", attempt))
+	}
+	return "", ErrCodeCollision
+}
+
+// pickCode - возвращает выбранный пользователем короткий адрес, если он задан и свободен,
+// иначе генерирует новый.
+func pickCode(ctx context.Context, gen CodeGenerator, longURL string, alias string, owner func(string) (string, bool)) (string, error) {
+	if alias == "" {
+		return newCode(ctx, gen, longURL, owner)
+	}
+	if _, taken := owner(alias); taken {
+		return "", ErrAliasTaken
+	}
+	return alias, nil
+}
+
+// apply - применяет запись журнала к памяти.
+// Используется при загрузке файлового хранилища и при записи в него.
+func (m *MemoryStorage) apply(rec *models.MemoryFile) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	switch rec.Op {
+	case models.OpCreate:
+		m.put(rec.ShortURL, &memoryRecord{
+			LongURL:      rec.LongURL,
+			UserID:       rec.UserID,
+			ExpiresAt:    expiryTime(rec.ExpiresAt),
+			MaxClicks:    rec.MaxClicks,
+			Clicks:       rec.Clicks,
+			PasswordHash: rec.PasswordHash,
+			Deleted:      rec.DeletedAt != nil,
+			DeletedAt:    expiryTime(rec.DeletedAt),
+			Alias:        rec.Alias,
+		})
+	case models.OpDelete:
+		if r, ok := m.Memory[rec.ShortURL]; ok && !r.Deleted {
+			r.Deleted, r.DeletedAt = true, expiryTime(rec.DeletedAt)
+		}
+	case models.OpClick:
+		if r, ok := m.Memory[rec.ShortURL]; ok {
+			r.Clicks++
+		}
+	case models.OpRestore:
+		if r, ok := m.Memory[rec.ShortURL]; ok {
+			r.Deleted, r.DeletedAt = false, time.Time{}
+		}
+	case models.OpPurge:
+		m.remove(rec.ShortURL)
+	}
+}
+
+// remove - удаляет ссылку из памяти, освобождая короткий адрес, вызывается под блокировкой на запись.
+func (m *MemoryStorage) remove(shortURL string) {
+	rec, ok := m.Memory[shortURL]
+	if !ok {
+		return
+	}
+	delete(m.Memory, shortURL)
+	if m.longs[rec.LongURL] == shortURL {
+		delete(m.longs, rec.LongURL)
+	}
+	delete(m.clicks, shortURL)
+	delete(m.visitors, shortURL)
+	if codes, ok := m.users[rec.UserID]; ok {
+		delete(codes, shortURL)
+		if len(codes) == 0 {
+			delete(m.users, rec.UserID)
+		}
+	}
+}
+
+// owned - возвращает неудаленные ссылки из списка, принадлежащие пользователю,
+// и ссылки, которые пользователю не принадлежат.
+func (m *MemoryStorage) owned(shortURL []string, userID string) (live []string, notOwned []string) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	codes := m.users[userID]
+	for _, code := range shortURL {
+		if _, ok := codes[code]; !ok {
+			notOwned = append(notOwned, code)
+			continue
+		}
+		if !m.Memory[code].Deleted {
+			live = append(live, code)
+		}
+	}
+	return live, notOwned
+}
+
+// expired - возвращает до limit неудаленных ссылок, срок жизни которых истек к моменту now.
+func (m *MemoryStorage) expired(now time.Time, limit int) []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var codes []string
+	for code, rec := range m.Memory {
+		if len(codes) == limit {
+			break
+		}
+		if !rec.Deleted && rec.expired(now) {
+			codes = append(codes, code)
+		}
+	}
+	return codes
+}
+
+// restorable - возвращает ссылки пользователя из списка, удаленные после since и не истекшие к now.
+func (m *MemoryStorage) restorable(shortURL []string, userID string, since time.Time, now time.Time) []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	codes := m.users[userID]
+	var result []string
+	for _, code := range shortURL {
+		if _, ok := codes[code]; !ok {
+			continue
+		}
+		rec := m.Memory[code]
+		if rec.Deleted && rec.DeletedAt.After(since) && !rec.expired(now) {
+			result = append(result, code)
+		}
+	}
+	return result
+}
+
+// purgeable - возвращает до limit ссылок, удаленных не позже before.
+func (m *MemoryStorage) purgeable(before time.Time, limit int) []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var codes []string
+	for code, rec := range m.Memory {
+		if len(codes) == limit {
+			break
+		}
+		if rec.Deleted && !rec.DeletedAt.After(before) {
+			codes = append(codes, code)
+		}
+	}
+	return codes
+}
+
+// addClicks - прибавляет агрегаты переходов существующих ссылок к сохраненным и возвращает принятые агрегаты.
+// Переходы по неизвестным и окончательно удаленным ссылкам отбрасываются.
+// Переданные агрегаты не сохраняются и не меняются, поэтому вызывающий может использовать их дальше.
+func (m *MemoryStorage) addClicks(aggregates map[clickKey]*clickAggregate) map[clickKey]*clickAggregate {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	accepted := make(map[clickKey]*clickAggregate, len(aggregates))
+	for key, agg := range aggregates {
+		if _, ok := m.Memory[key.shortURL]; !ok {
+			continue
+		}
+		hours, ok := m.clicks[key.shortURL]
+		if !ok {
+			hours = make(map[time.Time]*clickAggregate)
+			m.clicks[key.shortURL] = hours
+		}
+		existing, ok := hours[key.hour]
+		if !ok {
+			existing = newClickAggregate()
+			hours[key.hour] = existing
+		}
+		existing.Merge(agg)
+		accepted[key] = agg
+	}
+	return accepted
+}
+
+// addVisitors - объединяет скетчи уникальных посетителей существующих ссылок с сохраненными
+// и возвращает принятые скетчи. Переданные скетчи не сохраняются и не меняются, как в addClicks.
+func (m *MemoryStorage) addVisitors(sketches map[visitorKey]*hyperLogLog) map[visitorKey]*hyperLogLog {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	accepted := make(map[visitorKey]*hyperLogLog, len(sketches))
+	for key, sketch := range sketches {
+		if _, ok := m.Memory[key.shortURL]; !ok {
+			continue
+		}
+		days, ok := m.visitors[key.shortURL]
+		if !ok {
+			days = make(map[time.Time]*hyperLogLog)
+			m.visitors[key.shortURL] = days
+		}
+		existing, ok := days[key.day]
+		if !ok {
+			existing = newHyperLogLog()
+			days[key.day] = existing
+		}
+		existing.Merge(sketch)
+		accepted[key] = sketch
+	}
+	return accepted
+}
+
+// dropClicks - удаляет агрегаты переходов ссылки.
+func (m *MemoryStorage) dropClicks(shortURL string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.clicks, shortURL)
+}
+
+// dropVisitors - удаляет скетчи уникальных посетителей ссылки.
+func (m *MemoryStorage) dropVisitors(shortURL string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.visitors, shortURL)
+}
+
+// analyticsSize - возвращает количество агрегатов переходов и скетчей посетителей всех ссылок.
+func (m *MemoryStorage) analyticsSize() int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	n := 0
+	for _, hours := range m.clicks {
+		n += len(hours)
+	}
+	for _, days := range m.visitors {
+		n += len(days)
+	}
+	return n
+}
+
+// allVisitors - возвращает сериализованные скетчи уникальных посетителей всех ссылок.
+func (m *MemoryStorage) allVisitors() ([]models.VisitorSketch, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var sketches []models.VisitorSketch
+	for code, days := range m.visitors {
+		for day, sketch := range days {
+			data, err := sketch.MarshalBinary()
+			if err != nil {
+				return nil, err
+			}
+			sketches = append(sketches, models.VisitorSketch{ShortURL: code, Day: day, Sketch: data})
+		}
+	}
+	return sketches, nil
+}
+
+// allClicks - возвращает агрегаты переходов по всем ссылкам.
+func (m *MemoryStorage) allClicks() []models.ClickAggregate {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var clicks []models.ClickAggregate
+	for code, hours := range m.clicks {
+		for hour, agg := range hours {
+			clicks = append(clicks, clickAggregateRecord(clickKey{shortURL: code, hour: hour}, agg))
+		}
+	}
+	return clicks
+}
+
+// size - возвращает количество ссылок в памяти, включая удаленные, но еще не удаленные окончательно.
+func (m *MemoryStorage) size() int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return len(m.Memory)
+}
+
+// snapshot - возвращает записи журнала для всех ссылок в памяти, упорядоченные по короткому адресу.
+// Удаленные ссылки сохраняются с моментом удаления, чтобы их можно было восстановить.
+func (m *MemoryStorage) snapshot() []*models.MemoryFile {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	records := make([]*models.MemoryFile, 0, len(m.Memory))
+	for code, rec := range m.Memory {
+		var deletedAt *time.Time
+		if rec.Deleted {
+			t := rec.DeletedAt
+			deletedAt = &t
+		}
+		records = append(records, &models.MemoryFile{
+			ShortURL:     code,
+			LongURL:      rec.LongURL,
+			UserID:       rec.UserID,
+			ExpiresAt:    expiryPtr(rec.ExpiresAt),
+			MaxClicks:    rec.MaxClicks,
+			Clicks:       rec.Clicks,
+			PasswordHash: rec.PasswordHash,
+			DeletedAt:    deletedAt,
+			Alias:        rec.Alias,
+		})
+	}
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].ShortURL < records[j].ShortURL
+	})
+	return records
 }
 
 // Stats - метод для получения статистики по сокращенным ссылкам.
 func (m *MemoryStorage) Stats(ctx context.Context) (models.Stats, error) {
-	logger.Log.Info("start get stats memory")
-	stats := models.Stats{
-		URLs:  len(m.Memory),
-		Users: 1, // В памяти нет информации о пользователях, поэтому возвращаем 1.
+	logger.FromContext(ctx).Info("start get stats memory")
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	stats := models.Stats{}
+	users := make(map[string]struct{})
+	for _, rec := range m.Memory {
+		if rec.Deleted {
+			continue
+		}
+		stats.URLs++
+		if rec.UserID != "" {
+			users[rec.UserID] = struct{}{}
+		}
 	}
-	logger.Log.Info("Get stats from memory storage", zap.Int("URLs", stats.URLs), zap.Int("Users", stats.Users))
+	stats.Users = len(users)
+	logger.FromContext(ctx).Info("Get stats from memory storage", zap.Int("URLs", stats.URLs), zap.Int("Users", stats.Users))
 	return stats, nil
 }
 
 // GetOriginalURL - метод для получения оригинального URL по короткому адресу.
 // Принимает короткий адрес и идентификатор пользователя в качестве параметров.
-func (m *MemoryStorage) GetOriginalURL(shortURL string, userID string) (string, error) {
-	logger.Log.Info("start get long url memory")
-	count, ok := m.Memory[shortURL]
-	if !ok {
-		return "", fmt.Errorf("error short")
+// Возвращает ErrNotFound для неизвестной ссылки, ErrDeleted для удаленной, ErrExpired для истекшей
+// и ErrClicksExhausted, если переходы по ссылке исчерпаны. Для ссылки с паролем возвращает
+// ErrPasswordRequired или ErrWrongPassword, если пароль не передан или неверен.
+// Переход по ссылке с ограничением засчитывается только после проверки пароля.
+func (m *MemoryStorage) GetOriginalURL(ctx context.Context, shortURL string, userID string, password string) (string, error) {
+	logger.FromContext(ctx).Info("start get long url memory")
+	link, err := m.peek(shortURL)
+	if err == nil {
+		err = checkLinkPassword(link.PasswordHash, password)
+	}
+	if err != nil {
+		logger.FromContext(ctx).Info("GetURL error", zap.String("shortURL", shortURL), zap.Error(err))
+		return "", err
+	}
+	if link.Limited {
+		return m.click(shortURL)
+	}
+	logger.FromContext(ctx).Info("Get url from storage", zap.String("shortURL", shortURL), zap.String("originalURL", link.LongURL))
+	return link.LongURL, nil
+}
+
+// peek - возвращает копию ссылки, доступной для перехода.
+func (m *MemoryStorage) peek(shortURL string) (linkView, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	rec, err := m.lookup(shortURL, time.Now())
+	if err != nil {
+		return linkView{}, err
 	}
-	logger.Log.Info("Get url from storage", zap.String("shortURL", shortURL), zap.String("originalURL", count))
-	return count, nil
+	return linkView{LongURL: rec.LongURL, PasswordHash: rec.PasswordHash, Limited: rec.MaxClicks > 0}, nil
+}
+
+// lookup - находит ссылку, доступную для перехода в момент now, вызывается под блокировкой.
+func (m *MemoryStorage) lookup(shortURL string, now time.Time) (*memoryRecord, error) {
+	rec, ok := m.Memory[shortURL]
+	switch {
+	case !ok:
+		return nil, ErrNotFound
+	case rec.Deleted:
+		return nil, ErrDeleted
+	case rec.expired(now):
+		return nil, ErrExpired
+	case rec.MaxClicks > 0 && rec.Clicks >= rec.MaxClicks:
+		return nil, ErrClicksExhausted
+	}
+	return rec, nil
+}
+
+// click - засчитывает переход по ссылке с ограничением числа переходов.
+// Проверка и увеличение счетчика выполняются под одной блокировкой.
+func (m *MemoryStorage) click(shortURL string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	rec, err := m.lookup(shortURL, time.Now())
+	if err != nil {
+		return "", err
+	}
+	rec.Clicks++
+	return rec.LongURL, nil
 }
 
 // ShortenURL - метод для сокращения URL.
-// Принимает длинный URL и идентификатор пользователя в качестве параметров.
-func (m *MemoryStorage) ShortenURL(longURL string, userID string) (string, int) {
-	shortURL := GenerateShortURL(sizeURL)
-	m.Memory[shortURL] = longURL
-	logger.Log.Info("Add in memory storage", zap.String("shortURL", shortURL), zap.String("longURL", longURL))
-	return shortURL, http.StatusCreated
+// Принимает длинный URL, идентификатор пользователя и параметры сокращения.
+// Если длинный URL уже сокращен, возвращает существующий короткий адрес и ErrConflict,
+// а если при этом заданы параметры ссылки - ErrOptionsConflict.
+// Если выбранный пользователем короткий адрес занят, возвращает ErrAliasTaken.
+func (m *MemoryStorage) ShortenURL(ctx context.Context, longURL string, userID string, opts models.ShortenOptions) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if short, ok := m.longs[longURL]; ok {
+		logger.FromContext(ctx).Info("Conflict long", zap.String("longURL", longURL), zap.String("shortURL", short))
+		return existingLink(short, opts)
+	}
+	shortURL, err := pickCode(ctx, m.gen, longURL, opts.Alias, m.ownerLocked)
+	if errors.Is(err, ErrConflict) {
+		return existingLink(shortURL, opts)
+	}
+	if err != nil {
+		logger.FromContext(ctx).Error("Pick short code error", zap.Error(err))
+		return "", err
+	}
+	m.put(shortURL, &memoryRecord{
+		LongURL:      longURL,
+		UserID:       userID,
+		ExpiresAt:    opts.ExpiresAt,
+		MaxClicks:    opts.MaxClicks,
+		PasswordHash: opts.PasswordHash,
+		Alias:        opts.Alias != "",
+	})
+	logger.FromContext(ctx).Info("Add in memory storage", zap.String("shortURL", shortURL), zap.String("longURL", longURL), zap.String("userID", userID))
+	return shortURL, nil
+}
+
+// ShortenBatch - метод для пакетного сокращения URL.
+// Все ссылки батча добавляются в память под одной блокировкой.
+// Для уже сокращенных URL, в том числе повторов внутри батча, возвращается существующий короткий адрес
+// и ErrConflict, а для элементов со сроком жизни - ErrOptionsConflict.
+func (m *MemoryStorage) ShortenBatch(ctx context.Context, items []models.BatchLongJSON, userID string) ([]models.BatchResult, error) {
+	results := make([]models.BatchResult, 0, len(items))
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, item := range items {
+		shortURL, ok := m.longs[item.LongJSON]
+		var err error
+		if !ok {
+			shortURL, err = newCode(ctx, m.gen, item.LongJSON, m.ownerLocked)
+		}
+		if ok || errors.Is(err, ErrConflict) {
+			shortURL, err = existingLink(shortURL, models.ShortenOptions{ExpiresAt: expiryTime(item.ExpiresAt)})
+			results = append(results, models.BatchResult{CorrelationID: item.CorrelationID, ShortURL: shortURL, Err: err})
+			continue
+		}
+		if err != nil {
+			logger.FromContext(ctx).Error("Generate short code error", zap.Error(err))
+			return nil, err
+		}
+		m.put(shortURL, &memoryRecord{LongURL: item.LongJSON, UserID: userID, ExpiresAt: expiryTime(item.ExpiresAt)})
+		results = append(results, models.BatchResult{CorrelationID: item.CorrelationID, ShortURL: shortURL})
+	}
+	logger.FromContext(ctx).Info("Add batch in memory storage", zap.Int("count", len(items)), zap.String("userID", userID))
+	return results, nil
 }
 
 // CreateTableDB - метод для создания таблицы в базе данных.
-// В данном случае он не реализован, так как используется только в памяти.
+// Для хранения в памяти ничего создавать не нужно.
 func (m *MemoryStorage) CreateTableDB(ctx context.Context) error {
-	panic("unimplemented")
+	return nil
 }
 
 // DeleteURLByUserID - метод для удаления URL по идентификатору пользователя.
-// В данном случае он не реализован, так как используется только в памяти.
-func (m *MemoryStorage) DeleteURLByUserID(shortURL []string, userID string) error {
-	panic("unimplemented")
+// Помечает удаленными только ссылки, принадлежащие пользователю, остальные пропускает.
+func (m *MemoryStorage) DeleteURLByUserID(ctx context.Context, shortURL []string, userID string) error {
+	logger.FromContext(ctx).Info("start delete url memory")
+	now := time.Now()
+	codes, _ := m.owned(shortURL, userID)
+	for _, code := range codes {
+		m.apply(&models.MemoryFile{ShortURL: code, UserID: userID, DeletedAt: &now, Op: models.OpDelete})
+	}
+	return nil
+}
+
+// DeleteURLBatch - метод для удаления ссылок нескольких пользователей за один вызов.
+// Возвращает для каждого запроса ссылки, которые не принадлежат пользователю.
+func (m *MemoryStorage) DeleteURLBatch(ctx context.Context, reqs []models.DeleteRequest) ([]models.DeleteResult, error) {
+	now := time.Now()
+	results := make([]models.DeleteResult, len(reqs))
+	for i, r := range reqs {
+		codes, notOwned := m.owned(r.Codes, r.UserID)
+		for _, code := range codes {
+			m.apply(&models.MemoryFile{ShortURL: code, UserID: r.UserID, DeletedAt: &now, Op: models.OpDelete})
+		}
+		results[i].NotOwned = notOwned
+	}
+	return results, nil
+}
+
+// DeleteExpired - метод для удаления ссылок с истекшим сроком жизни.
+// Помечает удаленными не больше limit ссылок, истекших к моменту now, и возвращает их количество.
+func (m *MemoryStorage) DeleteExpired(ctx context.Context, now time.Time, limit int) (int, error) {
+	codes := m.expired(now, limit)
+	for _, code := range codes {
+		m.apply(&models.MemoryFile{ShortURL: code, DeletedAt: &now, Op: models.OpDelete})
+	}
+	return len(codes), nil
+}
+
+// RecordClicks - метод для сохранения событий переходов по ссылкам.
+// События сворачиваются в часовые агрегаты и суточные скетчи посетителей.
+func (m *MemoryStorage) RecordClicks(ctx context.Context, events []models.ClickEvent) error {
+	m.addClicks(groupClicks(events))
+	m.addVisitors(groupVisitors(events))
+	return nil
+}
+
+// LinkStats - метод для получения статистики переходов по ссылке за период запроса.
+// Возвращает ErrNotFound, если ссылки нет или она принадлежит другому пользователю.
+func (m *MemoryStorage) LinkStats(ctx context.Context, q models.LinkStatsQuery) (models.LinkStats, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	rec, ok := m.Memory[q.ShortURL]
+	if !ok || rec.UserID != q.UserID {
+		return models.LinkStats{}, ErrNotFound
+	}
+
+	step, _ := bucketSize(q.Bucket)
+	stats := models.LinkStats{ShortURL: q.ShortURL, From: q.From, To: q.To, Bucket: q.Bucket}
+	buckets := make(map[time.Time]int64)
+	referrers := make(map[string]int64)
+	agents := make(map[string]int64)
+	for hour, agg := range m.clicks[q.ShortURL] {
+		if hour.Before(q.From) || !hour.Before(q.To) {
+			continue
+		}
+		stats.TotalClicks += agg.clicks
+		buckets[hour.Truncate(step)] += agg.clicks
+		for v, c := range agg.referrers {
+			referrers[v] += c
+		}
+		for v, c := range agg.userAgents {
+			agents[v] += c
+		}
+	}
+	first, last := visitorDays(q)
+	visitors := newHyperLogLog()
+	for day, sketch := range m.visitors[q.ShortURL] {
+		if !day.Before(first) && !day.After(last) {
+			visitors.Merge(sketch)
+		}
+	}
+	stats.UniqueVisitors = visitors.Estimate()
+	stats.Series = fillSeries(q, buckets)
+	stats.TopReferrers = topCounts(referrers, q.Top)
+	stats.TopUserAgents = topCounts(agents, q.Top)
+	return stats, nil
+}
+
+// RestoreURLs - метод для восстановления удаленных ссылок пользователя.
+// Восстанавливаются только ссылки, удаленные после since и не истекшие, возвращаются их адреса.
+func (m *MemoryStorage) RestoreURLs(ctx context.Context, shortURL []string, userID string, since time.Time) ([]string, error) {
+	codes := m.restorable(shortURL, userID, since, time.Now())
+	for _, code := range codes {
+		m.apply(&models.MemoryFile{ShortURL: code, Op: models.OpRestore})
+	}
+	return codes, nil
+}
+
+// PurgeDeleted - метод для окончательного удаления ссылок, удаленных не позже before.
+// Удаляет не больше limit ссылок и возвращает их количество, адреса ссылок снова свободны.
+func (m *MemoryStorage) PurgeDeleted(ctx context.Context, before time.Time, limit int) (int, error) {
+	codes := m.purgeable(before, limit)
+	for _, code := range codes {
+		m.apply(&models.MemoryFile{ShortURL: code, Op: models.OpPurge})
+	}
+	return len(codes), nil
 }
 
 // GetOriginalURLByUserID - метод для получения оригинального URL по идентификатору пользователя.
-// В данном случае он не реализован, так как используется только в памяти.
-func (m *MemoryStorage) GetOriginalURLByUserID(userID string) ([]models.URLPair, error) {
-	panic("unimplemented")
+// Принимает идентификатор пользователя в качестве параметра, удаленные и истекшие ссылки не возвращаются.
+func (m *MemoryStorage) GetOriginalURLByUserID(ctx context.Context, userID string) ([]models.URLPair, error) {
+	logger.FromContext(ctx).Info("start get long url by user memory")
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	now := time.Now()
+	var urls []models.URLPair
+	for code := range m.users[userID] {
+		rec := m.Memory[code]
+		if rec.Deleted || rec.expired(now) {
+			continue
+		}
+		urls = append(urls, models.URLPair{ShortURL: code, LongURL: rec.LongURL})
+	}
+	return urls, nil
+}
+
+// Ping - метод для проверки доступности хранилища в памяти, оно доступно всегда.
+func (m *MemoryStorage) Ping(ctx context.Context) error {
+	return nil
 }
 
 // Close - метод для закрытия хранилища в памяти.
@@ -100,117 +762,308 @@ func (m *MemoryStorage) Close() error {
 // DBStorage - структура для работы с базой данных.
 type DBStorage struct {
 	DB  *sql.DB
+	gen CodeGenerator
 	cfg *config.Config
 }
 
 // NewDBStorage - конструктор для создания нового экземпляра DBStorage.
 // Принимает указатель на базу данных и конфигурацию в качестве параметров.
+// Счетчик для генератора counter берется из последовательности short_code_seq.
 func NewDBStorage(db *sql.DB, cfg *config.Config) *DBStorage {
-	return &DBStorage{DB: db, cfg: cfg}
+	d := &DBStorage{DB: db, cfg: cfg}
+	d.gen = newGenerator(cfg, d.nextSequence)
+	return d
+}
+
+// nextSequence - возвращает следующее значение последовательности short_code_seq.
+func (d *DBStorage) nextSequence(ctx context.Context) (int64, error) {
+	var n int64
+	err := d.DB.QueryRowContext(ctx, "SELECT nextval('short_code_seq')").Scan(&n)
+	return n, err
+}
+
+// isCodeCollision - проверяет, что ошибка вызвана занятым коротким адресом.
+func isCodeCollision(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == pgerrcode.UniqueViolation && pgErr.ConstraintName == shortenUniqueConstraint
 }
 
 // Stats - метод для получения статистики по сокращенным ссылкам из базы данных.
 func (d *DBStorage) Stats(ctx context.Context) (models.Stats, error) {
-	logger.Log.Info("start get stats db")
+	logger.FromContext(ctx).Info("start get stats db")
 	stats := models.Stats{}
 	query := "SELECT COUNT(*) FROM urls WHERE is_deleted = false"
 	row := d.DB.QueryRowContext(ctx, query)
 	if err := row.Scan(&stats.URLs); err != nil {
-		logger.Log.Error("Get stats error", zap.Error(err))
+		logger.FromContext(ctx).Error("Get stats error", zap.Error(err))
 		return stats, err
 	}
 	query = "SELECT COUNT(DISTINCT userid) FROM urls WHERE is_deleted = false"
 	row = d.DB.QueryRowContext(ctx, query)
 	if err := row.Scan(&stats.Users); err != nil {
-		logger.Log.Error("Get stats error", zap.Error(err))
+		logger.FromContext(ctx).Error("Get stats error", zap.Error(err))
 		return stats, err
 	}
-	logger.Log.Info("Get stats from db storage", zap.Int("URLs", stats.URLs), zap.Int("Users", stats.Users))
+	logger.FromContext(ctx).Info("Get stats from db storage", zap.Int("URLs", stats.URLs), zap.Int("Users", stats.Users))
 	return stats, nil
 }
 
 // GetOriginalURL - метод для получения оригинального URL по короткому адресу.
 // Принимает короткий адрес и идентификатор пользователя в качестве параметров.
-func (d *DBStorage) GetOriginalURL(shortURL string, userID string) (string, error) {
-	logger.Log.Info("start get long url db")
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
+// Возвращает ErrNotFound для неизвестной ссылки, ErrDeleted для удаленной и ErrExpired для истекшей.
+// Срок жизни сравнивается с часами базы данных, чтобы все реплики считали ссылку истекшей одновременно.
+// Пароль проверяется так же, как в MemoryStorage.
+func (d *DBStorage) GetOriginalURL(ctx context.Context, shortURL string, userID string, password string) (string, error) {
+	logger.FromContext(ctx).Info("start get long url db")
 
 	var DBUrlShorten = &models.DBUrlShorten{}
-	query := "SELECT shorten, long, userid, is_deleted FROM urls WHERE shorten = $1"
-	rows, err := d.DB.QueryContext(ctx, query, shortURL)
+	var expired, limited, exhausted bool
+	var passwordHash string
+	query := `
+		SELECT shorten, long, userid, is_deleted,
+			COALESCE(expires_at <= now(), false),
+			max_clicks IS NOT NULL,
+			COALESCE(clicks >= max_clicks, false),
+			COALESCE(password_hash, '')
+		FROM urls WHERE shorten = $1`
+	row := d.DB.QueryRowContext(ctx, query, shortURL)
+	err := row.Scan(&DBUrlShorten.ShortURL, &DBUrlShorten.LongURL, &DBUrlShorten.UserID, &DBUrlShorten.DeletedFlag,
+		&expired, &limited, &exhausted, &passwordHash)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", ErrNotFound
+	}
 	if err != nil {
-		logger.Log.Error("GetURL query error", zap.Error(err))
+		logger.FromContext(ctx).Error("GetURL scan error", zap.Error(err))
 		return "", err
 	}
-	defer rows.Close()
-	if rows.Next() {
-		if err = rows.Scan(&DBUrlShorten.ShortURL, &DBUrlShorten.LongURL, &DBUrlShorten.UserID, &DBUrlShorten.DeletedFlag); err != nil {
-			logger.Log.Error("GetURL scan error", zap.Error(err))
-			return "", err
-		}
-	}
 
 	if DBUrlShorten.DeletedFlag {
-		logger.Log.Error("GetURL error, url is deleted", zap.Error(err))
-		return "GoneStatus", nil
+		logger.FromContext(ctx).Info("GetURL error, url is deleted", zap.String("shortURL", shortURL))
+		return "", ErrDeleted
 	}
-	err = rows.Err()
-	if err != nil {
-		logger.Log.Error("GetURL error", zap.Error(err))
+	if expired {
+		logger.FromContext(ctx).Info("GetURL error, url is expired", zap.String("shortURL", shortURL))
+		return "", ErrExpired
+	}
+	if exhausted {
+		logger.FromContext(ctx).Info("GetURL error, url click limit reached", zap.String("shortURL", shortURL))
+		return "", ErrClicksExhausted
+	}
+	if err := checkLinkPassword(passwordHash, password); err != nil {
+		logger.FromContext(ctx).Info("GetURL error", zap.String("shortURL", shortURL), zap.Error(err))
 		return "", err
 	}
+	if limited {
+		return d.click(ctx, shortURL)
+	}
 
 	return DBUrlShorten.LongURL, nil
 }
 
+// click - засчитывает переход по ссылке с ограничением числа переходов.
+// Условный UPDATE увеличивает счетчик, только пока он меньше ограничения,
+// поэтому несколько реплик не превысят ограничение при одновременных переходах.
+func (d *DBStorage) click(ctx context.Context, shortURL string) (string, error) {
+	query := `
+		UPDATE urls
+		SET clicks = clicks + 1
+		WHERE shorten = $1 AND is_deleted = false AND clicks < max_clicks
+			AND (expires_at IS NULL OR expires_at > now())
+		RETURNING long;`
+	var long string
+	err := d.DB.QueryRowContext(ctx, query, shortURL).Scan(&long)
+	if errors.Is(err, sql.ErrNoRows) {
+		logger.FromContext(ctx).Info("GetURL error, url click limit reached", zap.String("shortURL", shortURL))
+		return "", ErrClicksExhausted
+	}
+	if err != nil {
+		logger.FromContext(ctx).Error("Click update error", zap.Error(err))
+		return "", err
+	}
+	return long, nil
+}
+
 // / ShortenURL - метод для сокращения URL.
 // Принимает длинный URL и идентификатор пользователя в качестве параметров.
-func (d *DBStorage) ShortenURL(longURL string, userID string) (string, int) {
-	shortURL := GenerateShortURL(sizeURL)
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-	query := "INSERT INTO urls (long, shorten, userid) VALUES ($1, $2, $3) RETURNING *;"
-	_, err := d.DB.ExecContext(ctx, query, longURL, shortURL, userID)
+// Если длинный URL уже сокращен, возвращает существующий короткий адрес и ErrConflict,
+// а если при этом заданы параметры ссылки - ErrOptionsConflict.
+// При совпадении короткого адреса с существующим генерация повторяется,
+// а для выбранного пользователем адреса возвращается ErrAliasTaken.
+func (d *DBStorage) ShortenURL(ctx context.Context, longURL string, userID string, opts models.ShortenOptions) (string, error) {
+	query := "INSERT INTO urls (long, shorten, userid, expires_at, max_clicks, password_hash) VALUES ($1, $2, $3, $4, $5, $6);"
+	expiresAt := sql.NullTime{Time: opts.ExpiresAt, Valid: !opts.ExpiresAt.IsZero()}
+	maxClicks := sql.NullInt64{Int64: opts.MaxClicks, Valid: opts.MaxClicks > 0}
+	passwordHash := sql.NullString{String: opts.PasswordHash, Valid: opts.PasswordHash != ""}
+	for attempt := 0; attempt < maxGenerateAttempts; attempt++ {
+		var err error
+		shortURL := opts.Alias
+		if shortURL == "" {
+			if shortURL, err = d.gen.Generate(ctx, longURL, attempt); err != nil {
+				logger.FromContext(ctx).Error("Generate short code error", zap.Error(err))
+				return "", err
+			}
+		}
+		_, err = d.DB.ExecContext(ctx, query, longURL, shortURL, userID, expiresAt, maxClicks, passwordHash)
+		if err == nil {
+			logger.FromContext(ctx).Info("Add in db storage", zap.String("shortURL", shortURL), zap.String("longURL", longURL), zap.String("userID", userID))
+			return shortURL, nil
+		}
+		if isCodeCollision(err) {
+			if opts.Alias != "" {
+				logger.FromContext(ctx).Info("Alias already taken", zap.String("alias", opts.Alias))
+				return "", ErrAliasTaken
+			}
+			logger.FromContext(ctx).Info("Short code collision, retry", zap.String("shortURL", shortURL), zap.Int("attempt", attempt))
+			continue
+		}
 
-	if err != nil {
-		if pgErr, ok := err.(*pgconn.PgError); ok && pgErr.Code == pgerrcode.UniqueViolation {
-			logger.Log.Error("Conflict long")
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == pgerrcode.UniqueViolation {
+			logger.FromContext(ctx).Info("Conflict long", zap.String("longURL", longURL))
+			if !opts.IsZero() {
+				return "", ErrOptionsConflict
+			}
 			query := "SELECT shorten FROM urls WHERE long = $1"
-			s := d.DB.QueryRowContext(ctx, query, longURL)
 			var short string
-			err = s.Scan(&short)
-			if err != nil {
-				logger.Log.Error("scan error", zap.Error(err))
-				return "", http.StatusBadRequest
-			}
-			err = s.Err()
-			if err != nil {
-				logger.Log.Error("db error", zap.Error(err))
-				return "", http.StatusBadRequest
+			if err = d.DB.QueryRowContext(ctx, query, longURL).Scan(&short); err != nil {
+				logger.FromContext(ctx).Error("scan error", zap.Error(err))
+				return "", err
 			}
-			logger.Log.Info("In db storage", zap.String("shortURL", short), zap.String("longURL", longURL), zap.String("userID", userID))
-			return short, http.StatusConflict
+			logger.FromContext(ctx).Info("In db storage", zap.String("shortURL", short), zap.String("longURL", longURL), zap.String("userID", userID))
+			return short, ErrConflict
+		}
+		logger.FromContext(ctx).Error("Not create write in table", zap.Error(err))
+		return "", err
+	}
+	return "", ErrCodeCollision
+}
+
+// ShortenBatch - метод для пакетного сокращения URL.
+// Все ссылки вставляются одним многострочным INSERT в транзакции.
+// Для уже сокращенных URL возвращается существующий короткий адрес и ErrConflict,
+// а для элементов со сроком жизни - ErrOptionsConflict.
+// При совпадении короткого адреса с существующим транзакция повторяется с новыми адресами.
+func (d *DBStorage) ShortenBatch(ctx context.Context, items []models.BatchLongJSON, userID string) ([]models.BatchResult, error) {
+	logger.FromContext(ctx).Info("start shorten batch db", zap.Int("count", len(items)))
+	for attempt := 0; attempt < maxGenerateAttempts; attempt++ {
+		results, err := d.shortenBatch(ctx, items, userID, attempt)
+		if isCodeCollision(err) {
+			logger.FromContext(ctx).Info("Short code collision in batch, retry", zap.Int("attempt", attempt))
+			continue
+		}
+		return results, err
+	}
+	return nil, ErrCodeCollision
+}
+
+// shortenBatch - одна попытка вставки батча в транзакции.
+func (d *DBStorage) shortenBatch(ctx context.Context, items []models.BatchLongJSON, userID string, attempt int) ([]models.BatchResult, error) {
+	longs := make([]string, 0, len(items))
+	shorts := make([]string, 0, len(items))
+	// Пустая строка означает бессрочную ссылку и превращается в NULL при вставке.
+	expires := make([]string, 0, len(items))
+	for _, item := range items {
+		shortURL, err := d.gen.Generate(ctx, item.LongJSON, attempt)
+		if err != nil {
+			logger.FromContext(ctx).Error("Generate short code error", zap.Error(err))
+			return nil, err
+		}
+		longs = append(longs, item.LongJSON)
+		shorts = append(shorts, shortURL)
+		if item.ExpiresAt != nil {
+			expires = append(expires, item.ExpiresAt.Format(time.RFC3339Nano))
+		} else {
+			expires = append(expires, "")
+		}
+	}
+
+	tx, err := d.DB.BeginTx(ctx, nil)
+	if err != nil {
+		logger.FromContext(ctx).Error("Begin tx error", zap.Error(err))
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := `
+		INSERT INTO urls (long, shorten, userid, expires_at)
+		SELECT l, s, $3, NULLIF(e, '')::timestamptz FROM unnest($1::text[], $2::text[], $4::text[]) AS t(l, s, e)
+		ON CONFLICT (long) DO NOTHING
+		RETURNING long, shorten;`
+	created, err := scanLongShort(tx.QueryContext(ctx, query, pq.Array(longs), pq.Array(shorts), userID, pq.Array(expires)))
+	if err != nil {
+		if !isCodeCollision(err) {
+			logger.FromContext(ctx).Error("Insert batch error", zap.Error(err))
+		}
+		return nil, err
+	}
+
+	var missing []string
+	for _, long := range longs {
+		if _, ok := created[long]; !ok {
+			missing = append(missing, long)
+		}
+	}
+	existing := map[string]string{}
+	if len(missing) > 0 {
+		query = "SELECT long, shorten FROM urls WHERE long = ANY($1)"
+		existing, err = scanLongShort(tx.QueryContext(ctx, query, pq.Array(missing)))
+		if err != nil {
+			logger.FromContext(ctx).Error("Select conflicts error", zap.Error(err))
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		logger.FromContext(ctx).Error("Commit batch error", zap.Error(err))
+		return nil, err
+	}
+
+	// Повтор URL внутри батча вставляется один раз, остальные получают конфликт.
+	seen := make(map[string]bool, len(items))
+	results := make([]models.BatchResult, 0, len(items))
+	for _, item := range items {
+		result := models.BatchResult{CorrelationID: item.CorrelationID}
+		if short, ok := created[item.LongJSON]; ok && !seen[item.LongJSON] {
+			result.ShortURL = short
+		} else if ok {
+			result.ShortURL, result.Err = existingLink(short, models.ShortenOptions{ExpiresAt: expiryTime(item.ExpiresAt)})
+		} else {
+			result.ShortURL, result.Err = existingLink(existing[item.LongJSON], models.ShortenOptions{ExpiresAt: expiryTime(item.ExpiresAt)})
+		}
+		seen[item.LongJSON] = true
+		results = append(results, result)
+	}
+	logger.FromContext(ctx).Info("Add batch in db storage", zap.Int("created", len(created)), zap.Int("existing", len(existing)), zap.String("userID", userID))
+	return results, nil
+}
+
+// scanLongShort - читает строки (long, shorten) в карту длинный URL - короткий адрес.
+func scanLongShort(rows *sql.Rows, err error) (map[string]string, error) {
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	result := make(map[string]string)
+	for rows.Next() {
+		var long, short string
+		if err := rows.Scan(&long, &short); err != nil {
+			return nil, err
 		}
-		logger.Log.Error("Not create write in table", zap.Error(err))
-		return "", http.StatusBadRequest
+		result[long] = short
 	}
-	logger.Log.Info("Add in db storage", zap.String("shortURL", shortURL), zap.String("longURL", longURL), zap.String("userID", userID))
-	return shortURL, http.StatusCreated
+	return result, rows.Err()
 }
 
 // GetOriginalURLByUserID - метод для получения оригинального URL по идентификатору пользователя.
 // Принимает идентификатор пользователя в качестве параметра.
-func (d *DBStorage) GetOriginalURLByUserID(userID string) ([]models.URLPair, error) {
-	logger.Log.Info("start get long url db")
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
+func (d *DBStorage) GetOriginalURLByUserID(ctx context.Context, userID string) ([]models.URLPair, error) {
+	logger.FromContext(ctx).Info("start get long url db")
 	var urls []models.URLPair
 	if userID != "" {
-		query := "SELECT shorten, long FROM urls WHERE userid = $1"
+		query := "SELECT shorten, long FROM urls WHERE userid = $1 AND is_deleted = false AND (expires_at IS NULL OR expires_at > now())"
 		rows, err := d.DB.QueryContext(ctx, query, userID)
 		if err != nil {
-			logger.Log.Error("GetURL query error", zap.Error(err))
+			logger.FromContext(ctx).Error("GetURL query error", zap.Error(err))
 			return nil, err
 		}
 		defer rows.Close()
@@ -219,13 +1072,13 @@ func (d *DBStorage) GetOriginalURLByUserID(userID string) ([]models.URLPair, err
 			var URL string
 			var OURL string
 			if err := rows.Scan(&OURL, &URL); err != nil {
-				logger.Log.Error("GetURL scan error", zap.Error(err))
+				logger.FromContext(ctx).Error("GetURL scan error", zap.Error(err))
 				return urls, err
 			}
-			urls = append(urls, models.URLPair{ShortURL: "http://" + d.cfg.Address + "/" + OURL, LongURL: URL})
+			urls = append(urls, models.URLPair{ShortURL: OURL, LongURL: URL})
 		}
 		if err := rows.Err(); err != nil {
-			logger.Log.Error("GetURL rows error", zap.Error(err))
+			logger.FromContext(ctx).Error("GetURL rows error", zap.Error(err))
 			return nil, err
 		}
 	}
@@ -235,50 +1088,400 @@ func (d *DBStorage) GetOriginalURLByUserID(userID string) ([]models.URLPair, err
 
 // DeleteURLByUserID - метод для удаления URL по идентификатору пользователя.
 // Принимает короткий адрес и идентификатор пользователя в качестве параметров.
-func (d *DBStorage) DeleteURLByUserID(shortURL []string, userID string) error {
-	logger.Log.Info("start delete url")
-	if d.cfg.DatabaseDSN != "" {
-		logger.Log.Info("start delete url db")
-		ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-		defer cancel()
-
-		query := `
+func (d *DBStorage) DeleteURLByUserID(ctx context.Context, shortURL []string, userID string) error {
+	logger.FromContext(ctx).Info("start delete url db")
+
+	query := `
 		UPDATE urls 
-		SET is_deleted = true 
+		SET is_deleted = true, deleted_at = COALESCE(deleted_at, now())
 		WHERE 
 		shorten = ANY($1) 
 		AND 
 		userID = $2;`
-		_, err := d.DB.ExecContext(ctx, query, pq.Array(shortURL), userID)
-		if err != nil {
-			logger.Log.Error("DeleteURL error", zap.Error(err))
-			return err
+	_, err := d.DB.ExecContext(ctx, query, pq.Array(shortURL), userID)
+	if err != nil {
+		logger.FromContext(ctx).Error("DeleteURL error", zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+// DeleteURLBatch - метод для удаления ссылок нескольких пользователей одним запросом UPDATE.
+// Пары короткий адрес - пользователь передаются массивами, ссылка удаляется только у своего владельца.
+// Ссылки, не вернувшиеся из UPDATE, не принадлежат пользователю запроса.
+func (d *DBStorage) DeleteURLBatch(ctx context.Context, reqs []models.DeleteRequest) ([]models.DeleteResult, error) {
+	var codes, users []string
+	for _, r := range reqs {
+		for _, code := range r.Codes {
+			codes = append(codes, code)
+			users = append(users, r.UserID)
 		}
+	}
+	results := make([]models.DeleteResult, len(reqs))
+	if len(codes) == 0 {
+		return results, nil
+	}
+
+	query := `
+		UPDATE urls
+		SET is_deleted = true, deleted_at = COALESCE(urls.deleted_at, now())
+		FROM unnest($1::text[], $2::text[]) AS t(s, u)
+		WHERE urls.shorten = t.s AND urls.userid = t.u
+		RETURNING urls.shorten, urls.userid;`
+	rows, err := d.DB.QueryContext(ctx, query, pq.Array(codes), pq.Array(users))
+	if err != nil {
+		logger.FromContext(ctx).Error("DeleteURLBatch error", zap.Error(err))
+		return nil, err
+	}
+	defer rows.Close()
+
+	owned := make(map[[2]string]bool)
+	for rows.Next() {
+		var code, userID string
+		if err := rows.Scan(&code, &userID); err != nil {
+			return nil, err
+		}
+		owned[[2]string{userID, code}] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i, r := range reqs {
+		for _, code := range r.Codes {
+			if !owned[[2]string{r.UserID, code}] {
+				results[i].NotOwned = append(results[i].NotOwned, code)
+			}
+		}
+	}
+	return results, nil
+}
+
+// DeleteExpired - метод для удаления ссылок с истекшим сроком жизни.
+// Помечает удаленными не больше limit ссылок, истекших к моменту now, и возвращает их количество.
+// Строки, заблокированные другой репликой, пропускаются.
+func (d *DBStorage) DeleteExpired(ctx context.Context, now time.Time, limit int) (int, error) {
+	query := `
+		UPDATE urls
+		SET is_deleted = true, deleted_at = now()
+		WHERE id IN (
+			SELECT id FROM urls
+			WHERE is_deleted = false AND expires_at <= $1
+			ORDER BY expires_at
+			LIMIT $2
+			FOR UPDATE SKIP LOCKED);`
+	res, err := d.DB.ExecContext(ctx, query, now, limit)
+	if err != nil {
+		logger.FromContext(ctx).Error("DeleteExpired error", zap.Error(err))
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
+
+// RecordClicks - метод для сохранения событий переходов одним запросом INSERT.
+// События по ссылкам, которых уже нет в таблице urls, отбрасываются.
+func (d *DBStorage) RecordClicks(ctx context.Context, events []models.ClickEvent) error {
+	if len(events) == 0 {
 		return nil
 	}
+	codes := make([]string, len(events))
+	at := make([]string, len(events))
+	referrers := make([]string, len(events))
+	agents := make([]string, len(events))
+	ips := make([]string, len(events))
+	for i, ev := range events {
+		codes[i] = ev.ShortURL
+		at[i] = ev.At.Format(time.RFC3339Nano)
+		referrers[i] = ev.Referrer
+		agents[i] = ev.UserAgent
+		ips[i] = ev.IPHash
+	}
+
+	tx, err := d.DB.BeginTx(ctx, nil)
+	if err != nil {
+		logger.FromContext(ctx).Error("Begin tx error", zap.Error(err))
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+		INSERT INTO clicks (shorten, clicked_at, referrer, user_agent, ip_hash)
+		SELECT t.s, t.at::timestamptz, t.r, t.ua, t.ip
+		FROM unnest($1::text[], $2::text[], $3::text[], $4::text[], $5::text[]) AS t(s, at, r, ua, ip)
+		JOIN urls ON urls.shorten = t.s;`
+	_, err = tx.ExecContext(ctx, query,
+		pq.Array(codes), pq.Array(at), pq.Array(referrers), pq.Array(agents), pq.Array(ips))
+	if err != nil {
+		logger.FromContext(ctx).Error("RecordClicks error", zap.Error(err))
+		return err
+	}
+	if err := mergeVisitorSketches(ctx, tx, groupVisitors(events)); err != nil {
+		logger.FromContext(ctx).Error("RecordClicks sketches error", zap.Error(err))
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		logger.FromContext(ctx).Error("Commit clicks error", zap.Error(err))
+		return err
+	}
 	return nil
 }
 
-// CreateTableDB - метод для создания таблицы в базе данных.
+// mergeVisitorSketches - объединяет скетчи уникальных посетителей с сохраненными в транзакции tx.
+// Недостающие строки создаются пустыми, затем все строки блокируются в одном порядке,
+// поэтому параллельные записи одной ссылки и суток не теряют посетителей.
+func mergeVisitorSketches(ctx context.Context, tx *sql.Tx, sketches map[visitorKey]*hyperLogLog) error {
+	if len(sketches) == 0 {
+		return nil
+	}
+	codes := make([]string, 0, len(sketches))
+	days := make([]string, 0, len(sketches))
+	for key := range sketches {
+		codes = append(codes, key.shortURL)
+		days = append(days, key.day.Format(time.DateOnly))
+	}
+	empty, err := newHyperLogLog().MarshalBinary()
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO visitor_sketches (shorten, day, sketch)
+		SELECT t.s, t.d::date, $3
+		FROM unnest($1::text[], $2::text[]) AS t(s, d)
+		JOIN urls ON urls.shorten = t.s
+		ON CONFLICT (shorten, day) DO NOTHING;`
+	if _, err := tx.ExecContext(ctx, query, pq.Array(codes), pq.Array(days), empty); err != nil {
+		return err
+	}
+
+	query = `
+		SELECT v.shorten, v.day, v.sketch FROM visitor_sketches v
+		JOIN unnest($1::text[], $2::text[]) AS t(s, d) ON v.shorten = t.s AND v.day = t.d::date
+		ORDER BY v.shorten, v.day
+		FOR UPDATE OF v;`
+	rows, err := tx.QueryContext(ctx, query, pq.Array(codes), pq.Array(days))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	var updCodes, updDays []string
+	var updSketches [][]byte
+	for rows.Next() {
+		var key visitorKey
+		var data []byte
+		if err := rows.Scan(&key.shortURL, &key.day, &data); err != nil {
+			return err
+		}
+		sketch := newHyperLogLog()
+		if err := sketch.UnmarshalBinary(data); err != nil {
+			return err
+		}
+		key.day = key.day.UTC()
+		sketch.Merge(sketches[key])
+		if data, err = sketch.MarshalBinary(); err != nil {
+			return err
+		}
+		updCodes = append(updCodes, key.shortURL)
+		updDays = append(updDays, key.day.Format(time.DateOnly))
+		updSketches = append(updSketches, data)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if len(updCodes) == 0 {
+		return nil
+	}
+
+	query = `
+		UPDATE visitor_sketches v SET sketch = t.b
+		FROM unnest($1::text[], $2::text[], $3::bytea[]) AS t(s, d, b)
+		WHERE v.shorten = t.s AND v.day = t.d::date;`
+	_, err = tx.ExecContext(ctx, query, pq.Array(updCodes), pq.Array(updDays), pq.Array(updSketches))
+	return err
+}
+
+// LinkStats - метод для получения статистики переходов по ссылке за период запроса.
+// Возвращает ErrNotFound, если ссылки нет или она принадлежит другому пользователю.
+func (d *DBStorage) LinkStats(ctx context.Context, q models.LinkStatsQuery) (models.LinkStats, error) {
+	var owner sql.NullString
+	err := d.DB.QueryRowContext(ctx, "SELECT userid FROM urls WHERE shorten = $1", q.ShortURL).Scan(&owner)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && owner.String != q.UserID) {
+		return models.LinkStats{}, ErrNotFound
+	}
+	if err != nil {
+		logger.FromContext(ctx).Error("LinkStats error", zap.Error(err))
+		return models.LinkStats{}, err
+	}
+
+	stats := models.LinkStats{ShortURL: q.ShortURL, From: q.From, To: q.To, Bucket: q.Bucket}
+	const where = "shorten = $1 AND clicked_at >= $2 AND clicked_at < $3"
+	err = d.DB.QueryRowContext(ctx,
+		"SELECT COUNT(*) FROM clicks WHERE "+where,
+		q.ShortURL, q.From, q.To).Scan(&stats.TotalClicks)
+	if err != nil {
+		logger.FromContext(ctx).Error("LinkStats error", zap.Error(err))
+		return models.LinkStats{}, err
+	}
+	if stats.UniqueVisitors, err = d.uniqueVisitors(ctx, q); err != nil {
+		logger.FromContext(ctx).Error("LinkStats error", zap.Error(err))
+		return models.LinkStats{}, err
+	}
+
+	buckets := make(map[time.Time]int64)
+	rows, err := d.DB.QueryContext(ctx,
+		"SELECT date_trunc($4, clicked_at AT TIME ZONE 'UTC'), COUNT(*) FROM clicks WHERE "+where+" GROUP BY 1",
+		q.ShortURL, q.From, q.To, q.Bucket)
+	if err != nil {
+		logger.FromContext(ctx).Error("LinkStats error", zap.Error(err))
+		return models.LinkStats{}, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var start time.Time
+		var n int64
+		if err := rows.Scan(&start, &n); err != nil {
+			return models.LinkStats{}, err
+		}
+		buckets[start.UTC()] = n
+	}
+	if err := rows.Err(); err != nil {
+		return models.LinkStats{}, err
+	}
+	stats.Series = fillSeries(q, buckets)
+
+	if stats.TopReferrers, err = d.topClicks(ctx, "referrer", where, q); err != nil {
+		return models.LinkStats{}, err
+	}
+	if stats.TopUserAgents, err = d.topClicks(ctx, "user_agent", where, q); err != nil {
+		return models.LinkStats{}, err
+	}
+	return stats, nil
+}
+
+// uniqueVisitors - объединяет скетчи уникальных посетителей за сутки, покрывающие период запроса.
+func (d *DBStorage) uniqueVisitors(ctx context.Context, q models.LinkStatsQuery) (int64, error) {
+	first, last := visitorDays(q)
+	rows, err := d.DB.QueryContext(ctx,
+		"SELECT sketch FROM visitor_sketches WHERE shorten = $1 AND day BETWEEN $2::date AND $3::date",
+		q.ShortURL, first.Format(time.DateOnly), last.Format(time.DateOnly))
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+	visitors := newHyperLogLog()
+	for rows.Next() {
+		var data []byte
+		if err := rows.Scan(&data); err != nil {
+			return 0, err
+		}
+		sketch := newHyperLogLog()
+		if err := sketch.UnmarshalBinary(data); err != nil {
+			return 0, err
+		}
+		visitors.Merge(sketch)
+	}
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	return visitors.Estimate(), nil
+}
+
+// topClicks - возвращает самые частые непустые значения колонки column среди переходов запроса.
+// column и where задаются только константами в коде.
+func (d *DBStorage) topClicks(ctx context.Context, column string, where string, q models.LinkStatsQuery) ([]models.CountItem, error) {
+	query := "SELECT " + column + ", COUNT(*) AS n FROM clicks WHERE " + where +
+		" AND " + column + " <> '' GROUP BY 1 ORDER BY n DESC, 1 LIMIT $4"
+	rows, err := d.DB.QueryContext(ctx, query, q.ShortURL, q.From, q.To, q.Top)
+	if err != nil {
+		logger.FromContext(ctx).Error("LinkStats error", zap.Error(err))
+		return nil, err
+	}
+	defer rows.Close()
+	items := []models.CountItem{}
+	for rows.Next() {
+		var item models.CountItem
+		if err := rows.Scan(&item.Value, &item.Count); err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+// RestoreURLs - метод для восстановления удаленных ссылок пользователя.
+// Восстанавливаются только ссылки, удаленные после since и не истекшие, возвращаются их адреса.
+func (d *DBStorage) RestoreURLs(ctx context.Context, shortURL []string, userID string, since time.Time) ([]string, error) {
+	query := `
+		UPDATE urls
+		SET is_deleted = false, deleted_at = NULL
+		WHERE shorten = ANY($1) AND userid = $2
+			AND is_deleted = true AND deleted_at > $3
+			AND (expires_at IS NULL OR expires_at > now())
+		RETURNING shorten;`
+	rows, err := d.DB.QueryContext(ctx, query, pq.Array(shortURL), userID, since)
+	if err != nil {
+		logger.FromContext(ctx).Error("RestoreURLs error", zap.Error(err))
+		return nil, err
+	}
+	defer rows.Close()
+
+	var codes []string
+	for rows.Next() {
+		var code string
+		if err := rows.Scan(&code); err != nil {
+			return nil, err
+		}
+		codes = append(codes, code)
+	}
+	return codes, rows.Err()
+}
+
+// PurgeDeleted - метод для окончательного удаления ссылок, удаленных не позже before.
+// Удаляет не больше limit строк и возвращает их количество, события переходов удаляются каскадно.
+// После удаления строки короткий адрес и длинный URL снова можно сократить.
+func (d *DBStorage) PurgeDeleted(ctx context.Context, before time.Time, limit int) (int, error) {
+	query := `
+		DELETE FROM urls
+		WHERE id IN (
+			SELECT id FROM urls
+			WHERE is_deleted = true AND deleted_at <= $1
+			ORDER BY deleted_at
+			LIMIT $2
+			FOR UPDATE SKIP LOCKED);`
+	res, err := d.DB.ExecContext(ctx, query, before, limit)
+	if err != nil {
+		logger.FromContext(ctx).Error("PurgeDeleted error", zap.Error(err))
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
+
+// CreateTableDB - метод для подготовки схемы базы данных.
 // Принимает контекст в качестве параметра.
-// Создает таблицу urls, если она не существует.
+// Применяет все неприменённые миграции и возвращает ошибку, если схема в базе новее известной приложению.
 func (d *DBStorage) CreateTableDB(ctx context.Context) error {
-	logger.Log.Info("Create table shorten")
-	query := "CREATE TABLE IF NOT EXISTS urls (" +
-		"id SERIAL PRIMARY KEY," +
-		"long VARCHAR(255) NOT NULL UNIQUE," +
-		"shorten VARCHAR(50) NOT NULL UNIQUE," +
-		"userID VARCHAR(50)," +
-		"is_deleted BOOL DEFAULT false);"
-	_, err := d.DB.ExecContext(ctx, query)
-	if err != nil {
-		logger.Log.Error("Error created table", zap.Error(err))
+	logger.FromContext(ctx).Info("Migrate database schema")
+	m, err := migrations.New(d.DB)
+	if err != nil {
+		logger.FromContext(ctx).Error("Error load migrations", zap.Error(err))
+		return err
+	}
+	if err := m.Up(ctx); err != nil {
+		logger.FromContext(ctx).Error("Error migrate database", zap.Error(err))
 		return err
 	}
-	logger.Log.Info("Created table")
+	logger.FromContext(ctx).Info("Database schema is up to date", zap.Int("version", m.Latest()))
 	return nil
 }
 
+// Ping - метод для проверки доступности базы данных через пул соединений хранилища.
+func (d *DBStorage) Ping(ctx context.Context) error {
+	return d.DB.PingContext(ctx)
+}
+
 // Close - метод для закрытия соединения с базой данных.
 func (d *DBStorage) Close() error {
 	return d.DB.Close()
@@ -287,112 +1490,563 @@ func (d *DBStorage) Close() error {
 //end db
 
 // file
+// compactMinGarbage - минимальное количество лишних записей в журнале, при котором он сжимается.
+const compactMinGarbage = 100
+
+// clicksFileSuffix - суффикс файла событий переходов относительно пути журнала.
+const clicksFileSuffix = ".clicks"
+
+// visitorsFileSuffix - суффикс файла скетчей уникальных посетителей относительно пути журнала.
+const visitorsFileSuffix = ".visitors"
+
 // FileStore - структура для работы с файловым хранилищем.
-// Используется для хранения данных в файле.
+// Журнал в файле читается один раз при создании в индекс в памяти,
+// все изменения дописываются в конец файла через долгоживущий Producer и сбрасываются на диск до ответа.
+// Фоновый процесс периодически сжимает журнал, оставляя только актуальные записи.
+// Прирост часовых агрегатов переходов дописывается в отдельный файл ClicksFile рядом с журналом,
+// а прирост скетчей уникальных посетителей по суткам - в файл VisitorsFile, как в таблицу visitor_sketches.
+// Оба файла читаются построчно и сжимаются тем же фоновым процессом, что и журнал.
 type FileStore struct {
-	File string
-	cfg  *config.Config
+	File         string
+	ClicksFile   string
+	VisitorsFile string
+	mu           sync.Mutex
+	index        *MemoryStorage
+	producer     *Producer
+	clicksMu     sync.Mutex
+	clicks       *Producer
+	visitors     *Producer
+	lines        int
+	clickLines   int
+	done         chan struct{}
+	wg           sync.WaitGroup
+	closeOnce    sync.Once
+	cfg          *config.Config
 }
 
 // NewFileStore - конструктор для создания нового экземпляра FileStore.
 // Принимает путь к файлу и конфигурацию в качестве параметров.
-func NewFileStore(file string, cfg *config.Config) *FileStore {
-	return &FileStore{File: file, cfg: cfg}
-}
+// Загружает журнал из файла в индекс и открывает файл на дозапись.
+// Если журнал поврежден, а в конфигурации включено восстановление, поврежденный хвост обрезается.
+func NewFileStore(file string, cfg *config.Config) (*FileStore, error) {
+	index := NewMemoryStorage(cfg)
+	report, err := LoadMemoryFile(file, index.apply)
+	if err != nil {
+		if !errors.Is(err, ErrCorruptFile) || !cfg.FileRecover {
+			logger.Log.Error("load memory file error", zap.Error(err))
+			return nil, err
+		}
+		logger.Log.Warn("Memory file is corrupt, truncating tail",
+			zap.Error(err), zap.Int("records", report.Records), zap.Int("skipped", report.Skipped))
+	}
+	if err := RecoverMemoryFile(file, report); err != nil {
+		logger.Log.Error("recover memory file error", zap.Error(err))
+		return nil, err
+	}
 
-// Stats - метод для получения статистики по сокращенным ссылкам из файлового хранилища.
-func (f *FileStore) Stats(ctx context.Context) (models.Stats, error) {
-	logger.Log.Info("start get stats file")
-	stats := models.Stats{}
-	c, err := NewConsumer(f.cfg.MemoryFile)
+	// Счетчик в памяти продолжает нумерацию после уже выданных адресов, выбранные пользователями адреса пропускаются.
+	if o, ok := index.gen.(interface{ Observe(code string) }); ok {
+		for code, rec := range index.Memory {
+			if !rec.Alias {
+				o.Observe(code)
+			}
+		}
+	}
+
+	// Агрегаты переходов и скетчи загружаются после журнала, чтобы отбросить данные окончательно удаленных ссылок.
+	clicksFile := file + clicksFileSuffix
+	clickLines := 0
+	skipped, err := LoadClicksFile(clicksFile, func(r *models.ClickAggregate) {
+		clickLines++
+		if r.Op == models.OpPurge {
+			index.dropClicks(r.ShortURL)
+			return
+		}
+		agg := &clickAggregate{clicks: r.Clicks, referrers: r.Referrers, userAgents: r.UserAgents}
+		index.addClicks(map[clickKey]*clickAggregate{{shortURL: r.ShortURL, hour: r.Hour.UTC().Truncate(time.Hour)}: agg})
+	})
 	if err != nil {
-		logger.Log.Error("consumer error", zap.Error(err))
-		panic(err)
+		logger.Log.Error("load clicks file error", zap.Error(err))
+		return nil, err
+	}
+	if skipped > 0 {
+		logger.Log.Warn("Skipped corrupt click aggregates", zap.String("file", clicksFile), zap.Int("skipped", skipped))
 	}
-	list, err := c.ReadMemoryFileAll()
+	visitorsFile := file + visitorsFileSuffix
+	skipped, err = LoadVisitorsFile(visitorsFile, func(v *models.VisitorSketch) {
+		clickLines++
+		if v.Op == models.OpPurge {
+			index.dropVisitors(v.ShortURL)
+			return
+		}
+		sketch := newHyperLogLog()
+		if err := sketch.UnmarshalBinary(v.Sketch); err != nil {
+			logger.Log.Warn("Skipped corrupt visitor sketch", zap.String("shortURL", v.ShortURL), zap.Error(err))
+			return
+		}
+		index.addVisitors(map[visitorKey]*hyperLogLog{{shortURL: v.ShortURL, day: visitorDay(v.Day)}: sketch})
+	})
 	if err != nil {
-		logger.Log.Error("read memory file error", zap.Error(err))
-		panic(err)
+		logger.Log.Error("load visitors file error", zap.Error(err))
+		return nil, err
 	}
-	stats.URLs = len(list)
-	stats.Users = 1 // В файловом хранилище нет информации о пользователях, поэтому возвращаем 1.
-	logger.Log.Info("Get stats from file storage", zap.Int("URLs", stats.URLs), zap.Int("Users", stats.Users))
-	return stats, nil
+	if skipped > 0 {
+		logger.Log.Warn("Skipped corrupt visitor sketches", zap.String("file", visitorsFile), zap.Int("skipped", skipped))
+	}
+
+	clicks, err := NewProducer(clicksFile)
+	if err != nil {
+		logger.Log.Error("clicks producer error", zap.Error(err))
+		return nil, err
+	}
+	visitors, err := NewProducer(visitorsFile)
+	if err != nil {
+		clicks.Close()
+		logger.Log.Error("visitors producer error", zap.Error(err))
+		return nil, err
+	}
+	p, err := NewProducer(file)
+	if err != nil {
+		clicks.Close()
+		visitors.Close()
+		logger.Log.Error("producer error", zap.Error(err))
+		return nil, err
+	}
+	logger.Log.Info("Loaded file storage", zap.String("file", file), zap.Int("records", report.Records))
+
+	f := &FileStore{File: file, ClicksFile: clicksFile, VisitorsFile: visitorsFile, index: index, producer: p,
+		clicks: clicks, visitors: visitors, lines: report.Records, clickLines: clickLines, done: make(chan struct{}), cfg: cfg}
+	if cfg.FileCompactInterval > 0 {
+		f.wg.Add(1)
+		go f.compactLoop(cfg.FileCompactInterval)
+	}
+	return f, nil
+}
+
+// compactLoop - периодически сжимает журнал, если лишних записей в нем не меньше, чем актуальных.
+// Файлы переходов и скетчей сжимаются по тому же правилу.
+func (f *FileStore) compactLoop(interval time.Duration) {
+	defer f.wg.Done()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-f.done:
+			return
+		case <-ticker.C:
+			f.mu.Lock()
+			lines := f.lines
+			f.mu.Unlock()
+			if needCompact(lines, f.index.size()) {
+				if err := f.Compact(); err != nil {
+					logger.Log.Error("compact memory file error", zap.Error(err))
+				}
+			}
+			f.clicksMu.Lock()
+			clickLines := f.clickLines
+			f.clicksMu.Unlock()
+			if needCompact(clickLines, f.index.analyticsSize()) {
+				if err := f.CompactClicks(); err != nil {
+					logger.Log.Error("compact clicks files error", zap.Error(err))
+				}
+			}
+		}
+	}
+}
+
+// needCompact - проверяет, что лишних строк в файле из lines строк не меньше compactMinGarbage и не меньше live актуальных.
+func needCompact(lines int, live int) bool {
+	garbage := lines - live
+	return garbage >= compactMinGarbage && garbage >= live
+}
+
+// Compact - атомарно перезаписывает журнал, оставляя по одной записи на каждую ссылку в индексе.
+// Удаленные ссылки сохраняются с моментом удаления до окончательного удаления через PurgeDeleted.
+func (f *FileStore) Compact() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	records := f.index.snapshot()
+	if err := WriteMemoryFileAtomic(f.File, records); err != nil {
+		return err
+	}
+
+	// Старый файл заменен, дозапись продолжается в новый.
+	if err := f.producer.Close(); err != nil {
+		logger.Log.Error("close producer error", zap.Error(err))
+	}
+	p, err := NewProducer(f.File)
+	if err != nil {
+		return err
+	}
+	logger.Log.Info("Compacted memory file", zap.String("file", f.File), zap.Int("before", f.lines), zap.Int("after", len(records)))
+	f.producer = p
+	f.lines = len(records)
+	return nil
+}
+
+// write - дописывает записи в журнал, сбрасывает их на диск и применяет к индексу.
+func (f *FileStore) write(records ...*models.MemoryFile) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.writeLocked(records...)
+}
+
+// writeLocked - то же, что write, но вызывается под блокировкой f.mu.
+// Все записи вызова сбрасываются на диск одним fsync.
+func (f *FileStore) writeLocked(records ...*models.MemoryFile) error {
+	if len(records) == 0 {
+		return nil
+	}
+	for _, rec := range records {
+		if err := f.appendLocked(rec); err != nil {
+			return err
+		}
+	}
+	return f.producer.Sync()
+}
+
+// appendLocked - дописывает запись в журнал без сброса на диск и применяет ее к индексу.
+// Вызывается под блокировкой f.mu, после серии записей вызывающий делает f.producer.Sync.
+func (f *FileStore) appendLocked(rec *models.MemoryFile) error {
+	if err := f.producer.WriteMemoryFile(rec); err != nil {
+		return err
+	}
+	f.lines++
+	f.index.apply(rec)
+	return nil
+}
+
+// Stats - метод для получения статистики по сокращенным ссылкам из файлового хранилища.
+func (f *FileStore) Stats(ctx context.Context) (models.Stats, error) {
+	logger.FromContext(ctx).Info("start get stats file")
+	return f.index.Stats(ctx)
 }
 
 // GetOriginalURL - метод для получения оригинального URL по короткому адресу.
 // Принимает короткий адрес и идентификатор пользователя в качестве параметров.
-func (f *FileStore) GetOriginalURL(shortURL string, userID string) (string, error) {
-	logger.Log.Info("start get long url memory file")
-	c, err := NewConsumer(f.cfg.MemoryFile)
-	if err != nil {
-		panic(err)
+// Пароль проверяется так же, как в MemoryStorage.
+// Переход по ссылке с ограничением числа переходов записывается в журнал до ответа.
+func (f *FileStore) GetOriginalURL(ctx context.Context, shortURL string, userID string, password string) (string, error) {
+	logger.FromContext(ctx).Info("start get long url memory file")
+	link, err := f.index.peek(shortURL)
+	if err == nil {
+		err = checkLinkPassword(link.PasswordHash, password)
 	}
-	list, err := c.ReadMemoryFileAll()
 	if err != nil {
-		logger.Log.Error("read memory file error", zap.Error(err))
-		panic(err)
+		logger.FromContext(ctx).Info("GetURL error", zap.String("shortURL", shortURL), zap.Error(err))
+		return "", err
 	}
-	count, ok := list[shortURL]
-	if !ok {
-		return "", fmt.Errorf("error short")
+	if !link.Limited {
+		return link.LongURL, nil
+	}
+
+	// Все изменения индекса файлового хранилища идут под f.mu, поэтому проверка и запись атомарны.
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, err := f.index.peek(shortURL); err != nil {
+		return "", err
 	}
-	return count, nil
+	if err := f.writeLocked(&models.MemoryFile{ShortURL: shortURL, Op: models.OpClick}); err != nil {
+		logger.FromContext(ctx).Error("write click error", zap.Error(err))
+		return "", err
+	}
+	return link.LongURL, nil
 }
 
 // ShortenURL - метод для сокращения URL.
-// Принимает длинный URL и идентификатор пользователя в качестве параметров.
-// Генерирует короткий адрес и записывает его в файл.
-func (f *FileStore) ShortenURL(longURL string, userID string) (string, int) {
-	shortURL := GenerateShortURL(sizeURL)
-	p, err := NewProducer(f.cfg.MemoryFile)
+// Принимает длинный URL, идентификатор пользователя и параметры сокращения.
+// Генерирует короткий адрес или берет выбранный пользователем и записывает его в файл.
+// Уже сокращенный URL обрабатывается так же, как в MemoryStorage.ShortenURL.
+func (f *FileStore) ShortenURL(ctx context.Context, longURL string, userID string, opts models.ShortenOptions) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if short, ok := f.index.codeOf(longURL); ok {
+		logger.FromContext(ctx).Info("Conflict long", zap.String("longURL", longURL), zap.String("shortURL", short))
+		return existingLink(short, opts)
+	}
+	shortURL, err := pickCode(ctx, f.index.gen, longURL, opts.Alias, f.index.owner)
+	if errors.Is(err, ErrConflict) {
+		return existingLink(shortURL, opts)
+	}
 	if err != nil {
-		logger.Log.Error("producer error", zap.Error(err))
-		panic(err)
+		logger.FromContext(ctx).Error("Pick short code error", zap.Error(err))
+		return "", err
+	}
+	m := models.MemoryFile{
+		ShortURL:     shortURL,
+		LongURL:      longURL,
+		UserID:       userID,
+		ExpiresAt:    expiryPtr(opts.ExpiresAt),
+		MaxClicks:    opts.MaxClicks,
+		PasswordHash: opts.PasswordHash,
+		Alias:        opts.Alias != "",
+	}
+	if err := f.writeLocked(&m); err != nil {
+		logger.FromContext(ctx).Error("write memory file error", zap.Error(err))
+		return "", err
+	}
+	logger.FromContext(ctx).Info("Add in file storage", zap.String("shortURL", shortURL), zap.String("longURL", longURL), zap.String("userID", userID))
+	return shortURL, nil
+}
+
+// ShortenBatch - метод для пакетного сокращения URL.
+// Записи всего батча дописываются в журнал под одной блокировкой и сбрасываются на диск одним fsync.
+// Уже сокращенные URL обрабатываются так же, как в MemoryStorage.ShortenBatch.
+func (f *FileStore) ShortenBatch(ctx context.Context, items []models.BatchLongJSON, userID string) ([]models.BatchResult, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	results := make([]models.BatchResult, 0, len(items))
+	for _, item := range items {
+		shortURL, ok := f.index.codeOf(item.LongJSON)
+		var err error
+		if !ok {
+			shortURL, err = newCode(ctx, f.index.gen, item.LongJSON, f.index.owner)
+		}
+		if ok || errors.Is(err, ErrConflict) {
+			shortURL, err = existingLink(shortURL, models.ShortenOptions{ExpiresAt: expiryTime(item.ExpiresAt)})
+			results = append(results, models.BatchResult{CorrelationID: item.CorrelationID, ShortURL: shortURL, Err: err})
+			continue
+		}
+		if err != nil {
+			logger.FromContext(ctx).Error("Generate short code error", zap.Error(err))
+			return nil, err
+		}
+		rec := &models.MemoryFile{ShortURL: shortURL, LongURL: item.LongJSON, UserID: userID, ExpiresAt: item.ExpiresAt}
+		if err := f.appendLocked(rec); err != nil {
+			logger.FromContext(ctx).Error("write memory file error", zap.Error(err))
+			return nil, err
+		}
+		results = append(results, models.BatchResult{CorrelationID: item.CorrelationID, ShortURL: shortURL})
+	}
+	if err := f.producer.Sync(); err != nil {
+		logger.FromContext(ctx).Error("sync memory file error", zap.Error(err))
+		return nil, err
 	}
-	m := models.MemoryFile{ShortURL: shortURL, LongURL: longURL}
-	p.WriteMemoryFile(&m)
-	logger.Log.Info("Add in file storage", zap.String("shortURL", shortURL), zap.String("longURL", longURL))
-	defer p.Close()
-	return shortURL, http.StatusCreated
+	logger.FromContext(ctx).Info("Add batch in file storage", zap.Int("count", len(items)), zap.String("userID", userID))
+	return results, nil
 }
 
 // CreateTableDB - метод для создания таблицы в файловом хранилище.
-// В данном случае он не реализован, так как используется только в памяти.
+// Для файлового хранилища ничего создавать не нужно.
 func (f *FileStore) CreateTableDB(ctx context.Context) error {
-	panic("unimplemented")
+	return nil
 }
 
 // DeleteURLByUserID - метод для удаления URL по идентификатору пользователя.
 // Принимает короткий адрес и идентификатор пользователя в качестве параметров.
-func (f *FileStore) DeleteURLByUserID(shortURL []string, userID string) error {
-	panic("unimplemented")
+// Для каждой ссылки пользователя в журнал дописывается запись об удалении.
+func (f *FileStore) DeleteURLByUserID(ctx context.Context, shortURL []string, userID string) error {
+	logger.FromContext(ctx).Info("start delete url file")
+	now := time.Now()
+	var records []*models.MemoryFile
+	codes, _ := f.index.owned(shortURL, userID)
+	for _, code := range codes {
+		records = append(records, &models.MemoryFile{ShortURL: code, UserID: userID, DeletedAt: &now, Op: models.OpDelete})
+	}
+	if err := f.write(records...); err != nil {
+		logger.FromContext(ctx).Error("DeleteURL error", zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+// DeleteURLBatch - метод для удаления ссылок нескольких пользователей за один вызов.
+// Записи об удалении всех ссылок дописываются в журнал под одной блокировкой.
+func (f *FileStore) DeleteURLBatch(ctx context.Context, reqs []models.DeleteRequest) ([]models.DeleteResult, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	now := time.Now()
+	results := make([]models.DeleteResult, len(reqs))
+	var records []*models.MemoryFile
+	for i, r := range reqs {
+		codes, notOwned := f.index.owned(r.Codes, r.UserID)
+		for _, code := range codes {
+			records = append(records, &models.MemoryFile{ShortURL: code, UserID: r.UserID, DeletedAt: &now, Op: models.OpDelete})
+		}
+		results[i].NotOwned = notOwned
+	}
+	if err := f.writeLocked(records...); err != nil {
+		logger.FromContext(ctx).Error("DeleteURLBatch error", zap.Error(err))
+		return nil, err
+	}
+	return results, nil
+}
+
+// DeleteExpired - метод для удаления ссылок с истекшим сроком жизни.
+// Для не больше limit ссылок, истекших к моменту now, в журнал дописывается запись об удалении.
+func (f *FileStore) DeleteExpired(ctx context.Context, now time.Time, limit int) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	codes := f.index.expired(now, limit)
+	records := make([]*models.MemoryFile, 0, len(codes))
+	for _, code := range codes {
+		records = append(records, &models.MemoryFile{ShortURL: code, DeletedAt: &now, Op: models.OpDelete})
+	}
+	if err := f.writeLocked(records...); err != nil {
+		logger.FromContext(ctx).Error("DeleteExpired error", zap.Error(err))
+		return 0, err
+	}
+	return len(codes), nil
+}
+
+// RestoreURLs - метод для восстановления удаленных ссылок пользователя.
+// Для каждой восстановленной ссылки в журнал дописывается запись о восстановлении.
+func (f *FileStore) RestoreURLs(ctx context.Context, shortURL []string, userID string, since time.Time) ([]string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	codes := f.index.restorable(shortURL, userID, since, time.Now())
+	records := make([]*models.MemoryFile, 0, len(codes))
+	for _, code := range codes {
+		records = append(records, &models.MemoryFile{ShortURL: code, Op: models.OpRestore})
+	}
+	if err := f.writeLocked(records...); err != nil {
+		logger.FromContext(ctx).Error("RestoreURLs error", zap.Error(err))
+		return nil, err
+	}
+	return codes, nil
+}
+
+// PurgeDeleted - метод для окончательного удаления ссылок, удаленных не позже before.
+// Записи об окончательном удалении убирают ссылки из индекса, из журнала их убирает сжатие.
+func (f *FileStore) PurgeDeleted(ctx context.Context, before time.Time, limit int) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	codes := f.index.purgeable(before, limit)
+	records := make([]*models.MemoryFile, 0, len(codes))
+	for _, code := range codes {
+		records = append(records, &models.MemoryFile{ShortURL: code, Op: models.OpPurge})
+	}
+	if err := f.writeLocked(records...); err != nil {
+		logger.FromContext(ctx).Error("PurgeDeleted error", zap.Error(err))
+		return 0, err
+	}
+	// Отметки об удалении пишутся до освобождения f.mu, поэтому переходы новой ссылки с тем же адресом
+	// окажутся в файлах после них и не смешаются с переходами удаленной.
+	if err := f.purgeClicks(codes); err != nil {
+		logger.FromContext(ctx).Error("purge clicks error", zap.Error(err))
+		return len(codes), err
+	}
+	return len(codes), nil
+}
+
+// LinkStats - метод для получения статистики переходов по ссылке за период запроса.
+// Агрегаты переходов и скетчи посетителей хранятся в индексе, поэтому статистика считается так же, как в MemoryStorage.
+func (f *FileStore) LinkStats(ctx context.Context, q models.LinkStatsQuery) (models.LinkStats, error) {
+	return f.index.LinkStats(ctx, q)
+}
+
+// RecordClicks - метод для сохранения событий переходов.
+// События сворачиваются в часовые агрегаты и суточные скетчи посетителей по ссылкам,
+// их прирост дописывается в файлы переходов и скетчей.
+func (f *FileStore) RecordClicks(ctx context.Context, events []models.ClickEvent) error {
+	f.clicksMu.Lock()
+	defer f.clicksMu.Unlock()
+	for key, agg := range f.index.addClicks(groupClicks(events)) {
+		rec := clickAggregateRecord(key, agg)
+		if err := f.clicks.WriteClicks(&rec); err != nil {
+			logger.FromContext(ctx).Error("RecordClicks error", zap.Error(err))
+			return err
+		}
+		f.clickLines++
+	}
+	for key, sketch := range f.index.addVisitors(groupVisitors(events)) {
+		data, err := sketch.MarshalBinary()
+		if err != nil {
+			return err
+		}
+		if err := f.visitors.WriteVisitorSketch(&models.VisitorSketch{ShortURL: key.shortURL, Day: key.day, Sketch: data}); err != nil {
+			logger.FromContext(ctx).Error("RecordClicks sketches error", zap.Error(err))
+			return err
+		}
+		f.clickLines++
+	}
+	return nil
+}
+
+// purgeClicks - дописывает в файлы переходов и скетчей отметки об окончательном удалении ссылок.
+// Данные ссылок из индекса уже удалены, из файлов их убирает сжатие.
+func (f *FileStore) purgeClicks(codes []string) error {
+	f.clicksMu.Lock()
+	defer f.clicksMu.Unlock()
+	for _, code := range codes {
+		if err := f.clicks.WriteClicks(&models.ClickAggregate{ShortURL: code, Op: models.OpPurge}); err != nil {
+			return err
+		}
+		if err := f.visitors.WriteVisitorSketch(&models.VisitorSketch{ShortURL: code, Op: models.OpPurge}); err != nil {
+			return err
+		}
+		f.clickLines += 2
+	}
+	return nil
+}
+
+// CompactClicks - атомарно перезаписывает файлы переходов и скетчей, оставляя по одной записи
+// на каждый агрегат и скетч в индексе, и продолжает дозапись в новые файлы.
+func (f *FileStore) CompactClicks() error {
+	f.clicksMu.Lock()
+	defer f.clicksMu.Unlock()
+	clicks := f.index.allClicks()
+	if err := WriteClicksFileAtomic(f.ClicksFile, clicks); err != nil {
+		return err
+	}
+	if err := f.clicks.Close(); err != nil {
+		logger.Log.Error("close clicks producer error", zap.Error(err))
+	}
+	p, err := NewProducer(f.ClicksFile)
+	if err != nil {
+		return err
+	}
+	f.clicks = p
+
+	sketches, err := f.index.allVisitors()
+	if err != nil {
+		return err
+	}
+	if err := WriteVisitorsFileAtomic(f.VisitorsFile, sketches); err != nil {
+		return err
+	}
+	if err := f.visitors.Close(); err != nil {
+		logger.Log.Error("close visitors producer error", zap.Error(err))
+	}
+	if p, err = NewProducer(f.VisitorsFile); err != nil {
+		return err
+	}
+	logger.Log.Info("Compacted clicks files", zap.String("file", f.ClicksFile),
+		zap.Int("before", f.clickLines), zap.Int("after", len(clicks)+len(sketches)))
+	f.visitors = p
+	f.clickLines = len(clicks) + len(sketches)
+	return nil
 }
 
 // GetOriginalURLByUserID - метод для получения оригинального URL по идентификатору пользователя.
 // Принимает идентификатор пользователя в качестве параметра.
-func (f *FileStore) GetOriginalURLByUserID(userID string) ([]models.URLPair, error) {
-	panic("unimplemented")
+func (f *FileStore) GetOriginalURLByUserID(ctx context.Context, userID string) ([]models.URLPair, error) {
+	return f.index.GetOriginalURLByUserID(ctx, userID)
+}
+
+// Ping - метод для проверки доступности файла журнала.
+func (f *FileStore) Ping(ctx context.Context) error {
+	_, err := os.Stat(f.File)
+	return err
 }
 
 // Close - для закрытия хранилища в файле.
+// Останавливает фоновое сжатие и закрывает журнал, повторные вызовы ничего не делают и возвращают nil.
 func (f *FileStore) Close() error {
-	return nil
+	var err error
+	f.closeOnce.Do(func() {
+		close(f.done)
+		f.wg.Wait()
+		f.clicksMu.Lock()
+		errClicks := errors.Join(f.clicks.Close(), f.visitors.Close())
+		f.clicksMu.Unlock()
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		err = errors.Join(f.producer.Close(), errClicks)
+	})
+	return err
 }
 
 //
 //end file
-
-// генератор короткого адреса, возможно надо сосздать папку хелперсов и туда его
-// GenerateShortURL - функция для генерации короткого адреса.
-// Принимает длину короткого адреса в качестве параметра и возвращает сгенерированный адрес.
-func GenerateShortURL(i int64) string {
-	b := make([]byte, i)
-	_, err := rand.Read(b)
-	if err != nil {
-		logger.Log.Error("Error created table", zap.Error(err))
-		panic(err)
-	}
-	shortURL := base64.URLEncoding.EncodeToString(b)
-	return shortURL
-}
@@ -0,0 +1,233 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/darkseear/shortener/internal/config"
+	"github.com/darkseear/shortener/internal/models"
+)
+
+func TestMemoryStorage(t *testing.T) {
+	ctx := context.Background()
+	cfg := &config.Config{URL: "http://localhost:8080"}
+	m := NewMemoryStorage(cfg)
+
+	short1, err := m.ShortenURL(ctx, "https://yandex.ru", "1", models.ShortenOptions{})
+	require.NoError(t, err)
+	short2, _ := m.ShortenURL(ctx, "https://ya.ru", "1", models.ShortenOptions{})
+	short3, _ := m.ShortenURL(ctx, "https://google.com", "2", models.ShortenOptions{})
+
+	urls, err := m.GetOriginalURLByUserID(ctx, "1")
+	require.NoError(t, err)
+	assert.Len(t, urls, 2)
+
+	stats, err := m.Stats(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 3, stats.URLs)
+	assert.Equal(t, 2, stats.Users)
+
+	// Чужая ссылка не удаляется.
+	require.NoError(t, m.DeleteURLByUserID(ctx, []string{short1, short3}, "1"))
+
+	_, err = m.GetOriginalURL(ctx, short1, "1", "")
+	assert.ErrorIs(t, err, ErrDeleted)
+
+	long, err := m.GetOriginalURL(ctx, short3, "2", "")
+	require.NoError(t, err)
+	assert.Equal(t, "https://google.com", long)
+
+	urls, err = m.GetOriginalURLByUserID(ctx, "1")
+	require.NoError(t, err)
+	require.Len(t, urls, 1)
+	assert.Equal(t, short2, urls[0].ShortURL)
+
+	_, err = m.GetOriginalURL(ctx, "unknown", "1", "")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestMemoryStorageConcurrent(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemoryStorage(&config.Config{URL: "http://localhost:8080"})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			userID := fmt.Sprintf("%d", i%4)
+			short, _ := m.ShortenURL(ctx, fmt.Sprintf("https://example.com/%d", i), userID, models.ShortenOptions{})
+			_, _ = m.GetOriginalURL(ctx, short, userID, "")
+			_, _ = m.GetOriginalURLByUserID(ctx, userID)
+			_, _ = m.Stats(ctx)
+			_ = m.DeleteURLByUserID(ctx, []string{short}, userID)
+		}(i)
+	}
+	wg.Wait()
+
+	stats, err := m.Stats(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 0, stats.URLs)
+}
+
+func TestMemoryStorageAlias(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemoryStorage(&config.Config{URL: "http://localhost:8080"})
+
+	short, err := m.ShortenURL(ctx, "https://yandex.ru", "1", models.ShortenOptions{Alias: "yandex"})
+	require.NoError(t, err)
+	assert.Equal(t, "yandex", short)
+
+	_, err = m.ShortenURL(ctx, "https://ya.ru", "2", models.ShortenOptions{Alias: "yandex"})
+	assert.ErrorIs(t, err, ErrAliasTaken)
+
+	long, err := m.GetOriginalURL(ctx, "yandex", "2", "")
+	require.NoError(t, err)
+	assert.Equal(t, "https://yandex.ru", long)
+}
+
+func TestMemoryStorageExpiry(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemoryStorage(&config.Config{URL: "http://localhost:8080"})
+	now := time.Now()
+
+	live, _ := m.ShortenURL(ctx, "https://yandex.ru", "1", models.ShortenOptions{ExpiresAt: now.Add(time.Hour)})
+	expired, _ := m.ShortenURL(ctx, "https://ya.ru", "1", models.ShortenOptions{ExpiresAt: now.Add(-time.Second)})
+
+	_, err := m.GetOriginalURL(ctx, live, "1", "")
+	require.NoError(t, err)
+	_, err = m.GetOriginalURL(ctx, expired, "1", "")
+	assert.ErrorIs(t, err, ErrExpired)
+
+	urls, err := m.GetOriginalURLByUserID(ctx, "1")
+	require.NoError(t, err)
+	require.Len(t, urls, 1)
+	assert.Equal(t, live, urls[0].ShortURL)
+
+	n, err := m.DeleteExpired(ctx, now, 10)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	_, err = m.GetOriginalURL(ctx, expired, "1", "")
+	assert.ErrorIs(t, err, ErrDeleted)
+
+	n, err = m.DeleteExpired(ctx, now, 10)
+	require.NoError(t, err)
+	assert.Equal(t, 0, n)
+}
+
+func TestMemoryStorageMaxClicks(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemoryStorage(&config.Config{URL: "http://localhost:8080"})
+	short, err := m.ShortenURL(ctx, "https://yandex.ru", "1", models.ShortenOptions{MaxClicks: 3})
+	require.NoError(t, err)
+
+	// Одновременные переходы не превышают ограничение.
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	ok := 0
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := m.GetOriginalURL(ctx, short, "1", ""); err == nil {
+				mu.Lock()
+				ok++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, 3, ok)
+
+	_, err = m.GetOriginalURL(ctx, short, "1", "")
+	assert.ErrorIs(t, err, ErrClicksExhausted)
+}
+
+func TestMemoryStorageRestore(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemoryStorage(&config.Config{URL: "http://localhost:8080"})
+	short, err := m.ShortenURL(ctx, "https://yandex.ru", "1", models.ShortenOptions{Alias: "my-link"})
+	require.NoError(t, err)
+	require.NoError(t, m.DeleteURLByUserID(ctx, []string{short}, "1"))
+
+	// Чужую ссылку и ссылку, удаленную раньше окна восстановления, восстановить нельзя.
+	restored, err := m.RestoreURLs(ctx, []string{short}, "2", time.Now().Add(-time.Hour))
+	require.NoError(t, err)
+	assert.Empty(t, restored)
+	restored, err = m.RestoreURLs(ctx, []string{short}, "1", time.Now())
+	require.NoError(t, err)
+	assert.Empty(t, restored)
+
+	restored, err = m.RestoreURLs(ctx, []string{short}, "1", time.Now().Add(-time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, []string{short}, restored)
+	_, err = m.GetOriginalURL(ctx, short, "1", "")
+	require.NoError(t, err)
+
+	// После окончательного удаления адрес снова свободен.
+	require.NoError(t, m.DeleteURLByUserID(ctx, []string{short}, "1"))
+	n, err := m.PurgeDeleted(ctx, time.Now(), 10)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	_, err = m.GetOriginalURL(ctx, short, "1", "")
+	assert.ErrorIs(t, err, ErrNotFound)
+	_, err = m.ShortenURL(ctx, "https://ya.ru", "2", models.ShortenOptions{Alias: "my-link"})
+	assert.NoError(t, err)
+}
+
+func TestShortenOptionsConflict(t *testing.T) {
+	ctx := context.Background()
+	file := filepath.Join(t.TempDir(), "memory.log")
+	cfg := &config.Config{URL: "http://localhost:8080", MemoryFile: file}
+	f, err := NewFileStore(file, cfg)
+	require.NoError(t, err)
+	defer f.Close()
+
+	storages := map[string]interface {
+		ShortenURL(ctx context.Context, longURL, userID string, opts models.ShortenOptions) (string, error)
+		ShortenBatch(ctx context.Context, items []models.BatchLongJSON, userID string) ([]models.BatchResult, error)
+	}{
+		"memory": NewMemoryStorage(cfg),
+		"file":   f,
+	}
+	expires := time.Now().Add(time.Hour)
+	for name, s := range storages {
+		t.Run(name, func(t *testing.T) {
+			short, err := s.ShortenURL(ctx, "https://yandex.ru", "1", models.ShortenOptions{})
+			require.NoError(t, err)
+
+			// Повтор без параметров возвращает существующую ссылку.
+			again, err := s.ShortenURL(ctx, "https://yandex.ru", "2", models.ShortenOptions{})
+			assert.ErrorIs(t, err, ErrConflict)
+			assert.Equal(t, short, again)
+
+			// Параметры нельзя применить к уже сокращенному URL.
+			for _, opts := range []models.ShortenOptions{
+				{PasswordHash: "hash"},
+				{Alias: "yandex"},
+				{ExpiresAt: expires},
+				{MaxClicks: 3},
+			} {
+				_, err = s.ShortenURL(ctx, "https://yandex.ru", "2", opts)
+				assert.ErrorIs(t, err, ErrOptionsConflict)
+			}
+
+			results, err := s.ShortenBatch(ctx, []models.BatchLongJSON{
+				{CorrelationID: "1", LongJSON: "https://yandex.ru"},
+				{CorrelationID: "2", LongJSON: "https://yandex.ru", ExpiresAt: &expires},
+			}, "2")
+			require.NoError(t, err)
+			require.Len(t, results, 2)
+			assert.ErrorIs(t, results[0].Err, ErrConflict)
+			assert.Equal(t, short, results[0].ShortURL)
+			assert.ErrorIs(t, results[1].Err, ErrOptionsConflict)
+		})
+	}
+}
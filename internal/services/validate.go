@@ -0,0 +1,94 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// ErrInvalidURL - переданная строка не является абсолютным http(s) URL.
+var ErrInvalidURL = errors.New("invalid url")
+
+// Ошибки проверки выбранного пользователем короткого адреса.
+var (
+	// ErrInvalidAlias - недопустимая длина или символы короткого адреса.
+	ErrInvalidAlias = errors.New("invalid alias")
+	// ErrReservedAlias - короткий адрес совпадает с путем маршрута сервиса.
+	ErrReservedAlias = errors.New("alias is reserved")
+)
+
+// ErrInvalidExpiry - срок жизни ссылки задан неверно.
+var ErrInvalidExpiry = errors.New("invalid expiry")
+
+// ErrInvalidMaxClicks - отрицательное ограничение числа переходов.
+var ErrInvalidMaxClicks = errors.New("max_clicks must not be negative")
+
+// minAliasLength - минимальная длина выбранного пользователем короткого адреса.
+const minAliasLength = 3
+
+// reservedAliases - первые сегменты путей маршрутов сервиса.
+// Короткий адрес с таким именем перекрыл бы маршрут, поэтому занять его нельзя.
+// Тест в handlers проверяет, что здесь перечислены все маршруты Routers.
+var reservedAliases = map[string]struct{}{
+	"api":    {},
+	"ping":   {},
+	"livez":  {},
+	"readyz": {},
+}
+
+// ValidateURL - проверяет, что длинный URL абсолютный, со схемой http или https и с хостом.
+func ValidateURL(longURL string) error {
+	u, err := url.ParseRequestURI(longURL)
+	if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+		return ErrInvalidURL
+	}
+	return nil
+}
+
+// ValidateAlias - проверяет выбранный пользователем короткий адрес.
+// Допустимы латинские буквы, цифры, "-" и "_", длина от minAliasLength до maxCodeLength.
+// Зарезервированные имена проверяются без учета регистра.
+func ValidateAlias(alias string) error {
+	if len(alias) < minAliasLength || len(alias) > maxCodeLength {
+		return fmt.Errorf("%w: length must be between %d and %d", ErrInvalidAlias, minAliasLength, maxCodeLength)
+	}
+	for _, c := range alias {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_') {
+			return fmt.Errorf("%w: character %q is not allowed", ErrInvalidAlias, c)
+		}
+	}
+	if _, ok := reservedAliases[strings.ToLower(alias)]; ok {
+		return fmt.Errorf("%w: %s", ErrReservedAlias, alias)
+	}
+	return nil
+}
+
+// ResolveExpiry - возвращает момент истечения ссылки по сроку жизни в секундах или по явному моменту.
+// Нулевое время означает бессрочную ссылку. Задать можно только одно из значений,
+// срок жизни должен быть положительным, а момент истечения - в будущем.
+func ResolveExpiry(ttl int64, expiresAt *time.Time, now time.Time) (time.Time, error) {
+	switch {
+	case ttl != 0 && expiresAt != nil:
+		return time.Time{}, fmt.Errorf("%w: ttl and expires_at are mutually exclusive", ErrInvalidExpiry)
+	case ttl < 0 || ttl > math.MaxInt64/int64(time.Second):
+		return time.Time{}, fmt.Errorf("%w: ttl must be positive", ErrInvalidExpiry)
+	case ttl > 0:
+		return now.Add(time.Duration(ttl) * time.Second), nil
+	case expiresAt != nil && !expiresAt.After(now):
+		return time.Time{}, fmt.Errorf("%w: expires_at must be in the future", ErrInvalidExpiry)
+	case expiresAt != nil:
+		return *expiresAt, nil
+	}
+	return time.Time{}, nil
+}
+
+// ValidateMaxClicks - проверяет ограничение числа переходов по ссылке, 0 - без ограничений.
+func ValidateMaxClicks(maxClicks int64) error {
+	if maxClicks < 0 {
+		return ErrInvalidMaxClicks
+	}
+	return nil
+}
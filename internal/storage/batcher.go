@@ -0,0 +1,126 @@
+package storage
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// batcher - собирает элементы из буферизованного канала в порции и передает их flush,
+// когда суммарный вес порции достиг batch или с прошлой записи прошло interval.
+// После закрытия оставшиеся в канале элементы записываются последней порцией.
+type batcher[T any] struct {
+	items    chan T
+	batch    int
+	interval time.Duration
+	weight   func(T) int
+	flush    func([]T)
+	mu       sync.RWMutex
+	closed   bool
+	done     chan struct{}
+}
+
+// newBatcher - создает batcher и запускает фоновый обработчик.
+// weight возвращает вес элемента в порции, flush вызывается из обработчика последовательно.
+func newBatcher[T any](size int, batch int, interval time.Duration, weight func(T) int, flush func([]T)) *batcher[T] {
+	if batch <= 0 {
+		batch = 1
+	}
+	if interval <= 0 {
+		interval = time.Second
+	}
+	b := &batcher[T]{
+		items:    make(chan T, size),
+		batch:    batch,
+		interval: interval,
+		weight:   weight,
+		flush:    flush,
+		done:     make(chan struct{}),
+	}
+	go b.run()
+	return b
+}
+
+// send - кладет элемент в канал, ожидая свободного места до отмены ctx.
+func (b *batcher[T]) send(ctx context.Context, item T) error {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if b.closed {
+		return ErrQueueClosed
+	}
+	select {
+	case b.items <- item:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// trySend - кладет элемент в канал без ожидания, возвращает false, если канал заполнен.
+func (b *batcher[T]) trySend(item T) (bool, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if b.closed {
+		return false, ErrQueueClosed
+	}
+	select {
+	case b.items <- item:
+		return true, nil
+	default:
+		return false, nil
+	}
+}
+
+// len - возвращает количество элементов, ожидающих в канале.
+func (b *batcher[T]) len() int {
+	return len(b.items)
+}
+
+// close - закрывает канал и ждет записи оставшихся элементов до отмены ctx.
+func (b *batcher[T]) close(ctx context.Context) error {
+	b.mu.Lock()
+	if !b.closed {
+		b.closed = true
+		close(b.items)
+	}
+	b.mu.Unlock()
+
+	select {
+	case <-b.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// run - собирает элементы в порции и передает их flush, пока канал не закрыт.
+func (b *batcher[T]) run() {
+	defer close(b.done)
+	ticker := time.NewTicker(b.interval)
+	defer ticker.Stop()
+
+	var pending []T
+	size := 0
+	for {
+		select {
+		case item, ok := <-b.items:
+			if !ok {
+				if len(pending) > 0 {
+					b.flush(pending)
+				}
+				return
+			}
+			pending = append(pending, item)
+			size += b.weight(item)
+			if size < b.batch {
+				continue
+			}
+		case <-ticker.C:
+			if len(pending) == 0 {
+				continue
+			}
+		}
+		b.flush(pending)
+		pending, size = nil, 0
+	}
+}
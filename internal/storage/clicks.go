@@ -0,0 +1,65 @@
+package storage
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/darkseear/shortener/internal/logger"
+	"github.com/darkseear/shortener/internal/models"
+)
+
+// ClickRecorder - асинхронная запись событий переходов по ссылкам.
+// Record не ждет хранилище: события кладутся в буферизованный канал, а фоновый обработчик
+// записывает их порциями по batch событий или раз в interval. Если буфер заполнен,
+// событие отбрасывается, чтобы запись аналитики не замедляла переход по ссылке.
+type ClickRecorder struct {
+	store   Storage
+	events  *batcher[models.ClickEvent]
+	dropped atomic.Int64
+}
+
+// NewClickRecorder - конструктор для создания нового ClickRecorder.
+// Принимает хранилище, размер буфера, размер порции и интервал записи.
+// Обработчик запускается сразу, остановить его нужно вызовом Close.
+func NewClickRecorder(store Storage, size int, batch int, interval time.Duration) *ClickRecorder {
+	c := &ClickRecorder{store: store}
+	c.events = newBatcher(size, batch, interval, func(models.ClickEvent) int { return 1 }, c.flush)
+	return c
+}
+
+// Record - ставит событие перехода в очередь записи без ожидания.
+func (c *ClickRecorder) Record(event models.ClickEvent) {
+	ok, err := c.events.trySend(event)
+	if err != nil || !ok {
+		c.dropped.Add(1)
+	}
+}
+
+// Len - возвращает количество событий, ожидающих записи.
+func (c *ClickRecorder) Len() int {
+	return c.events.len()
+}
+
+// Dropped - возвращает количество событий, отброшенных из-за заполненного буфера или закрытия.
+func (c *ClickRecorder) Dropped() int64 {
+	return c.dropped.Load()
+}
+
+// Close - закрывает очередь и ждет записи всех принятых событий до отмены ctx.
+func (c *ClickRecorder) Close(ctx context.Context) error {
+	return c.events.close(ctx)
+}
+
+// flush - записывает порцию событий одним вызовом хранилища.
+// При ошибке порция отбрасывается, события аналитики не повторяются.
+func (c *ClickRecorder) flush(events []models.ClickEvent) {
+	ctx, cancel := context.WithTimeout(context.Background(), flushTimeout)
+	defer cancel()
+	if err := c.store.RecordClicks(ctx, events); err != nil {
+		c.dropped.Add(int64(len(events)))
+		logger.Log.Error("Record clicks error", zap.Int("events", len(events)), zap.Error(err))
+	}
+}
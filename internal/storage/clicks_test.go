@@ -0,0 +1,47 @@
+package storage
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/darkseear/shortener/internal/models"
+)
+
+// clickStore - хранилище, запоминающее записанные порции событий.
+type clickStore struct {
+	Storage
+	mu      sync.Mutex
+	batches [][]models.ClickEvent
+}
+
+func (s *clickStore) RecordClicks(ctx context.Context, events []models.ClickEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.batches = append(s.batches, append([]models.ClickEvent(nil), events...))
+	return nil
+}
+
+func TestClickRecorder(t *testing.T) {
+	store := &clickStore{}
+	c := NewClickRecorder(store, 2, 10, time.Hour)
+
+	// Буфер на два события, обработчик не успевает забрать все, лишние отбрасываются без ожидания.
+	for i := 0; i < 100; i++ {
+		c.Record(models.ClickEvent{ShortURL: "abc", At: time.Now()})
+	}
+	require.NoError(t, c.Close(context.Background()))
+	c.Record(models.ClickEvent{ShortURL: "abc"})
+
+	total := 0
+	for _, b := range store.batches {
+		assert.LessOrEqual(t, len(b), 10)
+		total += len(b)
+	}
+	assert.Positive(t, total)
+	assert.Equal(t, int64(101), int64(total)+c.Dropped())
+}
@@ -0,0 +1,172 @@
+package storage
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/darkseear/shortener/internal/logger"
+	"github.com/darkseear/shortener/internal/models"
+)
+
+var (
+	// ErrQueueClosed - очередь удаления закрыта и новые запросы не принимает.
+	ErrQueueClosed = errors.New("delete queue is closed")
+	// ErrJobNotFound - задачи удаления нет или она создана другим пользователем.
+	ErrJobNotFound = errors.New("delete job not found")
+)
+
+// flushTimeout - максимальное время одной записи порции удалений в хранилище.
+const flushTimeout = 10 * time.Second
+
+// jobRetention - сколько хранится результат завершенной задачи удаления.
+const jobRetention = time.Hour
+
+// DeleteQueue - очередь асинхронного удаления ссылок.
+// Обработчики кладут запросы в буферизованный канал, фоновый обработчик собирает их в порции
+// и удаляет одним вызовом хранилища, когда в порции набралось batch ссылок или прошло interval.
+// Для каждого запроса создается задача, состояние которой можно получить методом Job.
+type DeleteQueue struct {
+	store    Storage
+	requests *batcher[models.DeleteRequest]
+
+	jobsMu sync.Mutex
+	jobs   map[string]*deleteJob
+	pruned time.Time
+}
+
+// deleteJob - задача удаления с владельцем и временем завершения.
+type deleteJob struct {
+	userID   string
+	job      models.DeleteJob
+	finished time.Time
+}
+
+// NewDeleteQueue - конструктор для создания новой DeleteQueue.
+// Принимает хранилище, размер буфера канала, размер порции в ссылках и интервал сброса.
+// Обработчик запускается сразу, остановить его нужно вызовом Close.
+func NewDeleteQueue(store Storage, size int, batch int, interval time.Duration) *DeleteQueue {
+	q := &DeleteQueue{store: store, jobs: make(map[string]*deleteJob)}
+	q.requests = newBatcher(size, batch, interval, func(r models.DeleteRequest) int { return len(r.Codes) }, q.flush)
+	return q
+}
+
+// Enqueue - ставит удаление ссылок пользователя в очередь и возвращает идентификатор задачи.
+// Если буфер заполнен, ждет освобождения места до отмены ctx.
+func (q *DeleteQueue) Enqueue(ctx context.Context, userID string, codes []string) (string, error) {
+	id, err := newJobID()
+	if err != nil {
+		return "", err
+	}
+	q.startJob(id, userID)
+	if err := q.requests.send(ctx, models.DeleteRequest{JobID: id, UserID: userID, Codes: codes}); err != nil {
+		q.jobsMu.Lock()
+		delete(q.jobs, id)
+		q.jobsMu.Unlock()
+		return "", err
+	}
+	return id, nil
+}
+
+// Len - возвращает количество запросов на удаление, ожидающих в очереди.
+func (q *DeleteQueue) Len() int {
+	return q.requests.len()
+}
+
+// Job - возвращает состояние задачи удаления пользователя userID.
+// Возвращает ErrJobNotFound для неизвестной, чужой или давно завершенной задачи.
+func (q *DeleteQueue) Job(id string, userID string) (models.DeleteJob, error) {
+	q.jobsMu.Lock()
+	defer q.jobsMu.Unlock()
+	j, ok := q.jobs[id]
+	if !ok || j.userID != userID {
+		return models.DeleteJob{}, ErrJobNotFound
+	}
+	return j.job, nil
+}
+
+// startJob - регистрирует новую задачу в статусе pending и удаляет устаревшие результаты.
+func (q *DeleteQueue) startJob(id string, userID string) {
+	q.jobsMu.Lock()
+	defer q.jobsMu.Unlock()
+	now := time.Now()
+	if now.Sub(q.pruned) >= jobRetention {
+		q.pruned = now
+		for jid, j := range q.jobs {
+			if !j.finished.IsZero() && now.Sub(j.finished) >= jobRetention {
+				delete(q.jobs, jid)
+			}
+		}
+	}
+	q.jobs[id] = &deleteJob{userID: userID, job: models.DeleteJob{ID: id, Status: models.DeleteJobPending}}
+}
+
+// finishJobs - записывает результат порции в задачи ее запросов.
+func (q *DeleteQueue) finishJobs(reqs []models.DeleteRequest, results []models.DeleteResult, err error) {
+	q.jobsMu.Lock()
+	defer q.jobsMu.Unlock()
+	now := time.Now()
+	for i, r := range reqs {
+		j, ok := q.jobs[r.JobID]
+		if !ok {
+			continue
+		}
+		j.finished = now
+		if err != nil {
+			j.job.Status, j.job.Error = models.DeleteJobFailed, err.Error()
+			continue
+		}
+		j.job.Status, j.job.NotOwned = models.DeleteJobDone, results[i].NotOwned
+	}
+}
+
+// DeleteNow - удаляет ссылки пользователя сразу, без очереди.
+// Возвращает уже завершенную задачу без идентификатора.
+func DeleteNow(ctx context.Context, s Storage, userID string, codes []string) (models.DeleteJob, error) {
+	results, err := s.DeleteURLBatch(ctx, []models.DeleteRequest{{UserID: userID, Codes: codes}})
+	if err != nil {
+		return models.DeleteJob{}, err
+	}
+	if len(results) != 1 {
+		return models.DeleteJob{}, fmt.Errorf("storage returned %d results for 1 request", len(results))
+	}
+	return models.DeleteJob{Status: models.DeleteJobDone, NotOwned: results[0].NotOwned}, nil
+}
+
+// newJobID - возвращает случайный идентификатор задачи удаления.
+func newJobID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// Close - закрывает очередь и ждет, пока все принятые запросы будут записаны в хранилище.
+// Возвращает ошибку ctx, если запись не завершилась до его отмены.
+func (q *DeleteQueue) Close(ctx context.Context) error {
+	return q.requests.close(ctx)
+}
+
+// flush - удаляет порцию ссылок одним вызовом хранилища и завершает задачи ее запросов.
+// При ошибке все задачи порции получают статус failed, запросы не повторяются.
+func (q *DeleteQueue) flush(reqs []models.DeleteRequest) {
+	ctx, cancel := context.WithTimeout(context.Background(), flushTimeout)
+	defer cancel()
+	results, err := q.store.DeleteURLBatch(ctx, reqs)
+	if err == nil && len(results) != len(reqs) {
+		err = fmt.Errorf("storage returned %d results for %d requests", len(results), len(reqs))
+	}
+	q.finishJobs(reqs, results, err)
+	if err != nil {
+		logger.Log.Error("Delete batch error", zap.Int("requests", len(reqs)), zap.Error(err))
+		return
+	}
+	logger.Log.Info("Deleted url batch", zap.Int("requests", len(reqs)))
+}
@@ -0,0 +1,62 @@
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/darkseear/shortener/internal/config"
+	"github.com/darkseear/shortener/internal/models"
+)
+
+func TestDeleteQueue(t *testing.T) {
+	ctx := context.Background()
+	store, err := New(&config.Config{URL: "http://localhost:8080"})
+	require.NoError(t, err)
+
+	short1, _ := store.ShortenURL(ctx, "https://yandex.ru", "1", models.ShortenOptions{})
+	short2, _ := store.ShortenURL(ctx, "https://ya.ru", "1", models.ShortenOptions{})
+	short3, _ := store.ShortenURL(ctx, "https://google.com", "2", models.ShortenOptions{})
+
+	// Интервал больше времени теста, поэтому первая порция записывается по размеру.
+	q := NewDeleteQueue(store, 10, 2, time.Hour)
+	job1, err := q.Enqueue(ctx, "1", []string{short1})
+	require.NoError(t, err)
+	job2, err := q.Enqueue(ctx, "2", []string{short2})
+	require.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		job, err := q.Job(job1, "1")
+		return err == nil && job.Status == models.DeleteJobDone
+	}, time.Second, 10*time.Millisecond)
+	_, err = store.GetOriginalURL(ctx, short1, "1", "")
+	assert.ErrorIs(t, err, ErrDeleted)
+
+	// Чужая ссылка не удаляется и попадает в NotOwned.
+	_, err = store.GetOriginalURL(ctx, short2, "1", "")
+	require.NoError(t, err)
+	job, err := q.Job(job2, "2")
+	require.NoError(t, err)
+	assert.Equal(t, []string{short2}, job.NotOwned)
+	_, err = q.Job(job2, "1")
+	assert.ErrorIs(t, err, ErrJobNotFound)
+
+	// Остаток очереди записывается при закрытии.
+	job3, err := q.Enqueue(ctx, "2", []string{short3})
+	require.NoError(t, err)
+	job, err = q.Job(job3, "2")
+	require.NoError(t, err)
+	assert.Equal(t, models.DeleteJobPending, job.Status)
+	require.NoError(t, q.Close(ctx))
+	_, err = store.GetOriginalURL(ctx, short3, "2", "")
+	assert.ErrorIs(t, err, ErrDeleted)
+	job, err = q.Job(job3, "2")
+	require.NoError(t, err)
+	assert.Equal(t, models.DeleteJob{ID: job3, Status: models.DeleteJobDone}, job)
+
+	_, err = q.Enqueue(ctx, "1", []string{short2})
+	assert.ErrorIs(t, err, ErrQueueClosed)
+	assert.NoError(t, q.Close(ctx))
+}
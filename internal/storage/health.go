@@ -0,0 +1,55 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+)
+
+// ErrShuttingDown - сервис останавливается и не принимает новые запросы.
+var ErrShuttingDown = errors.New("service is shutting down")
+
+// Health - проверка готовности сервиса к приему запросов.
+// Сервис готов, пока не начата остановка и хранилище отвечает на проверку.
+// Безопасен для конкурентного использования.
+type Health struct {
+	store    Storage
+	stopping atomic.Bool
+}
+
+// NewHealth - конструктор для создания нового Health.
+func NewHealth(store Storage) *Health {
+	return &Health{store: store}
+}
+
+// Ready - возвращает nil, если сервис готов принимать запросы.
+// Во время остановки возвращает ErrShuttingDown, при недоступном хранилище - его ошибку.
+func (h *Health) Ready(ctx context.Context) error {
+	if h.stopping.Load() {
+		return ErrShuttingDown
+	}
+	return h.store.Ping(ctx)
+}
+
+// Shutdown - отмечает начало остановки, после этого сервис больше не готов.
+func (h *Health) Shutdown() {
+	h.stopping.Store(true)
+}
+
+// Watch - проверяет готовность сразу и затем каждые interval до отмены ctx,
+// передавая результат каждой проверки в update. Каждая проверка ограничена interval.
+func (h *Health) Watch(ctx context.Context, interval time.Duration, update func(error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		checkCtx, cancel := context.WithTimeout(ctx, interval)
+		update(h.Ready(checkCtx))
+		cancel()
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
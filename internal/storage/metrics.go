@@ -0,0 +1,98 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	"github.com/darkseear/shortener/internal/metrics"
+	"github.com/darkseear/shortener/internal/models"
+)
+
+// instrumented - обертка хранилища, учитывающая длительность операций в метриках.
+// Служебные методы передаются хранилищу без учета.
+type instrumented struct {
+	Storage
+	backend string
+}
+
+// instrument - оборачивает хранилище s для учета длительности операций с меткой backend.
+func instrument(s Storage, backend string) Storage {
+	return &instrumented{Storage: s, backend: backend}
+}
+
+// observe - учитывает длительность операции method, начатой в start.
+func (s *instrumented) observe(method string, start time.Time) {
+	metrics.ObserveStorage(s.backend, method, start)
+}
+
+// ShortenURL - сокращает URL с учетом длительности в метриках.
+func (s *instrumented) ShortenURL(ctx context.Context, longURL string, userID string, opts models.ShortenOptions) (string, error) {
+	defer s.observe("ShortenURL", time.Now())
+	return s.Storage.ShortenURL(ctx, longURL, userID, opts)
+}
+
+// ShortenBatch - сокращает батч URL с учетом длительности в метриках.
+func (s *instrumented) ShortenBatch(ctx context.Context, items []models.BatchLongJSON, userID string) ([]models.BatchResult, error) {
+	defer s.observe("ShortenBatch", time.Now())
+	return s.Storage.ShortenBatch(ctx, items, userID)
+}
+
+// GetOriginalURL - возвращает длинный URL по короткому с учетом длительности в метриках.
+func (s *instrumented) GetOriginalURL(ctx context.Context, shortURL string, userID string, password string) (string, error) {
+	defer s.observe("GetOriginalURL", time.Now())
+	return s.Storage.GetOriginalURL(ctx, shortURL, userID, password)
+}
+
+// GetOriginalURLByUserID - возвращает ссылки пользователя с учетом длительности в метриках.
+func (s *instrumented) GetOriginalURLByUserID(ctx context.Context, userID string) ([]models.URLPair, error) {
+	defer s.observe("GetOriginalURLByUserID", time.Now())
+	return s.Storage.GetOriginalURLByUserID(ctx, userID)
+}
+
+// DeleteURLByUserID - удаляет ссылки пользователя с учетом длительности в метриках.
+func (s *instrumented) DeleteURLByUserID(ctx context.Context, shortURL []string, userID string) error {
+	defer s.observe("DeleteURLByUserID", time.Now())
+	return s.Storage.DeleteURLByUserID(ctx, shortURL, userID)
+}
+
+// DeleteURLBatch - удаляет батч ссылок из очереди удаления с учетом длительности в метриках.
+func (s *instrumented) DeleteURLBatch(ctx context.Context, reqs []models.DeleteRequest) ([]models.DeleteResult, error) {
+	defer s.observe("DeleteURLBatch", time.Now())
+	return s.Storage.DeleteURLBatch(ctx, reqs)
+}
+
+// DeleteExpired - удаляет ссылки с истекшим сроком жизни с учетом длительности в метриках.
+func (s *instrumented) DeleteExpired(ctx context.Context, now time.Time, limit int) (int, error) {
+	defer s.observe("DeleteExpired", time.Now())
+	return s.Storage.DeleteExpired(ctx, now, limit)
+}
+
+// RestoreURLs - восстанавливает удаленные ссылки пользователя с учетом длительности в метриках.
+func (s *instrumented) RestoreURLs(ctx context.Context, shortURL []string, userID string, since time.Time) ([]string, error) {
+	defer s.observe("RestoreURLs", time.Now())
+	return s.Storage.RestoreURLs(ctx, shortURL, userID, since)
+}
+
+// PurgeDeleted - окончательно удаляет старые удаленные ссылки с учетом длительности в метриках.
+func (s *instrumented) PurgeDeleted(ctx context.Context, before time.Time, limit int) (int, error) {
+	defer s.observe("PurgeDeleted", time.Now())
+	return s.Storage.PurgeDeleted(ctx, before, limit)
+}
+
+// RecordClicks - записывает события переходов с учетом длительности в метриках.
+func (s *instrumented) RecordClicks(ctx context.Context, events []models.ClickEvent) error {
+	defer s.observe("RecordClicks", time.Now())
+	return s.Storage.RecordClicks(ctx, events)
+}
+
+// LinkStats - возвращает статистику переходов по ссылке с учетом длительности в метриках.
+func (s *instrumented) LinkStats(ctx context.Context, q models.LinkStatsQuery) (models.LinkStats, error) {
+	defer s.observe("LinkStats", time.Now())
+	return s.Storage.LinkStats(ctx, q)
+}
+
+// Stats - возвращает количество ссылок и пользователей с учетом длительности в метриках.
+func (s *instrumented) Stats(ctx context.Context) (models.Stats, error) {
+	defer s.observe("Stats", time.Now())
+	return s.Storage.Stats(ctx)
+}
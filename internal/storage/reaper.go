@@ -0,0 +1,112 @@
+package storage
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/darkseear/shortener/internal/logger"
+)
+
+// Reaper - фоновый процесс, помечающий удаленными ссылки с истекшим сроком жизни
+// и окончательно удаляющий ссылки, удаленные больше grace назад. Нулевой grace отключает окончательное удаление.
+// Ссылки удаляются порциями не больше batch, чтобы не держать долгие блокировки в хранилище.
+type Reaper struct {
+	store    Storage
+	interval time.Duration
+	batch    int
+	grace    time.Duration
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+}
+
+// NewReaper - конструктор для создания нового Reaper.
+// Принимает хранилище, интервал между проходами, размер порции и время, в течение которого
+// удаленную ссылку можно восстановить.
+func NewReaper(store Storage, interval time.Duration, batch int, grace time.Duration) *Reaper {
+	if batch <= 0 {
+		batch = 1
+	}
+	return &Reaper{store: store, interval: interval, batch: batch, grace: grace}
+}
+
+// Start - запускает периодическое удаление в отдельной горутине.
+// Удаление прекращается при отмене ctx или вызове Stop.
+func (r *Reaper) Start(ctx context.Context) {
+	ctx, r.cancel = context.WithCancel(ctx)
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		ticker := time.NewTicker(r.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if _, err := r.Reap(ctx); err != nil && ctx.Err() == nil {
+					logger.Log.Error("Reap expired urls error", zap.Error(err))
+				}
+				if _, err := r.Purge(ctx); err != nil && ctx.Err() == nil {
+					logger.Log.Error("Purge deleted urls error", zap.Error(err))
+				}
+			}
+		}
+	}()
+}
+
+// Stop - останавливает удаление и ждет завершения текущего прохода.
+func (r *Reaper) Stop() {
+	if r.cancel == nil {
+		return
+	}
+	r.cancel()
+	r.wg.Wait()
+}
+
+// Reap - удаляет все ссылки, истекшие к текущему моменту, порциями по batch.
+// Возвращает общее количество удаленных ссылок.
+func (r *Reaper) Reap(ctx context.Context) (int, error) {
+	now := time.Now()
+	total := 0
+	for {
+		n, err := r.store.DeleteExpired(ctx, now, r.batch)
+		total += n
+		if err != nil {
+			return total, err
+		}
+		if n < r.batch || ctx.Err() != nil {
+			break
+		}
+	}
+	if total > 0 {
+		logger.Log.Info("Reaped expired urls", zap.Int("count", total))
+	}
+	return total, nil
+}
+
+// Purge - окончательно удаляет ссылки, удаленные больше grace назад, порциями по batch.
+// Возвращает общее количество удаленных ссылок. При нулевом grace ничего не удаляет.
+func (r *Reaper) Purge(ctx context.Context) (int, error) {
+	if r.grace <= 0 {
+		return 0, nil
+	}
+	before := time.Now().Add(-r.grace)
+	total := 0
+	for {
+		n, err := r.store.PurgeDeleted(ctx, before, r.batch)
+		total += n
+		if err != nil {
+			return total, err
+		}
+		if n < r.batch || ctx.Err() != nil {
+			break
+		}
+	}
+	if total > 0 {
+		logger.Log.Info("Purged deleted urls", zap.Int("count", total))
+	}
+	return total, nil
+}
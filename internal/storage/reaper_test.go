@@ -0,0 +1,63 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/darkseear/shortener/internal/config"
+	"github.com/darkseear/shortener/internal/models"
+)
+
+func TestReaperReap(t *testing.T) {
+	ctx := context.Background()
+	store, err := New(&config.Config{URL: "http://localhost:8080"})
+	require.NoError(t, err)
+
+	expired := models.ShortenOptions{ExpiresAt: time.Now().Add(-time.Second)}
+	for i := 0; i < 5; i++ {
+		_, err := store.ShortenURL(ctx, fmt.Sprintf("https://example.com/%d", i), "1", expired)
+		require.NoError(t, err)
+	}
+	live, err := store.ShortenURL(ctx, "https://yandex.ru", "1", models.ShortenOptions{})
+	require.NoError(t, err)
+
+	// Истекшие ссылки удаляются за несколько порций по 2.
+	n, err := NewReaper(store, time.Minute, 2, time.Hour).Reap(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 5, n)
+
+	_, err = store.GetOriginalURL(ctx, live, "1", "")
+	require.NoError(t, err)
+	stats, err := store.Stats(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, stats.URLs)
+}
+
+func TestReaperPurge(t *testing.T) {
+	ctx := context.Background()
+	store, err := New(&config.Config{URL: "http://localhost:8080"})
+	require.NoError(t, err)
+	short, err := store.ShortenURL(ctx, "https://yandex.ru", "1", models.ShortenOptions{})
+	require.NoError(t, err)
+	require.NoError(t, store.DeleteURLByUserID(ctx, []string{short}, "1"))
+	time.Sleep(time.Millisecond)
+
+	// Нулевой grace отключает окончательное удаление, ссылку можно восстановить в любое время.
+	n, err := NewReaper(store, time.Minute, 10, 0).Purge(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 0, n)
+	result, err := RestoreURLs(ctx, store, "1", []string{short}, 0)
+	require.NoError(t, err)
+	assert.Equal(t, []string{short}, result.Restored)
+
+	require.NoError(t, store.DeleteURLByUserID(ctx, []string{short}, "1"))
+	time.Sleep(time.Millisecond)
+	n, err = NewReaper(store, time.Minute, 10, time.Nanosecond).Purge(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+}
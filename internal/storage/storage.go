@@ -3,6 +3,9 @@ package storage
 import (
 	"context"
 	"database/sql"
+	"errors"
+	"fmt"
+	"time"
 
 	"go.uber.org/zap"
 
@@ -12,20 +15,133 @@ import (
 	"github.com/darkseear/shortener/internal/services"
 )
 
+// Ошибки хранилища, которые обработчики сопоставляют со своими кодами ответа.
+var (
+	ErrNotFound         = services.ErrNotFound
+	ErrDeleted          = services.ErrDeleted
+	ErrExpired          = services.ErrExpired
+	ErrClicksExhausted  = services.ErrClicksExhausted
+	ErrPasswordRequired = services.ErrPasswordRequired
+	ErrWrongPassword    = services.ErrWrongPassword
+	ErrConflict         = services.ErrConflict
+	ErrOptionsConflict  = services.ErrOptionsConflict
+	ErrAliasTaken       = services.ErrAliasTaken
+)
+
 // Storage - интерфейс для работы с хранилищем.
+// Все методы принимают контекст запроса, чтобы отмена клиентом и остановка сервера
+// прерывали обращение к хранилищу.
 type Storage interface {
-	ShortenURL(longURL string, userID string) (string, int)
-	GetOriginalURL(shortURL string, userID string) (string, error)
-	GetOriginalURLByUserID(userID string) ([]models.URLPair, error)
-	DeleteURLByUserID(shortURL []string, userID string) error
+	ShortenURL(ctx context.Context, longURL string, userID string, opts models.ShortenOptions) (string, error)
+	ShortenBatch(ctx context.Context, items []models.BatchLongJSON, userID string) ([]models.BatchResult, error)
+	GetOriginalURL(ctx context.Context, shortURL string, userID string, password string) (string, error)
+	GetOriginalURLByUserID(ctx context.Context, userID string) ([]models.URLPair, error)
+	DeleteURLByUserID(ctx context.Context, shortURL []string, userID string) error
+	DeleteURLBatch(ctx context.Context, reqs []models.DeleteRequest) ([]models.DeleteResult, error)
+	DeleteExpired(ctx context.Context, now time.Time, limit int) (int, error)
+	RestoreURLs(ctx context.Context, shortURL []string, userID string, since time.Time) ([]string, error)
+	PurgeDeleted(ctx context.Context, before time.Time, limit int) (int, error)
+	RecordClicks(ctx context.Context, events []models.ClickEvent) error
+	LinkStats(ctx context.Context, q models.LinkStatsQuery) (models.LinkStats, error)
 	CreateTableDB(ctx context.Context) error
+	Ping(ctx context.Context) error
 	Stats(ctx context.Context) (models.Stats, error)
 	Close() error
 }
 
+// RestoreURLs - восстанавливает удаленные ссылки пользователя, удаленные не раньше grace назад.
+// Нулевой grace - ссылки не удаляются окончательно, поэтому восстановить можно любую удаленную.
+// Возвращает восстановленные ссылки и ссылки из запроса, которые восстановить нельзя.
+func RestoreURLs(ctx context.Context, s Storage, userID string, codes []string, grace time.Duration) (models.RestoreResult, error) {
+	var since time.Time
+	if grace > 0 {
+		since = time.Now().Add(-grace)
+	}
+	restored, err := s.RestoreURLs(ctx, codes, userID, since)
+	if err != nil {
+		return models.RestoreResult{}, err
+	}
+	done := make(map[string]bool, len(restored))
+	for _, code := range restored {
+		done[code] = true
+	}
+	result := models.RestoreResult{Restored: restored}
+	if result.Restored == nil {
+		result.Restored = []string{}
+	}
+	for _, code := range codes {
+		if !done[code] {
+			result.NotRestored = append(result.NotRestored, code)
+		}
+	}
+	return result, nil
+}
+
+// ShortenBatchItems - проверяет URL и срок жизни элементов батча, сокращает корректные одним вызовом хранилища
+// и возвращает результат со статусом для каждого элемента в исходном порядке.
+// Срок жизни в секундах переводится в момент истечения до передачи в хранилище.
+// Если хранилище вернуло ошибку для всего батча, все корректные элементы получают статус failed.
+func ShortenBatchItems(ctx context.Context, s Storage, items []models.BatchLongJSON, userID string) []models.BatchResult {
+	results := make([]models.BatchResult, len(items))
+	valid := make([]models.BatchLongJSON, 0, len(items))
+	positions := make([]int, 0, len(items))
+	now := time.Now()
+	for i, item := range items {
+		results[i].CorrelationID = item.CorrelationID
+		if err := services.ValidateURL(item.LongJSON); err != nil {
+			results[i].Status, results[i].Err = models.BatchStatusInvalid, err
+			continue
+		}
+		expiresAt, err := services.ResolveExpiry(item.TTL, item.ExpiresAt, now)
+		if err != nil {
+			results[i].Status, results[i].Err = models.BatchStatusInvalid, err
+			continue
+		}
+		item.TTL, item.ExpiresAt = 0, nil
+		if !expiresAt.IsZero() {
+			item.ExpiresAt = &expiresAt
+		}
+		valid = append(valid, item)
+		positions = append(positions, i)
+	}
+	if len(valid) == 0 {
+		return results
+	}
+
+	batch, err := s.ShortenBatch(ctx, valid, userID)
+	if err == nil && len(batch) != len(valid) {
+		err = fmt.Errorf("storage returned %d results for %d items", len(batch), len(valid))
+	}
+	for j, i := range positions {
+		if err != nil {
+			results[i].Status, results[i].Err = models.BatchStatusFailed, err
+			continue
+		}
+		results[i].ShortURL, results[i].Err = batch[j].ShortURL, batch[j].Err
+		switch {
+		case batch[j].Err == nil:
+			results[i].Status = models.BatchStatusCreated
+		case errors.Is(batch[j].Err, ErrConflict):
+			results[i].Status = models.BatchStatusExisting
+		case errors.Is(batch[j].Err, ErrOptionsConflict):
+			results[i].Status = models.BatchStatusInvalid
+		default:
+			results[i].Status = models.BatchStatusFailed
+		}
+	}
+	if err != nil {
+		logger.FromContext(ctx).Error("Shorten batch error", zap.Error(err))
+	}
+	return results
+}
+
 // New - функция для создания нового хранилища.
 // В зависимости от конфигурации создается либо хранилище в памяти, либо в файле, либо в базе данных.
 func New(config *config.Config) (Storage, error) {
+	if err := services.ValidateCodeGenerator(config); err != nil {
+		logger.Log.Error("Invalid short code generator config", zap.Error(err))
+		return nil, err
+	}
 
 	if config.DatabaseDSN != "" {
 		logger.Log.Info("Create storage DB")
@@ -34,13 +150,18 @@ func New(config *config.Config) (Storage, error) {
 			logger.Log.Error("Error create storage DB", zap.Error(err))
 			return nil, err
 		}
-		return services.NewDBStorage(db, config), nil
+		return instrument(services.NewDBStorage(db, config), "database"), nil
 	}
 	if config.MemoryFile != "" {
 		logger.Log.Info("Create storage MemoryFile")
-		return services.NewFileStore(config.MemoryFile, config), nil
+		fs, err := services.NewFileStore(config.MemoryFile, config)
+		if err != nil {
+			logger.Log.Error("Error create storage MemoryFile", zap.Error(err))
+			return nil, err
+		}
+		return instrument(fs, "file"), nil
 	}
 
 	logger.Log.Info("Create storage Memory")
-	return services.NewMemoryStorage(config), nil
+	return instrument(services.NewMemoryStorage(config), "memory"), nil
 }